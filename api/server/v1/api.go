@@ -18,6 +18,13 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	// ReturnDocumentsBefore and ReturnDocumentsAfter are the values of the "return_documents" option of the update
+	// and delete requests.
+	ReturnDocumentsBefore = "before"
+	ReturnDocumentsAfter  = "after"
+)
+
 type Request interface {
 	proto.Message
 
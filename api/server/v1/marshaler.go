@@ -76,6 +76,7 @@ type Metadata struct {
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int64      `json:"version,omitempty"`
 }
 
 func CreateMDFromResponseMD(x *ResponseMetadata) Metadata {
@@ -95,6 +96,7 @@ func CreateMDFromResponseMD(x *ResponseMetadata) Metadata {
 		tm := x.DeletedAt.AsTime()
 		md.DeletedAt = &tm
 	}
+	md.Version = x.Version
 
 	return md
 }
@@ -122,6 +124,9 @@ func (x *ReadRequest) UnmarshalJSON(data []byte) error {
 		case "fields":
 			// not decoding it here and let it decode during fields parsing
 			x.Fields = value
+		case "sort":
+			// not decoding it here and let it decode during sort parsing
+			x.Sort = value
 		case "options":
 			if err := jsoniter.Unmarshal(value, &x.Options); err != nil {
 				return err
@@ -131,6 +136,115 @@ func (x *ReadRequest) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// UnmarshalJSON on AggregateRequest avoids unmarshalling the pipeline, it is parsed by the aggregation.
+func (x *AggregateRequest) UnmarshalJSON(data []byte) error {
+	var mp map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(data, &mp); err != nil {
+		return err
+	}
+	for key, value := range mp {
+		switch key {
+		case "db":
+			if err := jsoniter.Unmarshal(value, &x.Db); err != nil {
+				return err
+			}
+		case "collection":
+			if err := jsoniter.Unmarshal(value, &x.Collection); err != nil {
+				return err
+			}
+		case "pipeline":
+			// not decoding it here and let it decode during pipeline parsing
+			x.Pipeline = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON on AggregateResponse returns the document as an object instead of bytes, like ReadResponse.
+func (x *AggregateResponse) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		Data json.RawMessage `json:"data,omitempty"`
+	}{
+		Data: x.Data,
+	}
+	return json.Marshal(resp)
+}
+
+// UnmarshalJSON on CountRequest avoids unmarshalling filter, it is parsed by the filter factory.
+func (x *CountRequest) UnmarshalJSON(data []byte) error {
+	var mp map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(data, &mp); err != nil {
+		return err
+	}
+	for key, value := range mp {
+		switch key {
+		case "db":
+			if err := jsoniter.Unmarshal(value, &x.Db); err != nil {
+				return err
+			}
+		case "collection":
+			if err := jsoniter.Unmarshal(value, &x.Collection); err != nil {
+				return err
+			}
+		case "filter":
+			// not decoding it here and let it decode during filter parsing
+			x.Filter = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON on CountResponse always returns the count, even if no document is counted.
+func (x *CountResponse) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		Count int64 `json:"count"`
+	}{
+		Count: x.Count,
+	}
+	return json.Marshal(resp)
+}
+
+// UnmarshalJSON on DistinctRequest avoids unmarshalling filter, it is parsed by the filter factory.
+func (x *DistinctRequest) UnmarshalJSON(data []byte) error {
+	var mp map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(data, &mp); err != nil {
+		return err
+	}
+	for key, value := range mp {
+		switch key {
+		case "db":
+			if err := jsoniter.Unmarshal(value, &x.Db); err != nil {
+				return err
+			}
+		case "collection":
+			if err := jsoniter.Unmarshal(value, &x.Collection); err != nil {
+				return err
+			}
+		case "field":
+			if err := jsoniter.Unmarshal(value, &x.Field); err != nil {
+				return err
+			}
+		case "filter":
+			// not decoding it here and let it decode during filter parsing
+			x.Filter = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON on DistinctResponse returns the values as JSON values instead of bytes.
+func (x *DistinctResponse) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		Values []json.RawMessage `json:"values"`
+	}{
+		Values: []json.RawMessage{},
+	}
+	for _, v := range x.Values {
+		resp.Values = append(resp.Values, v)
+	}
+	return json.Marshal(resp)
+}
+
 // UnmarshalJSON on InsertRequest avoids unmarshalling user document. We only need to extract primary/index keys from
 // the document and want to store the document as-is in the database. This way there is no extra cost of serialization/deserialization
 // and also less error-prone because we are not touching the user document. The req handler needs to extract out
@@ -230,6 +344,9 @@ func (x *UpdateRequest) UnmarshalJSON(data []byte) error {
 		case "filter":
 			// not decoding it here and let it decode during filter parsing
 			x.Filter = value
+		case "return_fields":
+			// not decoding it here and let it decode during fields parsing
+			x.ReturnFields = value
 		case "options":
 			if err := jsoniter.Unmarshal(value, &x.Options); err != nil {
 				return err
@@ -259,6 +376,9 @@ func (x *DeleteRequest) UnmarshalJSON(data []byte) error {
 		case "filter":
 			// not decoding it here and let it decode during filter parsing
 			x.Filter = value
+		case "return_fields":
+			// not decoding it here and let it decode during fields parsing
+			x.ReturnFields = value
 		case "options":
 			if err := jsoniter.Unmarshal(value, &x.Options); err != nil {
 				return err
@@ -368,7 +488,9 @@ type dmlResponse struct {
 	Metadata      Metadata          `json:"metadata,omitempty"`
 	Status        string            `json:"status,omitempty"`
 	ModifiedCount int32             `json:"modified_count,omitempty"`
+	DeletedCount  int32             `json:"deleted_count,omitempty"`
 	Keys          []json.RawMessage `json:"keys,omitempty"`
+	Documents     []json.RawMessage `json:"documents,omitempty"`
 }
 
 func (x *InsertResponse) MarshalJSON() ([]byte, error) {
@@ -388,9 +510,21 @@ func (x *ReplaceResponse) MarshalJSON() ([]byte, error) {
 }
 
 func (x *DeleteResponse) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&dmlResponse{Metadata: CreateMDFromResponseMD(x.Metadata), Status: x.Status})
+	return json.Marshal(&dmlResponse{Metadata: CreateMDFromResponseMD(x.Metadata), Status: x.Status, DeletedCount: x.DeletedCount, Documents: rawDocuments(x.Documents)})
 }
 
 func (x *UpdateResponse) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&dmlResponse{Metadata: CreateMDFromResponseMD(x.Metadata), Status: x.Status, ModifiedCount: x.ModifiedCount})
+	var keys []json.RawMessage
+	for _, k := range x.Keys {
+		keys = append(keys, k)
+	}
+	return json.Marshal(&dmlResponse{Metadata: CreateMDFromResponseMD(x.Metadata), Status: x.Status, ModifiedCount: x.ModifiedCount, Keys: keys, Documents: rawDocuments(x.Documents)})
+}
+
+func rawDocuments(documents [][]byte) []json.RawMessage {
+	var raw []json.RawMessage
+	for _, d := range documents {
+		raw = append(raw, d)
+	}
+	return raw
 }
@@ -30,3 +30,55 @@ func TestDocument(t *testing.T) {
 	var bb []byte
 	require.NoError(t, json.Unmarshal(b, &bb))
 }
+
+func TestUpdateReturnDocuments(t *testing.T) {
+	var req UpdateRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"filter": {"a": 1}, "fields": {"$set": {"b": 2}}, "return_fields": {"b": true}, "options": {"return_documents": "after"}}`), &req))
+	require.Equal(t, []byte(`{"b": true}`), req.ReturnFields)
+	require.Equal(t, ReturnDocumentsAfter, req.GetOptions().GetReturnDocuments())
+
+	resp, err := json.Marshal(&UpdateResponse{Status: "updated", ModifiedCount: 1, Documents: [][]byte{[]byte(`{"b":2}`)}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"metadata": {}, "status": "updated", "modified_count": 1, "documents": [{"b": 2}]}`, string(resp))
+
+	resp, err = json.Marshal(&DeleteResponse{Status: "deleted", DeletedCount: 1, Documents: [][]byte{[]byte(`{"a":1}`)}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"metadata": {}, "status": "deleted", "deleted_count": 1, "documents": [{"a": 1}]}`, string(resp))
+}
+
+func TestAggregate(t *testing.T) {
+	var req AggregateRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"db": "d", "collection": "c", "pipeline": [{"$limit": 1}]}`), &req))
+	require.Equal(t, "d", req.Db)
+	require.Equal(t, "c", req.Collection)
+	require.Equal(t, []byte(`[{"$limit": 1}]`), req.Pipeline)
+
+	resp, err := json.Marshal(&AggregateResponse{Data: []byte(`{"_id":"a","count":2}`)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"data": {"_id": "a", "count": 2}}`, string(resp))
+}
+
+func TestCountAndDistinct(t *testing.T) {
+	var countReq CountRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"db": "d", "collection": "c", "filter": {"a": 1}}`), &countReq))
+	require.Equal(t, "d", countReq.Db)
+	require.Equal(t, "c", countReq.Collection)
+	require.Equal(t, []byte(`{"a": 1}`), countReq.Filter)
+
+	resp, err := json.Marshal(&CountResponse{})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"count": 0}`, string(resp))
+
+	var distinctReq DistinctRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"db": "d", "collection": "c", "field": "a.b", "filter": {"a": 1}}`), &distinctReq))
+	require.Equal(t, "a.b", distinctReq.Field)
+	require.Equal(t, []byte(`{"a": 1}`), distinctReq.Filter)
+
+	resp, err = json.Marshal(&DistinctResponse{Values: [][]byte{[]byte(`1`), []byte(`"a"`)}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"values": [1, "a"]}`, string(resp))
+
+	resp, err = json.Marshal(&DistinctResponse{})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"values": []}`, string(resp))
+}
@@ -24,7 +24,7 @@ import (
 func IsTxSupported(ctx context.Context) bool {
 	m, _ := grpc.Method(ctx)
 	switch m {
-	case "Insert", "Replace", "Update", "Delete", "Read",
+	case "Insert", "Replace", "Update", "Delete", "Read", "Aggregate", "Count", "Distinct",
 		"CreateOrUpdateCollection", "DropCollection", "ListCollections",
 		"CommitTransaction", "RollbackTransaction":
 		return true
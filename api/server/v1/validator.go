@@ -61,6 +61,12 @@ func (x *ReplaceRequest) Validate() error {
 	if len(x.GetDocuments()) == 0 {
 		return Errorf(Code_INVALID_ARGUMENT, "empty documents received")
 	}
+	if err := isValidVersion(x.GetOptions().GetIfVersion()); err != nil {
+		return err
+	}
+	if x.GetOptions().GetIfVersion() > 0 && len(x.GetDocuments()) > 1 {
+		return Errorf(Code_INVALID_ARGUMENT, "if_version is only supported when replacing a single document")
+	}
 	return nil
 }
 
@@ -76,7 +82,13 @@ func (x *UpdateRequest) Validate() error {
 	if len(x.GetFilter()) == 0 {
 		return Errorf(Code_INVALID_ARGUMENT, "filter is a required field")
 	}
-	return nil
+
+	switch x.GetOptions().GetReturnDocuments() {
+	case "", ReturnDocumentsBefore, ReturnDocumentsAfter:
+	default:
+		return Errorf(Code_INVALID_ARGUMENT, "unsupported value '%s' of return_documents", x.GetOptions().GetReturnDocuments())
+	}
+	return isValidVersion(x.GetOptions().GetIfVersion())
 }
 
 func (x *DeleteRequest) Validate() error {
@@ -87,7 +99,13 @@ func (x *DeleteRequest) Validate() error {
 	if len(x.GetFilter()) == 0 {
 		return Errorf(Code_INVALID_ARGUMENT, "filter is a required field")
 	}
-	return nil
+
+	switch x.GetOptions().GetReturnDocuments() {
+	case "", ReturnDocumentsBefore:
+	default:
+		return Errorf(Code_INVALID_ARGUMENT, "unsupported value '%s' of return_documents", x.GetOptions().GetReturnDocuments())
+	}
+	return isValidVersion(x.GetOptions().GetIfVersion())
 }
 
 func (x *ReadRequest) Validate() error {
@@ -98,6 +116,46 @@ func (x *ReadRequest) Validate() error {
 	return nil
 }
 
+func (x *ExplainRequest) Validate() error {
+	if err := isValidCollectionAndDatabase(x.Collection, x.Db); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (x *AggregateRequest) Validate() error {
+	if err := isValidCollectionAndDatabase(x.Collection, x.Db); err != nil {
+		return err
+	}
+
+	if len(x.Pipeline) == 0 {
+		return Errorf(Code_INVALID_ARGUMENT, "pipeline is a required field")
+	}
+
+	return nil
+}
+
+func (x *CountRequest) Validate() error {
+	if err := isValidCollectionAndDatabase(x.Collection, x.Db); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (x *DistinctRequest) Validate() error {
+	if err := isValidCollectionAndDatabase(x.Collection, x.Db); err != nil {
+		return err
+	}
+
+	if len(x.Field) == 0 {
+		return Errorf(Code_INVALID_ARGUMENT, "field is a required field")
+	}
+
+	return nil
+}
+
 func (x *CreateOrUpdateCollectionRequest) Validate() error {
 	if err := isValidCollectionAndDatabase(x.Collection, x.Db); err != nil {
 		return err
@@ -185,3 +243,12 @@ func isValidCollectionAndDatabase(c string, db string) error {
 
 	return nil
 }
+
+// isValidVersion checks the "if_version" precondition, zero means that there is no precondition.
+func isValidVersion(version int64) error {
+	if version < 0 {
+		return Errorf(Code_INVALID_ARGUMENT, "invalid if_version '%d'", version)
+	}
+
+	return nil
+}
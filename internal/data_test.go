@@ -32,6 +32,16 @@ func TestEncode_Decode(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, d, data)
 	})
+	t.Run("version", func(t *testing.T) {
+		d := NewTableDataWithTS(NewTimestamp(), NewTimestamp(), []byte(`{"a": 1}`))
+		d.Version = 5
+		encoded, err := Encode(d)
+		require.NoError(t, err)
+
+		data, err := Decode(encoded)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), data.Version)
+	})
 	t.Run("not_implemented", func(t *testing.T) {
 		data, err := Decode([]byte(`{"a": 1, "b": "foo"}`))
 		require.Equal(t, api.Errorf(api.Code_INTERNAL, "unable to decode '123'"), err)
@@ -56,3 +56,11 @@ func (p *tableKey) IndexParts() []interface{} {
 func (p *tableKey) String() string {
 	return fmt.Sprintf("table:%v, indexKeyAndValues:%v", string(p.table), p.indexParts)
 }
+
+// maxIndexPart is the type of MaxIndexPart.
+type maxIndexPart struct{}
+
+// MaxIndexPart can be used as the last index part of a Key to form a key that sorts after all the keys that are
+// prefixed by the remaining index parts. This is only useful as a boundary of a range i.e. a key ending with
+// MaxIndexPart is never stored.
+var MaxIndexPart interface{} = maxIndexPart{}
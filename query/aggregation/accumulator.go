@@ -19,6 +19,7 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/tigrisdata/tigris/query/expression"
+	"github.com/tigrisdata/tigris/value"
 )
 
 // supported accumulators
@@ -57,10 +58,17 @@ func (a *AccumulatorFactory) Get() Aggregation {
 	return nil
 }
 
-// AccumulatorOp is a type of aggregation that can also be use in the group by to group values into subsets.
+// AccumulatorOp is a type of aggregation that can also be use in the group by to group values into subsets. The
+// expression is evaluated on every document of the group and the values are accumulated, if the expression is an
+// array then all its values are accumulated. $sum and $avg only accumulate the numeric values, $min and $max any
+// value that is not null.
 type AccumulatorOp struct {
 	Type string
 	Agg  expression.Expr
+
+	total  number
+	count  int64
+	result value.Value
 }
 
 func (a *AccumulatorOp) UnmarshalJSON(input []byte) error {
@@ -73,7 +81,96 @@ func (a *AccumulatorOp) UnmarshalJSON(input []byte) error {
 	return nil
 }
 
-func (a *AccumulatorOp) Apply(document jsoniter.RawMessage) {}
+// Clone returns an accumulator for the same expression with nothing accumulated, an accumulator is cloned for every
+// group.
+func (a *AccumulatorOp) Clone() *AccumulatorOp {
+	return &AccumulatorOp{
+		Type: a.Type,
+		Agg:  a.Agg,
+	}
+}
+
+// Apply accumulates the values of the document and returns the accumulated value.
+func (a *AccumulatorOp) Apply(document jsoniter.RawMessage) (value.Value, error) {
+	var values []value.Value
+	if operands, ok := a.Agg.([]expression.Expr); ok {
+		for _, operand := range operands {
+			v, err := Evaluate(operand, document)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	} else {
+		v, err := Evaluate(a.Agg, document)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	for _, v := range values {
+		a.accumulate(v)
+	}
+
+	return a.Result(), nil
+}
+
+func (a *AccumulatorOp) accumulate(v value.Value) {
+	if v == nil {
+		return
+	}
+
+	switch a.Type {
+	case sum, avg:
+		if n, ok := toNumber(v); ok {
+			a.total = a.total.add(n)
+			a.count++
+		}
+	case min:
+		if a.result == nil || compareValues(v, a.result) < 0 {
+			a.result = v
+		}
+	case max:
+		if a.result == nil || compareValues(v, a.result) > 0 {
+			a.result = v
+		}
+	}
+}
+
+// Result returns the accumulated value, the sum of no values is 0 and for the others it is null.
+func (a *AccumulatorOp) Result() value.Value {
+	switch a.Type {
+	case sum:
+		return a.total.value()
+	case avg:
+		if a.count == 0 {
+			return nil
+		}
+		return value.NewDoubleValue(a.total.float() / float64(a.count))
+	}
+
+	return a.result
+}
+
+// IsCount returns true if the accumulator is the sum of a numeric literal, the accumulated value is then the literal
+// multiplied by the number of the documents, see CountResult.
+func (a *AccumulatorOp) IsCount() bool {
+	if a.Type != sum {
+		return false
+	}
+
+	v, _ := a.Agg.(value.Value)
+	_, ok := toNumber(v)
+	return ok
+}
+
+// CountResult returns the result of the accumulator that IsCount for the number of the documents.
+func (a *AccumulatorOp) CountResult(count int64) value.Value {
+	v, _ := a.Agg.(value.Value)
+	n, _ := toNumber(v)
+	return n.multiply(newInteger(count)).value()
+}
 
 func (a *AccumulatorOp) String() string {
 	return fmt.Sprintf(`{"%s": %v}`, a.Type, a.Agg)
@@ -19,6 +19,7 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/tigrisdata/tigris/query/expression"
+	"github.com/tigrisdata/tigris/value"
 )
 
 // Aggregation operators either can pass a single expression or an array of expression. The below is an example of
@@ -41,7 +42,9 @@ import (
 //
 // { "$sum": [ "$final", "$midterm" ] }}
 type Aggregation interface {
-	Apply(document jsoniter.RawMessage)
+	// Apply evaluates the aggregation on the document, the arithmetic operators return the value computed from the
+	// document and the accumulators add the document to the accumulated value and return it.
+	Apply(document jsoniter.RawMessage) (value.Value, error)
 }
 
 // Unmarshal to unmarshal an aggregation object
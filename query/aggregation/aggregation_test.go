@@ -18,7 +18,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/query/expression"
+	"github.com/tigrisdata/tigris/value"
 )
 
 func TestAggregation(t *testing.T) {
@@ -35,3 +37,64 @@ func TestAggregation(t *testing.T) {
 	require.Equal(t, e.(Aggregation).(*AccumulatorOp).Type, "$avg")
 	require.Equal(t, e.(Aggregation).(*AccumulatorOp).Agg.(*ArithmeticOp).Type, "$multiply")
 }
+
+func TestArithmetic(t *testing.T) {
+	doc := []byte(`{"price": 2.5, "quantity": 4, "discount": 1, "name": "a", "nested": {"fee": 3}}`)
+	cases := []struct {
+		expr     string
+		expected value.Value
+		err      error
+	}{
+		{`{"$multiply": ["$price", "$quantity"]}`, value.NewDoubleValue(10), nil},
+		{`{"$add": ["$quantity", "$discount", "$nested.fee", 2]}`, value.NewIntValue(10), nil},
+		{`{"$add": [{"$multiply": ["$quantity", 2]}, "$discount"]}`, value.NewIntValue(9), nil},
+		{`{"$add": ["$quantity", "$missing"]}`, nil, nil},
+		{`{"$multiply": [9223372036854775807, 2]}`, value.NewDoubleValue(18446744073709551614), nil},
+		{`{"$add": ["$quantity", "$name"]}`, nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$add only supports numeric values")},
+	}
+	for _, c := range cases {
+		e, err := Unmarshal([]byte(c.expr))
+		require.NoError(t, err)
+
+		v, err := Evaluate(e, doc)
+		require.Equal(t, c.err, err, c.expr)
+		require.Equal(t, c.expected, v, c.expr)
+	}
+}
+
+func TestAccumulators(t *testing.T) {
+	docs := [][]byte{
+		[]byte(`{"a": 1, "b": 2.5, "s": "x"}`),
+		[]byte(`{"a": 3, "b": 1, "s": "y"}`),
+		[]byte(`{"a": "not a number", "b": null}`),
+		[]byte(`{"c": 1}`),
+	}
+	cases := []struct {
+		expr     string
+		expected value.Value
+	}{
+		{`{"$sum": "$a"}`, value.NewIntValue(4)},
+		{`{"$sum": 1}`, value.NewIntValue(4)},
+		{`{"$sum": ["$a", "$b"]}`, value.NewDoubleValue(7.5)},
+		{`{"$sum": "$missing"}`, value.NewIntValue(0)},
+		{`{"$avg": "$a"}`, value.NewDoubleValue(2)},
+		{`{"$avg": {"$multiply": ["$b", 2]}}`, value.NewDoubleValue(3.5)},
+		{`{"$avg": "$missing"}`, nil},
+		{`{"$min": "$b"}`, value.NewIntValue(1)},
+		{`{"$max": "$s"}`, value.NewStringValue("y")},
+		// numbers are lower than strings
+		{`{"$max": "$a"}`, value.NewStringValue("not a number")},
+		{`{"$min": "$missing"}`, nil},
+	}
+	for _, c := range cases {
+		e, err := Unmarshal([]byte(c.expr))
+		require.NoError(t, err)
+
+		acc := e.(*AccumulatorOp).Clone()
+		for _, doc := range docs {
+			_, err = acc.Apply(doc)
+			require.NoError(t, err, c.expr)
+		}
+		require.Equal(t, c.expected, acc.Result(), c.expr)
+	}
+}
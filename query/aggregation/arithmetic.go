@@ -16,9 +16,12 @@ package aggregation
 
 import (
 	"fmt"
+	"math"
 
 	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/query/expression"
+	"github.com/tigrisdata/tigris/value"
 )
 
 // supported arithmetic operators
@@ -45,6 +48,8 @@ func (a *ArithmeticFactory) Get() Aggregation {
 	return nil
 }
 
+// ArithmeticOp computes a value from the operands evaluated on a document, $add returns the sum and $multiply returns
+// the product of the operands. The result is null if any of the operands is null or missing.
 type ArithmeticOp struct {
 	Type string
 	Agg  expression.Expr
@@ -60,8 +65,107 @@ func (a *ArithmeticOp) UnmarshalJSON(input []byte) error {
 	return nil
 }
 
-func (a *ArithmeticOp) Apply(document jsoniter.RawMessage) {}
+// Apply returns the result of the operator on the operands evaluated on the document.
+func (a *ArithmeticOp) Apply(document jsoniter.RawMessage) (value.Value, error) {
+	operands, ok := a.Agg.([]expression.Expr)
+	if !ok {
+		operands = []expression.Expr{a.Agg}
+	}
+
+	result := newInteger(0)
+	if a.Type == multiply {
+		result = newInteger(1)
+	}
+	for _, operand := range operands {
+		v, err := Evaluate(operand, document)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, nil
+		}
+
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "%s only supports numeric values", a.Type)
+		}
+		if a.Type == multiply {
+			result = result.multiply(n)
+		} else {
+			result = result.add(n)
+		}
+	}
+
+	return result.value(), nil
+}
 
 func (a *ArithmeticOp) String() string {
 	return fmt.Sprintf(`{"%s": %v}`, a.Type, a.Agg)
 }
+
+// number is the result of the arithmetic, it stays an integer as long as the result fits in int64 and is converted to
+// double otherwise. The zero value is the integer 0.
+type number struct {
+	isDouble bool
+	i        int64
+	d        float64
+}
+
+func newInteger(i int64) number {
+	return number{i: i}
+}
+
+func newDouble(d float64) number {
+	return number{isDouble: true, d: d}
+}
+
+// toNumber returns the number if the value is numeric.
+func toNumber(v value.Value) (number, bool) {
+	switch n := v.(type) {
+	case *value.IntValue:
+		return newInteger(int64(*n)), true
+	case *value.DoubleValue:
+		return newDouble(float64(*n)), true
+	}
+
+	return number{}, false
+}
+
+func (n number) float() float64 {
+	if n.isDouble {
+		return n.d
+	}
+	return float64(n.i)
+}
+
+func (n number) add(o number) number {
+	if !n.isDouble && !o.isDouble {
+		sum := n.i + o.i
+		// the sum overflowed if both the operands have the same sign and the sum has the other sign
+		if (n.i >= 0) == (o.i >= 0) && (sum >= 0) != (n.i >= 0) {
+			return newDouble(float64(n.i) + float64(o.i))
+		}
+		return newInteger(sum)
+	}
+
+	return newDouble(n.float() + o.float())
+}
+
+func (n number) multiply(o number) number {
+	if !n.isDouble && !o.isDouble {
+		product := n.i * o.i
+		if n.i != 0 && (product/n.i != o.i || (n.i == -1 && o.i == math.MinInt64)) {
+			return newDouble(float64(n.i) * float64(o.i))
+		}
+		return newInteger(product)
+	}
+
+	return newDouble(n.float() * o.float())
+}
+
+func (n number) value() value.Value {
+	if n.isDouble {
+		return value.NewDoubleValue(n.d)
+	}
+	return value.NewIntValue(n.i)
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/value"
+)
+
+// Distinct collects the distinct values of a field across documents. The documents that don't have the field or
+// where it is null are skipped, and an array is a single value.
+type Distinct struct {
+	path      string
+	maxValues int
+	seen      map[string]struct{}
+	values    []value.Value
+}
+
+// NewDistinct returns Distinct for the field at the path, it errors once the field has more than maxValues values.
+func NewDistinct(path string, maxValues int) *Distinct {
+	return &Distinct{
+		path:      path,
+		maxValues: maxValues,
+		seen:      make(map[string]struct{}),
+	}
+}
+
+// Apply adds the value of the field of the document.
+func (d *Distinct) Apply(document jsoniter.RawMessage) error {
+	v, err := fieldValue(document, d.path)
+	if err != nil {
+		return err
+	}
+
+	return d.Add(v)
+}
+
+// Add adds the value if it is not already added, a nil value is skipped.
+func (d *Distinct) Add(v value.Value) error {
+	if v == nil {
+		return nil
+	}
+
+	encoded, err := valueToJSON(v)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.seen[string(encoded)]; ok {
+		return nil
+	}
+	if len(d.values) == d.maxValues {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' has more than %d distinct values", d.path, d.maxValues)
+	}
+
+	d.seen[string(encoded)] = struct{}{}
+	d.values = append(d.values, v)
+
+	return nil
+}
+
+// Values returns the JSON of the values in ascending order, see compareValues for the order across types.
+func (d *Distinct) Values() ([][]byte, error) {
+	sort.SliceStable(d.values, func(i, j int) bool {
+		return compareValues(d.values[i], d.values[j]) < 0
+	})
+
+	values := make([][]byte, 0, len(d.values))
+	for _, v := range d.values {
+		encoded, err := valueToJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, encoded)
+	}
+
+	return values, nil
+}
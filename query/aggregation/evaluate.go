@@ -0,0 +1,217 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/query/expression"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+// fieldPrefix marks a string in an expression as the path of a field of the document i.e. "$price" or "$address.city"
+// instead of a string literal.
+const fieldPrefix = "$"
+
+// Evaluate returns the value of the expression for the document. A string starting with "$" is the value of the field
+// of the document, any other string or number is a literal, an array evaluates to the array of the values of its items,
+// and an arithmetic operator is applied on the document. A nil value is returned if the field is missing or null.
+func Evaluate(expr expression.Expr, document jsoniter.RawMessage) (value.Value, error) {
+	switch e := expr.(type) {
+	case *value.StringValue:
+		if path, ok := fieldPath(e); ok {
+			return fieldValue(document, path)
+		}
+		return e, nil
+	case value.Value:
+		return e, nil
+	case []expression.Expr:
+		values := make([]value.Value, 0, len(e))
+		for _, item := range e {
+			v, err := Evaluate(item, document)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return value.NewArrayValue(values), nil
+	case *ArithmeticOp:
+		return e.Apply(document)
+	case *AccumulatorOp:
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' can only be used in $group", e.Type)
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "not a valid expression")
+}
+
+// fieldPath returns the path of the field if the string refers to a field.
+func fieldPath(s *value.StringValue) (string, bool) {
+	if str := string(*s); len(str) > len(fieldPrefix) && strings.HasPrefix(str, fieldPrefix) {
+		return str[len(fieldPrefix):], true
+	}
+
+	return "", false
+}
+
+// fieldValue returns the value of the field in the document, the path can be the path of a nested field.
+func fieldValue(document jsoniter.RawMessage, path string) (value.Value, error) {
+	v, dataType, _, err := jsonparser.Get(document, strings.Split(path, schema.FieldPathSeparator)...)
+	if err == jsonparser.KeyPathNotFoundError {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' can't be read from the document", path)
+	}
+
+	return jsonToValue(path, v, dataType)
+}
+
+// jsonToValue converts the JSON value to a value, the documents of the pipeline don't have a schema once they are
+// grouped or projected, so the type of the value is decided by the JSON type. An integral number is an integer, any
+// other number is a double.
+func jsonToValue(path string, v []byte, dataType jsonparser.ValueType) (value.Value, error) {
+	switch dataType {
+	case jsonparser.Null:
+		return nil, nil
+	case jsonparser.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return value.NewIntValue(i), nil
+		}
+		d, err := strconv.ParseFloat(string(v), 64)
+		if err != nil || math.IsNaN(d) || math.IsInf(d, 0) {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' is not a valid number", path)
+		}
+		return value.NewDoubleValue(d), nil
+	case jsonparser.String:
+		s, err := jsonparser.ParseString(v)
+		if err != nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' is not a valid string", path)
+		}
+		return value.NewStringValue(s), nil
+	case jsonparser.Boolean:
+		b, err := jsonparser.ParseBoolean(v)
+		if err != nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' is not a valid boolean", path)
+		}
+		return value.NewBoolValue(b), nil
+	case jsonparser.Array:
+		values := []value.Value{}
+		var itemErr error
+		_, err := jsonparser.ArrayEach(v, func(item []byte, itemType jsonparser.ValueType, _ int, _ error) {
+			if itemErr != nil {
+				return
+			}
+			var iv value.Value
+			if iv, itemErr = jsonToValue(path, item, itemType); itemErr == nil {
+				values = append(values, iv)
+			}
+		})
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		if err != nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' is not a valid array", path)
+		}
+		return value.NewArrayValue(values), nil
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' of type object can't be used in an expression", path)
+}
+
+// valueToJSON returns the JSON of the value, nil is encoded as null.
+func valueToJSON(v value.Value) ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+
+	if a, ok := v.(*value.ArrayValue); ok {
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, item := range *a {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encoded, err := valueToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(encoded)
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+	}
+
+	return jsoniter.Marshal(v.AsInterface())
+}
+
+// compareValues compares the values of a field across documents. The values are compared as per their type, nil is
+// lower than any other value and the values of different types are ordered by the type in the order numbers,
+// strings, booleans, arrays and then everything else.
+func compareValues(a value.Value, b value.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return ta - tb
+	}
+	if _, ok := a.(*value.ArrayValue); ok {
+		return compareArrays(*a.(*value.ArrayValue), *b.(*value.ArrayValue))
+	}
+
+	res, err := a.CompareTo(b)
+	if err != nil {
+		return 0
+	}
+	return res
+}
+
+// compareArrays compares the arrays item by item, arrays can have nil items which ArrayValue can't compare.
+func compareArrays(a value.ArrayValue, b value.ArrayValue) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if res := compareValues(a[i], b[i]); res != 0 {
+			return res
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+func typeOrder(v value.Value) int {
+	switch v.(type) {
+	case *value.IntValue, *value.DoubleValue:
+		return 0
+	case *value.StringValue:
+		return 1
+	case *value.BoolValue:
+		return 2
+	case *value.ArrayValue:
+		return 3
+	default:
+		return 4
+	}
+}
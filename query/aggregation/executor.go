@@ -0,0 +1,462 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+// Limits are the limits of the stages that need to keep the documents in memory.
+type Limits struct {
+	// MaxGroups is the maximum number of groups of a $group stage.
+	MaxGroups int
+	// MaxSortRows is the maximum number of documents sorted by a $sort stage that is not followed by $limit.
+	MaxSortRows int
+}
+
+// Executor runs the stages on the documents that are passed to it one by one, and emits the documents returned by the
+// last stage. $group and $sort only emit the documents once all the documents are passed.
+type Executor struct {
+	head processor
+}
+
+// processor is a stage of the executor, it passes its documents to the next processor.
+type processor interface {
+	// process is given the documents one by one, it returns false once it doesn't need more documents.
+	process(document []byte) (bool, error)
+	// done is called after the last document.
+	done() error
+}
+
+// NewExecutor returns the Executor for the stages, the match stage of the pipeline is not part of the executor and
+// needs to be applied on the documents before they are passed to it.
+func NewExecutor(stages []Stage, limits Limits, emit func(document []byte) error) *Executor {
+	var next processor = &emitter{emit: emit}
+	for i := len(stages) - 1; i >= 0; i-- {
+		switch s := stages[i].(type) {
+		case *GroupStage:
+			next = &groupProcessor{stage: s, next: next, maxGroups: limits.MaxGroups, groups: make(map[string]*groupState)}
+		case *ProjectStage:
+			next = &projectProcessor{stage: s, next: next}
+		case *SortStage:
+			sp := &sortProcessor{stage: s, next: next, maxRows: limits.MaxSortRows}
+			if lp, ok := next.(*limitProcessor); ok {
+				// only the documents that can be returned by the limit need to be kept
+				sp.limit = lp.stage.Limit
+			}
+			next = sp
+		case *LimitStage:
+			next = &limitProcessor{stage: s, next: next}
+		}
+	}
+
+	return &Executor{head: next}
+}
+
+// Apply passes the document to the stages, it returns false once the stages don't need more documents.
+func (e *Executor) Apply(document []byte) (bool, error) {
+	return e.head.process(document)
+}
+
+// Done is called after the last document, it emits the documents that are kept by the stages.
+func (e *Executor) Done() error {
+	return e.head.done()
+}
+
+type emitter struct {
+	emit func(document []byte) error
+}
+
+func (e *emitter) process(document []byte) (bool, error) {
+	return true, e.emit(document)
+}
+
+func (e *emitter) done() error { return nil }
+
+type groupState struct {
+	id           []byte
+	accumulators []*AccumulatorOp
+}
+
+type groupProcessor struct {
+	stage     *GroupStage
+	next      processor
+	maxGroups int
+	groups    map[string]*groupState
+	order     []*groupState
+}
+
+func (g *groupProcessor) process(document []byte) (bool, error) {
+	id, err := g.stage.evaluateID(document)
+	if err != nil {
+		return false, err
+	}
+
+	state, ok := g.groups[string(id)]
+	if !ok {
+		if len(g.order) == g.maxGroups {
+			return false, api.Errorf(api.Code_INVALID_ARGUMENT, "$group has more than %d groups", g.maxGroups)
+		}
+
+		state = &groupState{id: id}
+		for _, a := range g.stage.Accumulators {
+			state.accumulators = append(state.accumulators, a.Acc.Clone())
+		}
+		g.groups[string(id)] = state
+		g.order = append(g.order, state)
+	}
+
+	for _, acc := range state.accumulators {
+		if _, err = acc.Apply(document); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (g *groupProcessor) done() error {
+	for _, state := range g.order {
+		var results []value.Value
+		for _, acc := range state.accumulators {
+			results = append(results, acc.Result())
+		}
+
+		document, err := g.stage.document(state.id, results)
+		if err != nil {
+			return err
+		}
+		more, err := g.next.process(document)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+
+	return g.next.done()
+}
+
+// evaluateID returns the JSON of the value of the group of the document, the documents having the same JSON are in the
+// same group.
+func (g *GroupStage) evaluateID(document []byte) ([]byte, error) {
+	if len(g.IDFields) == 0 {
+		if g.ID == nil {
+			return []byte("null"), nil
+		}
+
+		v, err := Evaluate(g.ID, document)
+		if err != nil {
+			return nil, err
+		}
+		return valueToJSON(v)
+	}
+
+	var values []namedValue
+	for _, f := range g.IDFields {
+		v, err := Evaluate(f.Expr, document)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, namedValue{Name: f.Name, Value: v})
+	}
+	return objectJSON(values)
+}
+
+// document returns the document of a group having the JSON of the value of the group and the accumulated values.
+func (g *GroupStage) document(id []byte, results []value.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"` + groupID + `":`)
+	buf.Write(id)
+	for i, a := range g.Accumulators {
+		name, err := jsoniter.Marshal(a.Name)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := valueToJSON(results[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte(',')
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(encoded)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// CountField returns the path of the field that the documents are grouped by if the group only counts the documents
+// of every value of a single field i.e. {"_id": "$brand", "count": {"$sum": 1}}. Such a group can be computed from the
+// number of the documents having every value of the field, see CountedDocuments.
+func (g *GroupStage) CountField() (string, bool) {
+	id, ok := g.ID.(*value.StringValue)
+	if !ok || len(g.IDFields) > 0 {
+		return "", false
+	}
+	path, ok := fieldPath(id)
+	if !ok {
+		return "", false
+	}
+	for _, a := range g.Accumulators {
+		if !a.Acc.IsCount() {
+			return "", false
+		}
+	}
+
+	return path, true
+}
+
+// GroupCount is the number of the documents having the value, a nil value is used for the documents that don't have
+// the field.
+type GroupCount struct {
+	Value value.Value
+	Count int64
+}
+
+// CountedDocuments returns the documents of the group whose CountField is set, using the number of the documents of
+// every group.
+func (g *GroupStage) CountedDocuments(counts []GroupCount) ([][]byte, error) {
+	var documents [][]byte
+	for _, c := range counts {
+		id, err := valueToJSON(c.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		var results []value.Value
+		for _, a := range g.Accumulators {
+			results = append(results, a.Acc.CountResult(c.Count))
+		}
+		document, err := g.document(id, results)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+// namedValue is the value of a field of a document.
+type namedValue struct {
+	Name  string
+	Value value.Value
+}
+
+// objectJSON returns the JSON object having the values as its fields.
+func objectJSON(values []namedValue) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range values {
+		name, err := jsoniter.Marshal(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := valueToJSON(v.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(encoded)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+type projectProcessor struct {
+	stage *ProjectStage
+	next  processor
+}
+
+func (p *projectProcessor) process(document []byte) (bool, error) {
+	projected, err := p.stage.apply(document)
+	if err != nil {
+		return false, err
+	}
+
+	return p.next.process(projected)
+}
+
+func (p *projectProcessor) done() error {
+	return p.next.done()
+}
+
+// apply returns the projected document.
+func (p *ProjectStage) apply(document []byte) ([]byte, error) {
+	if len(p.Include) == 0 {
+		projected := append([]byte{}, document...)
+		for _, name := range p.Exclude {
+			projected = jsonparser.Delete(projected, strings.Split(name, schema.FieldPathSeparator)...)
+		}
+		return projected, nil
+	}
+
+	include := p.Include
+	if !p.excludes(groupID) {
+		include = append([]NamedExpr{{Name: groupID}}, include...)
+	}
+
+	projected := []byte("{}")
+	for _, f := range include {
+		path := strings.Split(f.Name, schema.FieldPathSeparator)
+
+		var encoded []byte
+		if f.Expr == nil {
+			v, dataType, _, err := jsonparser.Get(document, path...)
+			if err == jsonparser.KeyPathNotFoundError {
+				continue
+			}
+			if err != nil {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' can't be read from the document", f.Name)
+			}
+			encoded = rawValue(v, dataType)
+		} else {
+			v, err := Evaluate(f.Expr, document)
+			if err != nil {
+				return nil, err
+			}
+			if encoded, err = valueToJSON(v); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		if projected, err = jsonparser.Set(projected, encoded, path...); err != nil {
+			return nil, err
+		}
+	}
+
+	return projected, nil
+}
+
+func (p *ProjectStage) excludes(name string) bool {
+	for _, e := range p.Exclude {
+		if e == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortProcessor keeps the documents in memory and sorts them once all the documents are passed. If the sort is
+// followed by a limit then only the documents that can be returned by the limit are kept.
+type sortProcessor struct {
+	stage   *SortStage
+	next    processor
+	limit   int64
+	maxRows int
+	rows    []sortRow
+}
+
+type sortRow struct {
+	document []byte
+	values   []value.Value
+}
+
+func (s *sortProcessor) process(document []byte) (bool, error) {
+	values := make([]value.Value, 0, len(s.stage.Ordering))
+	for _, f := range s.stage.Ordering {
+		v, err := fieldValue(document, f.Name)
+		if err != nil {
+			return false, err
+		}
+		values = append(values, v)
+	}
+	s.rows = append(s.rows, sortRow{document: document, values: values})
+
+	if s.limit > 0 {
+		if int64(len(s.rows)) >= 2*s.limit {
+			s.sort()
+			s.rows = s.rows[:s.limit]
+		}
+	} else if len(s.rows) > s.maxRows {
+		return false, api.Errorf(api.Code_INVALID_ARGUMENT, "$sort needs more than %d documents to be sorted in memory, use a $limit after it", s.maxRows)
+	}
+
+	return true, nil
+}
+
+func (s *sortProcessor) sort() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return s.compare(s.rows[i].values, s.rows[j].values) < 0
+	})
+}
+
+func (s *sortProcessor) compare(a []value.Value, b []value.Value) int {
+	for i, f := range s.stage.Ordering {
+		if res := compareValues(a[i], b[i]); res != 0 {
+			if !f.Ascending {
+				return -res
+			}
+			return res
+		}
+	}
+
+	return 0
+}
+
+func (s *sortProcessor) done() error {
+	s.sort()
+	for _, row := range s.rows {
+		more, err := s.next.process(row.document)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+
+	return s.next.done()
+}
+
+type limitProcessor struct {
+	stage *LimitStage
+	next  processor
+	count int64
+}
+
+func (l *limitProcessor) process(document []byte) (bool, error) {
+	if l.count >= l.stage.Limit {
+		return false, nil
+	}
+
+	l.count++
+	more, err := l.next.process(document)
+	return more && l.count < l.stage.Limit, err
+}
+
+func (l *limitProcessor) done() error {
+	return l.next.done()
+}
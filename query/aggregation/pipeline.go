@@ -0,0 +1,371 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/query/expression"
+	qsort "github.com/tigrisdata/tigris/query/sort"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+// supported stages
+const (
+	match   = "$match"
+	group   = "$group"
+	project = "$project"
+	sortBy  = "$sort"
+	limit   = "$limit"
+)
+
+// groupID is the field of the documents returned by $group that has the value grouped by.
+const groupID = "_id"
+
+// Pipeline is the list of the stages that the documents of a collection go through, every stage gets the documents
+// returned by the stage before it. The pipeline is an array of objects each having a single stage,
+//
+//	[
+//	  {"$match": {"brand": "tigris"}},
+//	  {"$group": {"_id": "$category", "total": {"$sum": {"$multiply": ["$price", "$quantity"]}}, "count": {"$sum": 1}}},
+//	  {"$project": {"_id": 0, "category": "$_id", "total": 1}},
+//	  {"$sort": [{"total": "$desc"}]},
+//	  {"$limit": 10}
+//	]
+//
+// $match is the filter of the documents read from the collection, so it is only allowed as the first stage. The
+// other stages can be used in any order and more than once.
+type Pipeline struct {
+	// Match is the filter of the $match stage, empty if the pipeline doesn't have one.
+	Match jsoniter.RawMessage
+	// Stages are the stages after $match.
+	Stages []Stage
+}
+
+// Stage is one of GroupStage, ProjectStage, SortStage or LimitStage.
+type Stage interface {
+	Name() string
+}
+
+// GroupStage returns a document for every distinct value of the ID expression, having the value as "_id" and the
+// accumulated values of the documents of the group. The ID is either an expression, a list of named expressions to
+// group by multiple values, or nil to group all the documents together.
+//
+//	{"$group": {"_id": "$category", "<field>": {"$sum": "$price"}}}
+//	{"$group": {"_id": {"category": "$category", "brand": "$brand"}, "<field>": {"$max": "$price"}}}
+type GroupStage struct {
+	ID           expression.Expr
+	IDFields     []NamedExpr
+	Accumulators []NamedAccumulator
+}
+
+// NamedExpr is an expression whose value is set as the field of a document.
+type NamedExpr struct {
+	Name string
+	Expr expression.Expr
+}
+
+// NamedAccumulator is an accumulator whose value is set as the field of the documents returned by $group.
+type NamedAccumulator struct {
+	Name string
+	Acc  *AccumulatorOp
+}
+
+// ProjectStage reshapes every document. A field set to 1 or true is kept, set to 0 or false is removed and set to any
+// other expression is added with the value of the expression. Fields can't be kept and removed in the same stage,
+// except "_id" which is kept unless it is removed.
+//
+//	{"$project": {"name": 1, "total": {"$multiply": ["$price", "$quantity"]}}}
+type ProjectStage struct {
+	// Include are the fields of the projected documents in the order of the stage, the Expr of the kept fields is nil.
+	Include []NamedExpr
+	Exclude []string
+}
+
+// SortStage sorts the documents, it uses the same format as the sort of the reads.
+//
+//	{"$sort": [{"total": "$desc"}]}
+type SortStage struct {
+	Ordering qsort.Ordering
+}
+
+// LimitStage only passes the first Limit documents.
+//
+//	{"$limit": 10}
+type LimitStage struct {
+	Limit int64
+}
+
+func (g *GroupStage) Name() string   { return group }
+func (p *ProjectStage) Name() string { return project }
+func (s *SortStage) Name() string    { return sortBy }
+func (l *LimitStage) Name() string   { return limit }
+
+// UnmarshalPipeline parses the pipeline of an aggregate request.
+func UnmarshalPipeline(input jsoniter.RawMessage) (*Pipeline, error) {
+	invalid := api.Errorf(api.Code_INVALID_ARGUMENT, "pipeline needs an array of stages")
+	if _, dataType, _, err := jsonparser.Get(input); err != nil || dataType != jsonparser.Array {
+		return nil, invalid
+	}
+
+	p := &Pipeline{}
+	var itemErr error
+	_, err := jsonparser.ArrayEach(input, func(item []byte, dataType jsonparser.ValueType, _ int, _ error) {
+		if itemErr != nil {
+			return
+		}
+		if dataType != jsonparser.Object {
+			itemErr = invalid
+			return
+		}
+
+		var stages int
+		itemErr = jsonparser.ObjectEach(item, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+			if stages++; stages > 1 {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "a stage of the pipeline needs a single operator")
+			}
+
+			return p.addStage(string(key), v, dataType)
+		})
+		if itemErr == nil && stages == 0 {
+			itemErr = api.Errorf(api.Code_INVALID_ARGUMENT, "a stage of the pipeline needs a single operator")
+		}
+	})
+	if itemErr != nil {
+		return nil, itemErr
+	}
+	if err != nil {
+		return nil, invalid
+	}
+
+	return p, nil
+}
+
+func (p *Pipeline) addStage(name string, input []byte, dataType jsonparser.ValueType) error {
+	if name == match {
+		if len(p.Stages) > 0 || len(p.Match) > 0 {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "$match is only supported as the first stage of the pipeline")
+		}
+		if dataType != jsonparser.Object {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "$match needs a filter")
+		}
+		p.Match = input
+		return nil
+	}
+
+	var stage Stage
+	var err error
+	switch name {
+	case group:
+		stage, err = unmarshalGroup(input, dataType)
+	case project:
+		stage, err = unmarshalProject(input, dataType)
+	case sortBy:
+		stage, err = unmarshalSort(input)
+	case limit:
+		stage, err = unmarshalLimit(input, dataType)
+	default:
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported stage '%s'", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Stages = append(p.Stages, stage)
+	return nil
+}
+
+func unmarshalGroup(input []byte, dataType jsonparser.ValueType) (*GroupStage, error) {
+	if dataType != jsonparser.Object {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$group needs an object with '%s' and the accumulators", groupID)
+	}
+
+	g := &GroupStage{}
+	var hasID bool
+	err := jsonparser.ObjectEach(input, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+		name := string(key)
+		if name == groupID {
+			hasID = true
+			return g.unmarshalID(v, dataType)
+		}
+		if err := validFieldName(name); err != nil {
+			return err
+		}
+
+		expr, err := expression.Unmarshal(rawValue(v, dataType), UnmarshalAggObject)
+		if err != nil {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' of $group needs an accumulator", name)
+		}
+		acc, ok := expr.(*AccumulatorOp)
+		if !ok {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' of $group needs an accumulator", name)
+		}
+		g.Accumulators = append(g.Accumulators, NamedAccumulator{Name: name, Acc: acc})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasID {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$group needs an '%s'", groupID)
+	}
+
+	return g, nil
+}
+
+// unmarshalID parses the "_id" of $group, an object whose keys are not operators is a list of named expressions.
+func (g *GroupStage) unmarshalID(input []byte, dataType jsonparser.ValueType) error {
+	if dataType == jsonparser.Null {
+		return nil
+	}
+
+	if dataType == jsonparser.Object && !isOperator(input) {
+		return jsonparser.ObjectEach(input, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+			expr, err := unmarshalExpr(rawValue(v, dataType))
+			if err != nil {
+				return err
+			}
+			g.IDFields = append(g.IDFields, NamedExpr{Name: string(key), Expr: expr})
+			return nil
+		})
+	}
+
+	expr, err := unmarshalExpr(rawValue(input, dataType))
+	if err != nil {
+		return err
+	}
+	g.ID = expr
+	return nil
+}
+
+func unmarshalProject(input []byte, dataType jsonparser.ValueType) (*ProjectStage, error) {
+	if dataType != jsonparser.Object {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$project needs an object of the fields")
+	}
+
+	p := &ProjectStage{}
+	err := jsonparser.ObjectEach(input, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+		name := string(key)
+		if err := validFieldName(name); err != nil && dataType != jsonparser.Boolean && dataType != jsonparser.Number {
+			return err
+		}
+
+		switch dataType {
+		case jsonparser.Boolean:
+			if b, _ := jsonparser.ParseBoolean(v); b {
+				p.Include = append(p.Include, NamedExpr{Name: name})
+			} else {
+				p.Exclude = append(p.Exclude, name)
+			}
+		case jsonparser.Number:
+			if n, err := strconv.ParseFloat(string(v), 64); err == nil && n == 0 {
+				p.Exclude = append(p.Exclude, name)
+			} else {
+				p.Include = append(p.Include, NamedExpr{Name: name})
+			}
+		default:
+			expr, err := unmarshalExpr(rawValue(v, dataType))
+			if err != nil {
+				return err
+			}
+			p.Include = append(p.Include, NamedExpr{Name: name, Expr: expr})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range p.Exclude {
+		if name != groupID && len(p.Include) > 0 {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$project can't keep and remove fields at the same time")
+		}
+	}
+
+	return p, nil
+}
+
+func unmarshalSort(input []byte) (*SortStage, error) {
+	ordering, err := qsort.UnmarshalSort(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(ordering) == 0 {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$sort needs at least one field")
+	}
+
+	return &SortStage{Ordering: ordering}, nil
+}
+
+func unmarshalLimit(input []byte, dataType jsonparser.ValueType) (*LimitStage, error) {
+	if dataType == jsonparser.Number {
+		if l, err := strconv.ParseInt(string(input), 10, 64); err == nil && l > 0 {
+			return &LimitStage{Limit: l}, nil
+		}
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$limit needs a positive integer")
+}
+
+// unmarshalExpr parses an expression that is evaluated on a document.
+func unmarshalExpr(input []byte) (expression.Expr, error) {
+	expr, err := Unmarshal(input)
+	if err != nil {
+		if _, ok := err.(*api.TigrisError); ok {
+			return nil, err
+		}
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "%s", err.Error())
+	}
+	if acc, ok := expr.(*AccumulatorOp); ok {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' can only be used in $group", acc.Type)
+	}
+
+	return expr, nil
+}
+
+// isOperator returns true if the object is an operator like {"$add": [...]}.
+func isOperator(input []byte) bool {
+	var operator bool
+	_ = jsonparser.ObjectEach(input, func(key []byte, _ []byte, _ jsonparser.ValueType, _ int) error {
+		operator = strings.HasPrefix(string(key), fieldPrefix)
+		return nil
+	})
+
+	return operator
+}
+
+func validFieldName(name string) error {
+	if len(name) == 0 || strings.HasPrefix(name, fieldPrefix) || strings.Contains(name, schema.FieldPathSeparator) {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not a valid field name", name)
+	}
+
+	return nil
+}
+
+// rawValue returns the JSON of the value returned by jsonparser, which returns the strings without the quotes.
+func rawValue(v []byte, dataType jsonparser.ValueType) []byte {
+	if dataType == jsonparser.String {
+		quoted := make([]byte, 0, len(v)+2)
+		quoted = append(quoted, '"')
+		quoted = append(quoted, v...)
+		return append(quoted, '"')
+	}
+
+	return v
+}
@@ -0,0 +1,197 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/value"
+)
+
+var pipelineDocs = []string{
+	`{"id": 1, "brand": "a", "price": 10, "qty": 1, "info": {"color": "red"}}`,
+	`{"id": 2, "brand": "b", "price": 5.5, "qty": 2, "info": {"color": "blue"}}`,
+	`{"id": 3, "brand": "a", "price": 20, "qty": 3, "info": {"color": "red"}}`,
+	`{"id": 4, "price": 1, "qty": 1}`,
+	`{"id": 5, "brand": "b", "price": 4, "qty": 5, "info": {"color": "red"}}`,
+}
+
+func runPipeline(t *testing.T, pipeline string, limits Limits) ([]string, error) {
+	p, err := UnmarshalPipeline([]byte(pipeline))
+	require.NoError(t, err)
+
+	var output []string
+	exec := NewExecutor(p.Stages, limits, func(document []byte) error {
+		output = append(output, string(document))
+		return nil
+	})
+	for _, doc := range pipelineDocs {
+		more, err := exec.Apply([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	return output, exec.Done()
+}
+
+func TestPipeline(t *testing.T) {
+	limits := Limits{MaxGroups: 10, MaxSortRows: 10}
+	cases := []struct {
+		pipeline string
+		expected []string
+	}{
+		{
+			`[{"$group": {"_id": "$brand", "total": {"$sum": {"$multiply": ["$price", "$qty"]}}, "count": {"$sum": 1}, "max": {"$max": "$price"}}}]`,
+			[]string{
+				`{"_id":"a","total":70,"count":2,"max":20}`,
+				`{"_id":"b","total":31,"count":2,"max":5.5}`,
+				`{"_id":null,"total":1,"count":1,"max":1}`,
+			},
+		},
+		{
+			`[{"$group": {"_id": null, "avg": {"$avg": "$qty"}, "min": {"$min": "$info.color"}}}]`,
+			[]string{`{"_id":null,"avg":2.4,"min":"blue"}`},
+		},
+		{
+			`[{"$group": {"_id": {"brand": "$brand", "color": "$info.color"}, "count": {"$sum": 1}}}, {"$sort": [{"count": "$desc"}, {"_id.brand": "$asc"}]}, {"$limit": 2}]`,
+			[]string{
+				`{"_id":{"brand":"a","color":"red"},"count":2}`,
+				`{"_id":{"brand":null,"color":null},"count":1}`,
+			},
+		},
+		{
+			`[{"$sort": [{"price": "$desc"}]}, {"$limit": 2}, {"$project": {"_id": 0, "id": 1, "color": "$info.color", "value": {"$multiply": ["$price", "$qty"]}}}]`,
+			[]string{
+				`{"id":3,"color":"red","value":60}`,
+				`{"id":1,"color":"red","value":10}`,
+			},
+		},
+		{
+			`[{"$project": {"info": 0, "brand": 0}}, {"$limit": 1}]`,
+			[]string{`{"id": 1, "price": 10, "qty": 1}`},
+		},
+		{
+			`[{"$group": {"_id": "$brand", "count": {"$sum": 1}}}, {"$project": {"brand": "$_id", "count": 1}}, {"$sort": [{"brand": "$asc"}]}]`,
+			[]string{
+				`{"_id":null,"brand":null,"count":1}`,
+				`{"_id":"a","brand":"a","count":2}`,
+				`{"_id":"b","brand":"b","count":2}`,
+			},
+		},
+	}
+	for _, c := range cases {
+		output, err := runPipeline(t, c.pipeline, limits)
+		require.NoError(t, err, c.pipeline)
+		require.Equal(t, c.expected, output, c.pipeline)
+	}
+
+	// every document is a group of its own
+	_, err := runPipeline(t, `[{"$group": {"_id": "$id", "count": {"$sum": 1}}}]`, Limits{MaxGroups: 3})
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "$group has more than 3 groups"), err)
+
+	_, err = runPipeline(t, `[{"$sort": [{"id": "$asc"}]}]`, Limits{MaxSortRows: 3})
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "$sort needs more than 3 documents to be sorted in memory, use a $limit after it"), err)
+
+	output, err := runPipeline(t, `[{"$sort": [{"id": "$desc"}]}, {"$limit": 2}]`, Limits{MaxSortRows: 3})
+	require.NoError(t, err)
+	require.Equal(t, []string{pipelineDocs[4], pipelineDocs[3]}, output)
+}
+
+func TestUnmarshalPipeline(t *testing.T) {
+	p, err := UnmarshalPipeline([]byte(`[{"$match": {"brand": "a"}}, {"$limit": 5}]`))
+	require.NoError(t, err)
+	require.Equal(t, `{"brand": "a"}`, string(p.Match))
+	require.Equal(t, []Stage{&LimitStage{Limit: 5}}, p.Stages)
+
+	cases := []struct {
+		pipeline string
+		err      error
+	}{
+		{`{"$limit": 5}`, api.Errorf(api.Code_INVALID_ARGUMENT, "pipeline needs an array of stages")},
+		{`[{"$limit": 5, "$sort": [{"a": "$asc"}]}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "a stage of the pipeline needs a single operator")},
+		{`[{"$limit": 5}, {"$match": {"a": 1}}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "$match is only supported as the first stage of the pipeline")},
+		{`[{"$unwind": "$a"}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported stage '$unwind'")},
+		{`[{"$group": {"count": {"$sum": 1}}}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "$group needs an '_id'")},
+		{`[{"$group": {"_id": "$a", "total": {"$add": [1, 2]}}}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "field 'total' of $group needs an accumulator")},
+		{`[{"$group": {"_id": {"$sum": "$a"}}}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "'$sum' can only be used in $group")},
+		{`[{"$project": {"a": 1, "b": 0}}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "$project can't keep and remove fields at the same time")},
+		{`[{"$sort": []}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "$sort needs at least one field")},
+		{`[{"$limit": 0}]`, api.Errorf(api.Code_INVALID_ARGUMENT, "$limit needs a positive integer")},
+	}
+	for _, c := range cases {
+		_, err = UnmarshalPipeline([]byte(c.pipeline))
+		require.Equal(t, c.err, err, c.pipeline)
+	}
+}
+
+func TestGroupCountField(t *testing.T) {
+	p, err := UnmarshalPipeline([]byte(`[{"$group": {"_id": "$brand", "count": {"$sum": 1}, "double": {"$sum": 2}}}]`))
+	require.NoError(t, err)
+	g := p.Stages[0].(*GroupStage)
+
+	field, ok := g.CountField()
+	require.True(t, ok)
+	require.Equal(t, "brand", field)
+
+	docs, err := g.CountedDocuments([]GroupCount{{Value: value.NewStringValue("a"), Count: 3}, {Count: 1}})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`{"_id":"a","count":3,"double":6}`), []byte(`{"_id":null,"count":1,"double":2}`)}, docs)
+
+	for _, notCount := range []string{
+		`[{"$group": {"_id": "$brand", "total": {"$sum": "$price"}}}]`,
+		`[{"$group": {"_id": {"b": "$brand"}, "count": {"$sum": 1}}}]`,
+		`[{"$group": {"_id": "brand", "count": {"$sum": 1}}}]`,
+	} {
+		p, err = UnmarshalPipeline([]byte(notCount))
+		require.NoError(t, err)
+		_, ok = p.Stages[0].(*GroupStage).CountField()
+		require.False(t, ok, notCount)
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	d := NewDistinct("info.color", 10)
+	for _, doc := range pipelineDocs {
+		require.NoError(t, d.Apply([]byte(doc)))
+	}
+	values, err := d.Values()
+	require.NoError(t, err)
+	// the document without the field is skipped
+	require.Equal(t, [][]byte{[]byte(`"blue"`), []byte(`"red"`)}, values)
+
+	d = NewDistinct("price", 10)
+	require.NoError(t, d.Add(value.NewStringValue("a")))
+	for _, doc := range pipelineDocs {
+		require.NoError(t, d.Apply([]byte(doc)))
+	}
+	values, err = d.Values()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`1`), []byte(`4`), []byte(`5.5`), []byte(`10`), []byte(`20`), []byte(`"a"`)}, values)
+
+	d = NewDistinct("id", 3)
+	var last error
+	for _, doc := range pipelineDocs {
+		if last = d.Apply([]byte(doc)); last != nil {
+			break
+		}
+	}
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "field 'id' has more than 3 distinct values"), last)
+}
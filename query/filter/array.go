@@ -0,0 +1,315 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+// ArrayMatcher is implemented by the array operators i.e. "$elemMatch", "$all" and "$size". These operators are
+// evaluated on the raw JSON array of the field instead of a value built from the field.
+type ArrayMatcher interface {
+	ValueMatcher
+
+	// MatchesArray returns true if the input JSON array satisfies the condition of the receiver.
+	MatchesArray(array []byte) bool
+}
+
+// SizeMatcher implements "$size" operand. It matches if the array has exactly the number of elements.
+type SizeMatcher struct {
+	Size int64
+}
+
+// NewSizeMatcher returns SizeMatcher object
+func NewSizeMatcher(size int64) *SizeMatcher {
+	return &SizeMatcher{
+		Size: size,
+	}
+}
+
+func (s *SizeMatcher) GetValue() value.Value {
+	return value.NewIntValue(s.Size)
+}
+
+// Matches is not used, the array is matched using MatchesArray.
+func (s *SizeMatcher) Matches(_ value.Value) bool {
+	return false
+}
+
+func (s *SizeMatcher) MatchesArray(array []byte) bool {
+	var size int64
+	if _, err := jsonparser.ArrayEach(array, func(_ []byte, _ jsonparser.ValueType, _ int, _ error) {
+		size++
+	}); err != nil {
+		return false
+	}
+
+	return size == s.Size
+}
+
+func (s *SizeMatcher) Type() string {
+	return SIZE
+}
+
+func (s *SizeMatcher) String() string {
+	return fmt.Sprintf("{$size:%v}", s.Size)
+}
+
+// AllMatcher implements "$all" operand. It matches if the array contains all the values, the order of the elements
+// in the array doesn't matter. It is only supported on the arrays of primitive types.
+type AllMatcher struct {
+	Values   *value.ArrayValue
+	ItemType schema.FieldType
+}
+
+// NewAllMatcher returns AllMatcher object
+func NewAllMatcher(values *value.ArrayValue, itemType schema.FieldType) *AllMatcher {
+	return &AllMatcher{
+		Values:   values,
+		ItemType: itemType,
+	}
+}
+
+func (a *AllMatcher) GetValue() value.Value {
+	return a.Values
+}
+
+// Matches is not used, the array is matched using MatchesArray.
+func (a *AllMatcher) Matches(_ value.Value) bool {
+	return false
+}
+
+func (a *AllMatcher) MatchesArray(array []byte) bool {
+	if len(*a.Values) == 0 {
+		// same as mongo, an empty "$all" doesn't match any document
+		return false
+	}
+
+	items := arrayItemValues(array, a.ItemType)
+	for _, v := range *a.Values {
+		found := false
+		for _, item := range items {
+			if res, err := v.CompareTo(item); err == nil && res == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *AllMatcher) Type() string {
+	return ALL
+}
+
+func (a *AllMatcher) String() string {
+	return fmt.Sprintf("{$all:%v}", a.Values)
+}
+
+// ElemMatchMatcher implements "$elemMatch" operand. It matches if at least one element of the array satisfies all the
+// conditions. For an array of objects the conditions are filters on the fields of the objects,
+//    {"items": {"$elemMatch": {"name": "foo", "qty": {"$gt": 5}}}}
+// and for an array of primitive types the conditions are the comparison operators applied on the elements,
+//    {"scores": {"$elemMatch": {"$gte": 80, "$lt": 90}}}
+type ElemMatchMatcher struct {
+	// Filter is set for an array of objects.
+	Filter *WrappedFilter
+	// Matchers are set for an array of primitive types.
+	Matchers []ValueMatcher
+	ItemType schema.FieldType
+}
+
+// NewElemMatchMatcher returns ElemMatchMatcher object for an array of primitive types.
+func NewElemMatchMatcher(matchers []ValueMatcher, itemType schema.FieldType) *ElemMatchMatcher {
+	return &ElemMatchMatcher{
+		Matchers: matchers,
+		ItemType: itemType,
+	}
+}
+
+// NewObjectElemMatchMatcher returns ElemMatchMatcher object for an array of objects.
+func NewObjectElemMatchMatcher(filter *WrappedFilter) *ElemMatchMatcher {
+	return &ElemMatchMatcher{
+		Filter: filter,
+	}
+}
+
+// GetValue returns nil, the matcher has conditions instead of a value.
+func (e *ElemMatchMatcher) GetValue() value.Value {
+	return nil
+}
+
+// Matches is not used, the array is matched using MatchesArray.
+func (e *ElemMatchMatcher) Matches(_ value.Value) bool {
+	return false
+}
+
+func (e *ElemMatchMatcher) MatchesArray(array []byte) bool {
+	matched := false
+	_, _ = jsonparser.ArrayEach(array, func(item []byte, dataType jsonparser.ValueType, _ int, _ error) {
+		if !matched {
+			matched = e.MatchesElement(item, dataType)
+		}
+	})
+
+	return matched
+}
+
+// MatchesElement returns true if a single element of the array satisfies all the conditions. The item is the value
+// returned by jsonparser i.e. the strings are without the quotes.
+func (e *ElemMatchMatcher) MatchesElement(item []byte, dataType jsonparser.ValueType) bool {
+	if dataType == jsonparser.Null {
+		return false
+	}
+
+	if e.Filter != nil {
+		return dataType == jsonparser.Object && e.Filter.Matches(item)
+	}
+
+	return e.matchesItem(item, dataType)
+}
+
+func (e *ElemMatchMatcher) matchesItem(item []byte, dataType jsonparser.ValueType) bool {
+	for _, m := range e.Matchers {
+		if a, ok := m.(ArrayMatcher); ok {
+			// array of arrays
+			if dataType != jsonparser.Array || !a.MatchesArray(item) {
+				return false
+			}
+			continue
+		}
+
+		v, err := newValue(e.ItemType, item, dataType)
+		if err != nil || !m.Matches(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *ElemMatchMatcher) Type() string {
+	return ELEMMATCH
+}
+
+func (e *ElemMatchMatcher) String() string {
+	if e.Filter != nil {
+		return fmt.Sprintf("{$elemMatch:%v}", e.Filter.filters)
+	}
+	return fmt.Sprintf("{$elemMatch:%v}", e.Matchers)
+}
+
+// BuildElemMatcher returns the matcher for the conditions on the elements of the array field, the conditions are the
+// same as the ones accepted by "$elemMatch". It is used to find the elements of an array outside the filters.
+func BuildElemMatcher(field *schema.Field, conditions jsoniter.RawMessage) (*ElemMatchMatcher, error) {
+	m, err := buildArrayMatcher(ELEMMATCH, conditions, jsonparser.Object, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.(*ElemMatchMatcher), nil
+}
+
+// arrayItemValues returns the values of the primitive elements of the array, the elements that can't be converted to
+// the item type are skipped.
+func arrayItemValues(array []byte, itemType schema.FieldType) []value.Value {
+	var values []value.Value
+	_, _ = jsonparser.ArrayEach(array, func(item []byte, dataType jsonparser.ValueType, _ int, _ error) {
+		switch dataType {
+		case jsonparser.Boolean, jsonparser.Number, jsonparser.String:
+			if v, err := newValue(itemType, item, dataType); err == nil {
+				values = append(values, v)
+			}
+		}
+	})
+
+	return values
+}
+
+// buildArrayMatcher returns the matcher for the array operators, the field must be an array.
+func buildArrayMatcher(op string, input jsoniter.RawMessage, dataType jsonparser.ValueType, field *schema.Field) (ValueMatcher, error) {
+	if field.Type() != schema.ArrayType {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is only supported on array fields, found '%s'", op, field.FieldName)
+	}
+
+	item := arrayItemField(field)
+	switch op {
+	case SIZE:
+		size, err := strconv.ParseInt(string(input), 10, 64)
+		if dataType != jsonparser.Number || err != nil || size < 0 {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs a non-negative integer", op)
+		}
+		return NewSizeMatcher(size), nil
+	case ALL:
+		if dataType != jsonparser.Array {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of values", op)
+		}
+		if item == nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not supported on array of objects '%s'", op, field.FieldName)
+		}
+
+		values, err := buildArrayValues(input, item)
+		if err != nil {
+			return nil, err
+		}
+		return NewAllMatcher(value.NewArrayValue(values), item.Type()), nil
+	case ELEMMATCH:
+		if dataType != jsonparser.Object {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with conditions", op)
+		}
+		if item != nil {
+			matchers, err := buildComparisonOperator(input, item)
+			if err != nil {
+				return nil, err
+			}
+			return NewElemMatchMatcher(matchers, item.Type()), nil
+		}
+
+		filters, err := NewFactory(field.Fields).Factorize(input)
+		if err != nil {
+			return nil, err
+		}
+		if len(filters) == 0 {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "empty object")
+		}
+		return NewObjectElemMatchMatcher(NewWrappedFilter(filters)), nil
+	default:
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported operand '%s'", op)
+	}
+}
+
+// arrayItemField returns the field of the items for an array of primitive types, nil for an array of objects. The
+// returned field has the name of the array so that the errors refer to the array field.
+func arrayItemField(field *schema.Field) *schema.Field {
+	item := field.ItemField()
+	if item == nil {
+		return nil
+	}
+
+	named := *item
+	named.FieldName = field.FieldName
+	return &named
+}
@@ -27,11 +27,22 @@ const (
 	LT  = "$lt"
 	GTE = "$gte"
 	LTE = "$lte"
+	IN  = "$in"
+	NIN = "$nin"
+	NE  = "$ne"
+	NOT = "$not"
+
+	EXISTS = "$exists"
+
+	ELEMMATCH = "$elemMatch"
+	ALL       = "$all"
+	SIZE      = "$size"
 )
 
 // ValueMatcher is an interface that has method like Matches.
 type ValueMatcher interface {
-	// Matches returns true if the receiver has the value object that has the same value as input
+	// Matches returns true if the input i.e. the value of the field in the document satisfies the condition of the
+	// receiver. For example, GreaterThanMatcher with value 10 matches all the inputs that are greater than 10.
 	Matches(input value.Value) bool
 
 	// Type return the type of the value matcher, syntactic sugar for logging, etc
@@ -64,6 +75,25 @@ func NewMatcher(key string, v value.Value) (ValueMatcher, error) {
 		return &LessThanEqMatcher{
 			Value: v,
 		}, nil
+	case NE:
+		return &NotEqualMatcher{
+			Value: v,
+		}, nil
+	case EXISTS:
+		exists, ok := v.(*value.BoolValue)
+		if !ok {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs a boolean value", key)
+		}
+		return NewExistsMatcher(bool(*exists)), nil
+	case IN, NIN:
+		values, ok := v.(*value.ArrayValue)
+		if !ok {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of values", key)
+		}
+		if key == IN {
+			return NewInMatcher(values), nil
+		}
+		return NewNotInMatcher(values), nil
 	default:
 		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported operand '%s'", key)
 	}
@@ -86,7 +116,11 @@ func (e *EqualityMatcher) GetValue() value.Value {
 }
 
 func (e *EqualityMatcher) Matches(input value.Value) bool {
-	res, _ := e.Value.CompareTo(input)
+	res, err := e.Value.CompareTo(input)
+	if err != nil {
+		return false
+	}
+
 	return res == 0
 }
 
@@ -114,8 +148,12 @@ func (g *GreaterThanMatcher) GetValue() value.Value {
 }
 
 func (g *GreaterThanMatcher) Matches(input value.Value) bool {
-	res, _ := g.Value.CompareTo(input)
-	return res > 0
+	res, err := g.Value.CompareTo(input)
+	if err != nil {
+		return false
+	}
+
+	return res < 0
 }
 
 func (g *GreaterThanMatcher) Type() string {
@@ -136,8 +174,12 @@ func (g *GreaterThanEqMatcher) GetValue() value.Value {
 }
 
 func (g *GreaterThanEqMatcher) Matches(input value.Value) bool {
-	res, _ := g.Value.CompareTo(input)
-	return res >= 0
+	res, err := g.Value.CompareTo(input)
+	if err != nil {
+		return false
+	}
+
+	return res <= 0
 }
 
 func (g *GreaterThanEqMatcher) Type() string {
@@ -158,8 +200,12 @@ func (l *LessThanMatcher) GetValue() value.Value {
 }
 
 func (l *LessThanMatcher) Matches(input value.Value) bool {
-	res, _ := l.Value.CompareTo(input)
-	return res < 0
+	res, err := l.Value.CompareTo(input)
+	if err != nil {
+		return false
+	}
+
+	return res > 0
 }
 
 func (l *LessThanMatcher) Type() string {
@@ -180,8 +226,12 @@ func (l *LessThanEqMatcher) GetValue() value.Value {
 }
 
 func (l *LessThanEqMatcher) Matches(input value.Value) bool {
-	res, _ := l.Value.CompareTo(input)
-	return res <= 0
+	res, err := l.Value.CompareTo(input)
+	if err != nil {
+		return false
+	}
+
+	return res >= 0
 }
 
 func (l *LessThanEqMatcher) Type() string {
@@ -191,3 +241,207 @@ func (l *LessThanEqMatcher) Type() string {
 func (l *LessThanEqMatcher) String() string {
 	return fmt.Sprintf("{$lte:%v}", l.Value)
 }
+
+// InMatcher implements "$in" operand. It matches if the input is equal to any of the values.
+type InMatcher struct {
+	Values *value.ArrayValue
+}
+
+// NewInMatcher returns InMatcher object
+func NewInMatcher(values *value.ArrayValue) *InMatcher {
+	return &InMatcher{
+		Values: values,
+	}
+}
+
+func (i *InMatcher) GetValue() value.Value {
+	return i.Values
+}
+
+func (i *InMatcher) Matches(input value.Value) bool {
+	for _, v := range *i.Values {
+		if res, err := v.CompareTo(input); err == nil && res == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i *InMatcher) Type() string {
+	return "$in"
+}
+
+func (i *InMatcher) String() string {
+	return fmt.Sprintf("{$in:%v}", i.Values)
+}
+
+// NotInMatcher implements "$nin" operand. It matches if the input is not equal to any of the values.
+type NotInMatcher struct {
+	Values *value.ArrayValue
+}
+
+// NewNotInMatcher returns NotInMatcher object
+func NewNotInMatcher(values *value.ArrayValue) *NotInMatcher {
+	return &NotInMatcher{
+		Values: values,
+	}
+}
+
+func (n *NotInMatcher) GetValue() value.Value {
+	return n.Values
+}
+
+func (n *NotInMatcher) Matches(input value.Value) bool {
+	for _, v := range *n.Values {
+		if res, err := v.CompareTo(input); err == nil && res == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (n *NotInMatcher) Type() string {
+	return "$nin"
+}
+
+func (n *NotInMatcher) String() string {
+	return fmt.Sprintf("{$nin:%v}", n.Values)
+}
+
+// NotEqualMatcher implements "$ne" operand. It matches if the input is not equal to the value, a document that doesn't
+// have the field also matches.
+type NotEqualMatcher struct {
+	Value value.Value
+}
+
+// NewNotEqualMatcher returns NotEqualMatcher object
+func NewNotEqualMatcher(v value.Value) *NotEqualMatcher {
+	return &NotEqualMatcher{
+		Value: v,
+	}
+}
+
+func (n *NotEqualMatcher) GetValue() value.Value {
+	return n.Value
+}
+
+func (n *NotEqualMatcher) Matches(input value.Value) bool {
+	res, err := n.Value.CompareTo(input)
+	if err != nil {
+		// values of different types are never equal
+		return true
+	}
+
+	return res != 0
+}
+
+func (n *NotEqualMatcher) Type() string {
+	return "$ne"
+}
+
+func (n *NotEqualMatcher) String() string {
+	return fmt.Sprintf("{$ne:%v}", n.Value)
+}
+
+// NotMatcher implements "$not" operand. It wraps the comparison operators and matches if the input doesn't satisfy
+// them, for example {"f": {"$not": {"$gt": 10}}}. If there are multiple operators then they are joined using "$and"
+// before negating them. A document that doesn't have the field matches if the wrapped operators don't match it.
+type NotMatcher struct {
+	Matchers []ValueMatcher
+}
+
+// NewNotMatcher returns NotMatcher object
+func NewNotMatcher(matchers []ValueMatcher) *NotMatcher {
+	return &NotMatcher{
+		Matchers: matchers,
+	}
+}
+
+// GetValue returns the value of the wrapped operator, nil if there is more than one wrapped operator.
+func (n *NotMatcher) GetValue() value.Value {
+	if len(n.Matchers) != 1 {
+		return nil
+	}
+
+	return n.Matchers[0].GetValue()
+}
+
+func (n *NotMatcher) Matches(input value.Value) bool {
+	for _, m := range n.Matchers {
+		if !m.Matches(input) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *NotMatcher) Type() string {
+	return "$not"
+}
+
+func (n *NotMatcher) String() string {
+	return fmt.Sprintf("{$not:%v}", n.Matchers)
+}
+
+// ExistsMatcher implements "$exists" operand. As null fields are not stored, a field with null value is same as the
+// field not present in the document. The matcher is not using the value of the field.
+type ExistsMatcher struct {
+	Exists bool
+}
+
+// NewExistsMatcher returns ExistsMatcher object
+func NewExistsMatcher(exists bool) *ExistsMatcher {
+	return &ExistsMatcher{
+		Exists: exists,
+	}
+}
+
+func (e *ExistsMatcher) GetValue() value.Value {
+	return value.NewBoolValue(e.Exists)
+}
+
+// Matches is called only when the field is present in the document.
+func (e *ExistsMatcher) Matches(_ value.Value) bool {
+	return e.Exists
+}
+
+func (e *ExistsMatcher) Type() string {
+	return "$exists"
+}
+
+func (e *ExistsMatcher) String() string {
+	return fmt.Sprintf("{$exists:%v}", e.Exists)
+}
+
+// isNegation returns true if the matcher is a negation of a condition. A negation on multiple values of a field
+// matches only if all the values match it.
+func isNegation(m ValueMatcher) bool {
+	switch m.(type) {
+	case *NotEqualMatcher, *NotInMatcher, *NotMatcher:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchesMissing returns true if a document that doesn't have the field (or has it as null) satisfies the matcher.
+func matchesMissing(m ValueMatcher) bool {
+	switch t := m.(type) {
+	case *NotEqualMatcher, *NotInMatcher:
+		return true
+	case *ExistsMatcher:
+		return !t.Exists
+	case *NotMatcher:
+		for _, inner := range t.Matchers {
+			if !matchesMissing(inner) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
@@ -33,3 +33,49 @@ func TestNewMatcher(t *testing.T) {
 	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported operand 'foo'"), err)
 	require.Nil(t, matcher)
 }
+
+func TestMatcherMatches(t *testing.T) {
+	cases := []struct {
+		op       string
+		input    value.Value
+		expMatch bool
+	}{
+		{EQ, value.NewIntValue(10), true},
+		{EQ, value.NewIntValue(11), false},
+		{GT, value.NewIntValue(11), true},
+		{GT, value.NewIntValue(10), false},
+		{GTE, value.NewIntValue(10), true},
+		{GTE, value.NewIntValue(9), false},
+		{LT, value.NewIntValue(9), true},
+		{LT, value.NewIntValue(10), false},
+		{LTE, value.NewIntValue(10), true},
+		{LTE, value.NewIntValue(11), false},
+		// different types never match
+		{EQ, value.NewStringValue("10"), false},
+		{LT, value.NewStringValue("10"), false},
+	}
+	for _, c := range cases {
+		matcher, err := NewMatcher(c.op, value.NewIntValue(10))
+		require.NoError(t, err)
+		require.Equal(t, c.expMatch, matcher.Matches(c.input), "%s %v", c.op, c.input)
+	}
+}
+
+func TestInMatcherMatches(t *testing.T) {
+	values := value.NewArrayValue([]value.Value{value.NewIntValue(1), value.NewIntValue(2)})
+
+	in, err := NewMatcher(IN, values)
+	require.NoError(t, err)
+	require.True(t, in.Matches(value.NewIntValue(1)))
+	require.True(t, in.Matches(value.NewIntValue(2)))
+	require.False(t, in.Matches(value.NewIntValue(3)))
+	require.False(t, in.Matches(value.NewStringValue("1")))
+
+	nin, err := NewMatcher(NIN, values)
+	require.NoError(t, err)
+	require.False(t, nin.Matches(value.NewIntValue(1)))
+	require.True(t, nin.Matches(value.NewIntValue(3)))
+
+	_, err = NewMatcher(IN, value.NewIntValue(1))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "'$in' needs an array of values"), err)
+}
@@ -16,6 +16,7 @@ package filter
 
 import (
 	"bytes"
+	"math"
 
 	"github.com/buger/jsonparser"
 	jsoniter "github.com/json-iterator/go"
@@ -46,7 +47,59 @@ var (
 type Filter interface {
 	// Matches returns true if the input doc passes the filter, otherwise false
 	Matches(doc []byte) bool
-	ToSearchFilter() string
+}
+
+// WrappedFilter wraps the top level filters returned by the Factory. The top level filters are implicitly joined using
+// "$and", so a document matches the wrapped filter only if it matches all of them. An empty filter matches all the
+// documents.
+type WrappedFilter struct {
+	filters []Filter
+}
+
+// NewWrappedFilter returns WrappedFilter for the filters returned by Factorize.
+func NewWrappedFilter(filters []Filter) *WrappedFilter {
+	return &WrappedFilter{
+		filters: filters,
+	}
+}
+
+// Matches returns true if the input doc passes all the filters.
+func (w *WrappedFilter) Matches(doc []byte) bool {
+	for _, f := range w.filters {
+		if !f.Matches(doc) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// None returns true if there is no filter to apply.
+func (w *WrappedFilter) None() bool {
+	return len(w.filters) == 0
+}
+
+// EqualitySelectors returns the selectors that are only matching a single value of a field i.e. {"f1": 10} or
+// {"f1": {"$eq": 10}}. The selectors nested in "$and" are also returned but the ones nested in "$or" are skipped as
+// the field can have any of the values.
+func EqualitySelectors(filters []Filter) []*Selector {
+	var selectors []*Selector
+	for _, f := range filters {
+		switch ty := f.(type) {
+		case *Selector:
+			if _, ok := ty.Matcher.(*EqualityMatcher); ok {
+				selectors = append(selectors, ty)
+			}
+		case *AndFilter:
+			selectors = append(selectors, EqualitySelectors(ty.GetFilters())...)
+		}
+	}
+
+	return selectors
+}
+
+func isLogicalOP(k []byte) bool {
+	return string(k) == string(AndOP) || string(k) == string(OrOP)
 }
 
 func IsFullCollectionScan(reqFilter []byte) bool {
@@ -92,7 +145,13 @@ func (factory *Factory) Factorize(reqFilter []byte) ([]Filter, error) {
 			return api.Errorf(api.Code_INVALID_ARGUMENT, "duplicate filter '%s'", string(k))
 		}
 		seen[string(k)] = struct{}{}
-		filters = append(filters, filter)
+		if and, ok := filter.(*AndFilter); ok && !isLogicalOP(k) {
+			// multiple comparison operators on a field, the top level filters are already joined using "$and" so
+			// these selectors can be used directly.
+			filters = append(filters, and.GetFilters()...)
+		} else {
+			filters = append(filters, filter)
+		}
 
 		return nil
 	})
@@ -167,42 +226,46 @@ func convertExprListToFilters(expr []expression.Expr) ([]Filter, error) {
 // ParseSelector is a short-circuit for Selector i.e. when we know the filter passed is not logical then we directly
 // call this because if it is not logical then it is simply a Selector filter.
 func (factory *Factory) ParseSelector(k []byte, v []byte, dataType jsonparser.ValueType) (Filter, error) {
-	var field *schema.Field
-	for _, f := range factory.fields {
-		if f.FieldName == string(k) {
-			field = f
-		}
-	}
+	// the key can be a path to a nested field i.e. "address.city"
+	field := schema.GetField(factory.fields, string(k))
 	if field == nil {
 		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "querying on non schema field '%s'", string(k))
 	}
 
 	switch dataType {
 	case jsonparser.Boolean, jsonparser.Number, jsonparser.String:
-		val, err := value.NewValue(field.DataType, v)
+		val, err := newValue(field.DataType, v, dataType)
 		if err != nil {
 			return nil, err
 		}
 
-		return NewSelector(string(k), NewEqualityMatcher(val)), nil
+		return NewSelector(string(k), field.DataType, NewEqualityMatcher(val)), nil
 	case jsonparser.Object:
-		valueMatcher, err := buildComparisonOperator(v, field)
+		valueMatchers, err := buildComparisonOperator(v, field)
 		if err != nil {
 			return nil, err
 		}
+		if len(valueMatchers) == 1 {
+			return NewSelector(string(k), field.DataType, valueMatchers[0]), nil
+		}
 
-		return NewSelector(string(k), valueMatcher), nil
+		// multiple operators on the same field i.e. {"f1": {"$gt": 10, "$lt": 20}} are joined using "$and"
+		var selectors []Filter
+		for _, m := range valueMatchers {
+			selectors = append(selectors, NewSelector(string(k), field.DataType, m))
+		}
+		return NewAndFilter(selectors)
 	default:
 		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "unable to parse the comparison operator")
 	}
 }
 
-func buildComparisonOperator(input jsoniter.RawMessage, field *schema.Field) (ValueMatcher, error) {
+func buildComparisonOperator(input jsoniter.RawMessage, field *schema.Field) ([]ValueMatcher, error) {
 	if len(input) == 0 {
 		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "empty object")
 	}
 
-	var valueMatcher ValueMatcher
+	var valueMatchers []ValueMatcher
 	var err error
 	err = jsonparser.ObjectEach(input, func(key []byte, v []byte, dataType jsonparser.ValueType, offset int) error {
 		if err != nil {
@@ -210,23 +273,151 @@ func buildComparisonOperator(input jsoniter.RawMessage, field *schema.Field) (Va
 		}
 
 		switch string(key) {
-		case EQ, GT, GTE, LT, LTE:
+		case EQ, NE, GT, GTE, LT, LTE:
 			switch dataType {
 			case jsonparser.Boolean, jsonparser.Number, jsonparser.String, jsonparser.Null:
 				var val value.Value
-				val, err = value.NewValue(field.DataType, v)
+				val, err = newValue(field.DataType, v, dataType)
 				if err != nil {
 					return err
 				}
 
-				valueMatcher, err = NewMatcher(string(key), val)
+				op, val := integerBound(field.DataType, string(key), val)
+				var valueMatcher ValueMatcher
+				if valueMatcher, err = NewMatcher(op, val); err != nil {
+					return err
+				}
+				valueMatchers = append(valueMatchers, valueMatcher)
+				return nil
+			}
+		case EXISTS:
+			if dataType != jsonparser.Boolean {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs a boolean value", string(key))
+			}
+
+			var valueMatcher ValueMatcher
+			if valueMatcher, err = NewMatcher(string(key), value.NewBoolValue(string(v) == "true")); err != nil {
+				return err
+			}
+			valueMatchers = append(valueMatchers, valueMatcher)
+			return nil
+		case NOT:
+			if dataType != jsonparser.Object {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with comparison operators", string(key))
+			}
+
+			var inner []ValueMatcher
+			if inner, err = buildComparisonOperator(v, field); err != nil {
+				return err
+			}
+			for _, m := range inner {
+				if _, ok := m.(ArrayMatcher); ok {
+					return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not supported with '%s'", string(key), m.Type())
+				}
+			}
+			valueMatchers = append(valueMatchers, negate(inner))
+			return nil
+		case IN, NIN:
+			if dataType != jsonparser.Array {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of values", string(key))
+			}
+
+			var values []value.Value
+			if values, err = buildArrayValues(v, field); err != nil {
+				return err
+			}
+
+			var valueMatcher ValueMatcher
+			if valueMatcher, err = NewMatcher(string(key), value.NewArrayValue(values)); err != nil {
 				return err
 			}
+			valueMatchers = append(valueMatchers, valueMatcher)
+			return nil
+		case ELEMMATCH, ALL, SIZE:
+			var valueMatcher ValueMatcher
+			if valueMatcher, err = buildArrayMatcher(string(key), v, dataType, field); err != nil {
+				return err
+			}
+			valueMatchers = append(valueMatchers, valueMatcher)
+			return nil
 		default:
 			return api.Errorf(api.Code_INVALID_ARGUMENT, "expression is not supported inside comparison operator %s", string(key))
 		}
 		return nil
 	})
 
-	return valueMatcher, err
+	if err == nil && len(valueMatchers) == 0 {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "empty object")
+	}
+
+	return valueMatchers, err
+}
+
+// buildArrayValues returns the values of the elements of the input array, the elements are converted using the type of
+// the field.
+func buildArrayValues(input jsoniter.RawMessage, field *schema.Field) ([]value.Value, error) {
+	var values = make([]value.Value, 0)
+	var err error
+	_, arrErr := jsonparser.ArrayEach(input, func(item []byte, dataType jsonparser.ValueType, offset int, _ error) {
+		if err != nil {
+			return
+		}
+
+		switch dataType {
+		case jsonparser.Boolean, jsonparser.Number, jsonparser.String:
+			var val value.Value
+			if val, err = newValue(field.DataType, item, dataType); err != nil {
+				return
+			}
+			values = append(values, val)
+		default:
+			err = api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported value in the array for field '%s'", field.FieldName)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if arrErr != nil {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, arrErr.Error())
+	}
+
+	return values, nil
+}
+
+// integerBound converts a double bound of a range on an integer field to the equivalent integer bound i.e.
+// {"$gt": 10.5} is same as {"$gte": 11}. This way the key builder and search can use the bound as it is. The bounds
+// that are out of the range of int64 are returned as it is.
+func integerBound(fieldType schema.FieldType, op string, v value.Value) (string, value.Value) {
+	d, ok := v.(*value.DoubleValue)
+	if !ok || (fieldType != schema.Int32Type && fieldType != schema.Int64Type) {
+		return op, v
+	}
+
+	var intOp string
+	var bound float64
+	switch op {
+	case GT, GTE:
+		intOp, bound = GTE, math.Ceil(float64(*d))
+	case LT, LTE:
+		intOp, bound = LTE, math.Floor(float64(*d))
+	default:
+		return op, v
+	}
+	if bound < math.MinInt64 || bound >= -math.MinInt64 {
+		return op, v
+	}
+
+	return intOp, value.NewIntValue(int64(bound))
+}
+
+// negate returns the matcher that is negation of the matchers. Negation of "$exists" is simply flipping it so that
+// it doesn't need the value of the field.
+func negate(matchers []ValueMatcher) ValueMatcher {
+	if len(matchers) == 1 {
+		if e, ok := matchers[0].(*ExistsMatcher); ok {
+			return NewExistsMatcher(!e.Exists)
+		}
+	}
+
+	return NewNotMatcher(matchers)
 }
@@ -18,7 +18,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
 )
 
 func TestFilterUsingJSON(t *testing.T) {
@@ -128,3 +130,340 @@ func TestFilterDuplicateKey(t *testing.T) {
 	require.Nil(t, filters)
 	require.Contains(t, err.Error(), "duplicate filter 'b'")
 }
+
+func TestFilterMultipleOperators(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "a", DataType: schema.Int64Type},
+			{FieldName: "b", DataType: schema.Int64Type},
+		},
+	}
+	filters, err := factory.Factorize([]byte(`{"a": {"$gt": 10, "$lte": 20}, "b": 5}`))
+	require.NoError(t, err)
+	require.Len(t, filters, 3)
+	require.Equal(t, GT, filters[0].(*Selector).Matcher.Type())
+	require.Equal(t, LTE, filters[1].(*Selector).Matcher.Type())
+
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"a": 20, "b": 5}`)))
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"a": 21, "b": 5}`)))
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"a": 10, "b": 5}`)))
+
+	filters, err = factory.Factorize([]byte(`{"$or": [{"a": {"$lt": 0, "$gt": -5}}, {"b": 5}]}`))
+	require.NoError(t, err)
+	require.Len(t, filters, 1)
+	require.Len(t, filters[0].(*OrFilter).filter[0].(*AndFilter).filter, 2)
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"a": -1, "b": 1}`)))
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"a": -5, "b": 1}`)))
+}
+
+func TestFilterMatches(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "a", DataType: schema.Int64Type},
+			{FieldName: "b", DataType: schema.StringType},
+			{FieldName: "c", DataType: schema.DoubleType},
+			{FieldName: "d", DataType: schema.BoolType},
+		},
+	}
+	doc := []byte(`{"a": 10, "b": "foo", "c": 1.5, "d": true}`)
+
+	cases := []struct {
+		userInput []byte
+		expMatch  bool
+	}{
+		{[]byte(`{"a": 10}`), true},
+		{[]byte(`{"a": 11}`), false},
+		{[]byte(`{"a": {"$gt": 5}}`), true},
+		{[]byte(`{"a": {"$gt": 10}}`), false},
+		{[]byte(`{"a": {"$gte": 10}}`), true},
+		{[]byte(`{"a": {"$lt": 10}}`), false},
+		{[]byte(`{"a": {"$lte": 10}}`), true},
+		{[]byte(`{"b": "foo", "d": true}`), true},
+		{[]byte(`{"b": "foo", "d": false}`), false},
+		{[]byte(`{"c": {"$lt": 2.5}}`), true},
+		{[]byte(`{"$or": [{"a": 1}, {"b": "foo"}]}`), true},
+		{[]byte(`{"$or": [{"a": 1}, {"b": "bar"}]}`), false},
+		{[]byte(`{"$and": [{"a": {"$gt": 1}}, {"$or": [{"b": "bar"}, {"c": 1.5}]}]}`), true},
+		{[]byte(`{"$and": [{"a": {"$gt": 1}}, {"$or": [{"b": "bar"}, {"c": 2.5}]}]}`), false},
+		{[]byte(`{"a": {"$in": [1, 10]}}`), true},
+		{[]byte(`{"a": {"$in": []}}`), false},
+		{[]byte(`{"b": {"$in": ["bar", "baz"]}}`), false},
+		{[]byte(`{"b": {"$nin": ["bar", "baz"]}}`), true},
+		{[]byte(`{"a": {"$nin": [1, 10]}}`), false},
+		{[]byte(`{"a": {"$ne": 10}}`), false},
+		{[]byte(`{"a": {"$ne": 11}}`), true},
+		{[]byte(`{"a": {"$not": {"$gt": 10}}}`), true},
+		{[]byte(`{"a": {"$not": {"$gte": 10}}}`), false},
+		{[]byte(`{"a": {"$not": {"$gt": 5, "$lt": 20}}}`), false},
+		{[]byte(`{"a": {"$not": {"$gt": 5, "$lt": 10}}}`), true},
+		{[]byte(`{"b": {"$not": {"$in": ["foo"]}}}`), false},
+		{[]byte(`{"a": {"$exists": true}}`), true},
+		{[]byte(`{"a": {"$exists": false}}`), false},
+		{[]byte(`{"a": {"$not": {"$exists": true}}}`), false},
+	}
+	for _, c := range cases {
+		filters, err := factory.Factorize(c.userInput)
+		require.NoError(t, err)
+		require.Equal(t, c.expMatch, NewWrappedFilter(filters).Matches(doc), string(c.userInput))
+	}
+
+	// missing or null fields never match
+	filters, err := factory.Factorize([]byte(`{"a": 10}`))
+	require.NoError(t, err)
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"b": "foo"}`)))
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"a": null}`)))
+
+	// missing field is not in any list
+	filters, err = factory.Factorize([]byte(`{"a": {"$nin": [10]}}`))
+	require.NoError(t, err)
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"b": "foo"}`)))
+
+	// negations match the documents that don't have the field
+	for _, input := range []string{`{"a": {"$ne": 10}}`, `{"a": {"$not": {"$eq": 10}}}`, `{"a": {"$exists": false}}`, `{"a": {"$not": {"$exists": true}}}`} {
+		filters, err = factory.Factorize([]byte(input))
+		require.NoError(t, err)
+		require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"b": "foo"}`)), input)
+		require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"a": null}`)), input)
+	}
+	filters, err = factory.Factorize([]byte(`{"a": {"$not": {"$ne": 10}}}`))
+	require.NoError(t, err)
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"b": "foo"}`)))
+	filters, err = factory.Factorize([]byte(`{"a": {"$exists": true}}`))
+	require.NoError(t, err)
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"b": "foo"}`)))
+
+	_, err = factory.Factorize([]byte(`{"a": {"$exists": 1}}`))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "'$exists' needs a boolean value"), err)
+	_, err = factory.Factorize([]byte(`{"a": {"$not": 1}}`))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "'$not' needs an object with comparison operators"), err)
+
+	// in needs an array of values with the type of the field
+	_, err = factory.Factorize([]byte(`{"a": {"$in": 10}}`))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "'$in' needs an array of values"), err)
+	_, err = factory.Factorize([]byte(`{"a": {"$in": [{"b": 1}]}}`))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported value in the array for field 'a'"), err)
+
+	// the strings are compared unescaped
+	filters, err = factory.Factorize([]byte(`{"b": "a\"b\u0041"}`))
+	require.NoError(t, err)
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"b": "a\u0022bA"}`)))
+
+	// a value that doesn't have the type of the field doesn't match
+	filters, err = factory.Factorize([]byte(`{"a": 10}`))
+	require.NoError(t, err)
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"a": "ten"}`)))
+
+	// but it is not equal to any value
+	for _, input := range []string{`{"a": {"$ne": 10}}`, `{"a": {"$nin": [10, 11]}}`, `{"a": {"$not": {"$eq": 10}}}`, `{"a": {"$not": {"$gt": 5}}}`} {
+		filters, err = factory.Factorize([]byte(input))
+		require.NoError(t, err)
+		require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"a": "ten"}`)), input)
+	}
+	filters, err = factory.Factorize([]byte(`{"a": {"$not": {"$ne": 10}}}`))
+	require.NoError(t, err)
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"a": "ten"}`)))
+
+	// empty filter matches everything
+	require.True(t, NewWrappedFilter(nil).Matches(doc))
+	require.True(t, NewWrappedFilter(nil).None())
+}
+
+func TestFilterNestedFields(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "id", DataType: schema.Int64Type},
+			{FieldName: "address", DataType: schema.ObjectType, Fields: []*schema.Field{
+				{FieldName: "city", DataType: schema.StringType},
+				{FieldName: "geo", DataType: schema.ObjectType, Fields: []*schema.Field{
+					{FieldName: "lat", DataType: schema.DoubleType},
+				}},
+			}},
+			{FieldName: "items", DataType: schema.ArrayType, Fields: []*schema.Field{
+				{FieldName: "name", DataType: schema.StringType},
+				{FieldName: "quantity", DataType: schema.Int64Type},
+			}},
+		},
+	}
+	doc := []byte(`{"id": 1, "address": {"city": "sf", "geo": {"lat": 37.7}}, "items": [{"name": "shoe", "quantity": 2}, {"name": "sock", "quantity": 5}]}`)
+
+	cases := []struct {
+		userInput []byte
+		expMatch  bool
+	}{
+		{[]byte(`{"address.city": "sf"}`), true},
+		{[]byte(`{"address.city": "nyc"}`), false},
+		{[]byte(`{"address.geo.lat": {"$gt": 37.5}}`), true},
+		{[]byte(`{"address.city": "sf", "address.geo.lat": {"$lt": 37.5}}`), false},
+		{[]byte(`{"$or": [{"address.city": "nyc"}, {"id": 1}]}`), true},
+		{[]byte(`{"items.name": "sock"}`), true},
+		{[]byte(`{"items.name": "hat"}`), false},
+		{[]byte(`{"items.quantity": {"$gt": 4}}`), true},
+		{[]byte(`{"items.name": {"$ne": "sock"}}`), false},
+		{[]byte(`{"items.name": {"$nin": ["hat", "cap"]}}`), true},
+	}
+	for _, c := range cases {
+		filters, err := factory.Factorize(c.userInput)
+		require.NoError(t, err, string(c.userInput))
+		require.Equal(t, c.expMatch, NewWrappedFilter(filters).Matches(doc), string(c.userInput))
+	}
+
+	_, err := factory.Factorize([]byte(`{"address.zip": 1}`))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "querying on non schema field 'address.zip'"), err)
+
+	filters, err := factory.Factorize([]byte(`{"address.city": {"$exists": false}}`))
+	require.NoError(t, err)
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"id": 1, "address": {"geo": {"lat": 37.7}}}`)))
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"id": 1}`)))
+}
+
+func TestFilterArrayOperators(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "id", DataType: schema.Int64Type},
+			{FieldName: "tags", DataType: schema.ArrayType, Fields: []*schema.Field{
+				{DataType: schema.StringType},
+			}},
+			{FieldName: "scores", DataType: schema.ArrayType, Fields: []*schema.Field{
+				{DataType: schema.Int64Type},
+			}},
+			{FieldName: "items", DataType: schema.ArrayType, Fields: []*schema.Field{
+				{FieldName: "name", DataType: schema.StringType},
+				{FieldName: "quantity", DataType: schema.Int64Type},
+			}},
+		},
+	}
+	doc := []byte(`{"id": 1, "tags": ["red", "blue"], "scores": [75, 95], "items": [{"name": "shoe", "quantity": 2}, {"name": "sock", "quantity": 5}]}`)
+
+	cases := []struct {
+		userInput []byte
+		expMatch  bool
+	}{
+		{[]byte(`{"tags": {"$size": 2}}`), true},
+		{[]byte(`{"tags": {"$size": 3}}`), false},
+		{[]byte(`{"tags": {"$all": ["blue", "red"]}}`), true},
+		{[]byte(`{"tags": {"$all": ["blue", "green"]}}`), false},
+		{[]byte(`{"tags": {"$all": []}}`), false},
+		{[]byte(`{"scores": {"$elemMatch": {"$gte": 80, "$lt": 90}}}`), false},
+		{[]byte(`{"scores": {"$elemMatch": {"$gte": 90, "$lt": 100}}}`), true},
+		{[]byte(`{"scores": {"$elemMatch": {"$in": [1, 95]}}}`), true},
+		{[]byte(`{"items": {"$elemMatch": {"name": "shoe", "quantity": {"$gt": 4}}}}`), false},
+		{[]byte(`{"items": {"$elemMatch": {"name": "sock", "quantity": {"$gt": 4}}}}`), true},
+		{[]byte(`{"items": {"$elemMatch": {"$or": [{"name": "hat"}, {"quantity": 2}]}}}`), true},
+		{[]byte(`{"items": {"$size": 2}, "tags": {"$all": ["red"]}}`), true},
+		{[]byte(`{"$or": [{"tags": {"$size": 0}}, {"id": 2}]}`), false},
+	}
+	for _, c := range cases {
+		filters, err := factory.Factorize(c.userInput)
+		require.NoError(t, err, string(c.userInput))
+		require.Equal(t, c.expMatch, NewWrappedFilter(filters).Matches(doc), string(c.userInput))
+	}
+
+	// a document without the array field doesn't match
+	filters, err := factory.Factorize([]byte(`{"tags": {"$size": 0}}`))
+	require.NoError(t, err)
+	require.False(t, NewWrappedFilter(filters).Matches([]byte(`{"id": 1}`)))
+	require.True(t, NewWrappedFilter(filters).Matches([]byte(`{"id": 1, "tags": []}`)))
+
+	errCases := []struct {
+		userInput []byte
+		expErr    error
+	}{
+		{[]byte(`{"id": {"$size": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$size' is only supported on array fields, found 'id'")},
+		{[]byte(`{"tags": {"$size": -1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$size' needs a non-negative integer")},
+		{[]byte(`{"tags": {"$all": "red"}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$all' needs an array of values")},
+		{[]byte(`{"items": {"$all": ["shoe"]}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$all' is not supported on array of objects 'items'")},
+		{[]byte(`{"items": {"$elemMatch": {"color": "red"}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "querying on non schema field 'color'")},
+		{[]byte(`{"tags": {"$not": {"$size": 1}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$not' is not supported with '$size'")},
+	}
+	for _, c := range errCases {
+		_, err := factory.Factorize(c.userInput)
+		require.Equal(t, c.expErr, err, string(c.userInput))
+	}
+}
+
+func TestFilterTypedValues(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "created", DataType: schema.DateTimeType},
+			{FieldName: "uid", DataType: schema.UUIDType},
+		},
+	}
+	doc := []byte(`{"created": "2022-01-01T10:00:00+05:00", "uid": "1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e"}`)
+
+	cases := []struct {
+		userInput []byte
+		expMatch  bool
+	}{
+		{[]byte(`{"created": "2022-01-01T10:00:00+05:00"}`), true},
+		{[]byte(`{"created": {"$gt": "2022-01-01T06:00:00Z"}}`), false},
+		{[]byte(`{"created": {"$lt": "2022-01-01T06:00:00+00:00"}}`), true},
+		{[]byte(`{"uid": "1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e"}`), true},
+		// the keys and the search index have the text, so the same time or UUID with a different text is not equal
+		{[]byte(`{"created": "2022-01-01T05:00:00Z"}`), false},
+		{[]byte(`{"created": {"$ne": "2022-01-01T05:00:00Z"}}`), true},
+		{[]byte(`{"uid": "1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E"}`), false},
+	}
+	for _, c := range cases {
+		filters, err := factory.Factorize(c.userInput)
+		require.NoError(t, err, string(c.userInput))
+		require.Equal(t, c.expMatch, NewWrappedFilter(filters).Matches(doc), string(c.userInput))
+	}
+}
+
+func TestFilterNumericCoercion(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "qty", DataType: schema.Int64Type},
+			{FieldName: "price", DataType: schema.DoubleType},
+		},
+	}
+	doc := []byte(`{"qty": 10, "price": 10}`)
+
+	cases := []struct {
+		userInput []byte
+		expMatch  bool
+	}{
+		{[]byte(`{"qty": {"$gt": 9.5}}`), true},
+		{[]byte(`{"qty": {"$gt": 10.5}}`), false},
+		{[]byte(`{"qty": {"$lt": 10.5}}`), true},
+		{[]byte(`{"qty": {"$lte": 9.99}}`), false},
+		{[]byte(`{"qty": 10.0}`), true},
+		{[]byte(`{"qty": 10.5}`), false},
+		{[]byte(`{"qty": {"$ne": 10.5}}`), true},
+		{[]byte(`{"qty": {"$lt": 1e20}}`), true},
+		{[]byte(`{"qty": {"$gt": -1e20}}`), true},
+		{[]byte(`{"price": {"$gt": 9}}`), true},
+		{[]byte(`{"price": 10}`), true},
+	}
+	for _, c := range cases {
+		filters, err := factory.Factorize(c.userInput)
+		require.NoError(t, err, string(c.userInput))
+		require.Equal(t, c.expMatch, NewWrappedFilter(filters).Matches(doc), string(c.userInput))
+	}
+
+	// the double bound on an integer field is converted to an integer bound
+	filters, err := factory.Factorize([]byte(`{"qty": {"$gt": 9.5}}`))
+	require.NoError(t, err)
+	require.Equal(t, NewSelector("qty", schema.Int64Type, &GreaterThanEqMatcher{Value: value.NewIntValue(10)}), filters[0])
+}
+
+func TestEqualitySelectors(t *testing.T) {
+	var factory = Factory{
+		fields: []*schema.Field{
+			{FieldName: "a", DataType: schema.Int64Type},
+			{FieldName: "b", DataType: schema.StringType},
+			{FieldName: "c", DataType: schema.Int64Type},
+		},
+	}
+
+	filters, err := factory.Factorize([]byte(`{"a": 1, "c": {"$gt": 1}, "$and": [{"b": {"$eq": "foo"}}, {"$or": [{"c": 2}, {"c": 3}]}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []*Selector{
+		NewSelector("a", schema.Int64Type, NewEqualityMatcher(value.NewIntValue(1))),
+		NewSelector("b", schema.StringType, NewEqualityMatcher(value.NewStringValue("foo"))),
+	}, EqualitySelectors(filters))
+
+	filters, err = factory.Factorize([]byte(`{"$or": [{"a": 1}, {"a": 2}]}`))
+	require.NoError(t, err)
+	require.Empty(t, EqualitySelectors(filters))
+}
@@ -15,20 +15,25 @@
 package filter
 
 import (
+	"reflect"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
 	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/keys"
 	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
 )
 
 // KeyBuilder is responsible for building internal Keys. A composer is caller by the builder to build the internal keys
-// based on the Composer logic.
-type KeyBuilder struct {
-	composer KeyComposer
+// based on the Composer logic. The type parameter is what the composer builds i.e. keys.Key or KeyRange.
+type KeyBuilder[T any] struct {
+	composer KeyComposer[T]
 }
 
 // NewKeyBuilder returns a KeyBuilder
-func NewKeyBuilder(composer KeyComposer) *KeyBuilder {
-	return &KeyBuilder{
+func NewKeyBuilder[T any](composer KeyComposer[T]) *KeyBuilder[T] {
+	return &KeyBuilder[T]{
 		composer: composer,
 	}
 }
@@ -37,10 +42,10 @@ func NewKeyBuilder(composer KeyComposer) *KeyBuilder {
 // and passed by the caller in this method. The build is doing a level by level traversal to build the internal Keys.
 // On each level multiple keys can be formed because the user can specify ranges. The builder is not deciding the logic
 // of key generation, the builder is simply traversing on the filters and calling compose where the logic resides.
-func (k *KeyBuilder) Build(filters []Filter, userDefinedKeys []*schema.Field) ([]keys.Key, error) {
+func (k *KeyBuilder[T]) Build(filters []Filter, userDefinedKeys []*schema.Field) ([]T, error) {
 	var queue []Filter
 	var singleLevel []*Selector
-	var allKeys []keys.Key
+	var allKeys []T
 	for _, f := range filters {
 		if ss, ok := f.(*Selector); ok {
 			singleLevel = append(singleLevel, ss)
@@ -85,14 +90,16 @@ func (k *KeyBuilder) Build(filters []Filter, userDefinedKeys []*schema.Field) ([
 }
 
 // KeyComposer needs to be implemented to have a custom Compose method with different constraints.
-type KeyComposer interface {
-	Compose(level []*Selector, userDefinedKeys []*schema.Field, parent LogicalOP) ([]keys.Key, error)
+type KeyComposer[T any] interface {
+	Compose(level []*Selector, userDefinedKeys []*schema.Field, parent LogicalOP) ([]T, error)
 }
 
 // StrictEqKeyComposer is to generate internal keys only if the condition is equality on the fields that are part of
 // the schema and all these fields are present in the filters. The following rules are applied for StrictEqKeyComposer
 //  - The userDefinedKeys(indexes defined in the schema) passed in parameter should be present in the filter
 //  - For AND filters it is possible to build internal keys for composite indexes, for OR it is not possible.
+//  - "$in" is treated as equality on any of its values, so it forms a key for each value. For composite indexes,
+//    keys are formed for all the combinations of the values.
 // So for OR filter an error is returned if it is used for indexes that are composite.
 type StrictEqKeyComposer struct {
 	// keyEncodingFunc returns encoded key from index parts
@@ -107,15 +114,15 @@ func NewStrictEqKeyComposer(keyEncodingFunc func(indexParts ...interface{}) (key
 
 // Compose is implementing the logic of composing keys
 func (s *StrictEqKeyComposer) Compose(selectors []*Selector, userDefinedKeys []*schema.Field, parent LogicalOP) ([]keys.Key, error) {
-	var compositeKeys = make([][]*Selector, 1) // allocate just for the first keyParts
+	var compositeKeys = make([][]interface{}, 1) // allocate just for the first keyParts
 	for _, k := range userDefinedKeys {
 		var repeatedFields []*Selector
 		for _, sel := range selectors {
 			if k.FieldName == sel.Field {
 				repeatedFields = append(repeatedFields, sel)
 			}
-			if sel.Matcher.Type() != EQ {
-				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq comparison, found '%s'", sel.Matcher.Type())
+			if sel.Matcher.Type() != EQ && sel.Matcher.Type() != IN {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq/$in comparison, found '%s'", sel.Matcher.Type())
 			}
 		}
 
@@ -128,48 +135,416 @@ func (s *StrictEqKeyComposer) Compose(selectors []*Selector, userDefinedKeys []*
 			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "reusing same fields for conditions on equality")
 		}
 
-		compositeKeys[0] = append(compositeKeys[0], repeatedFields[0])
-		// as we found some repeated fields in the filter so clone the first set of keys and add this prefix to all the
-		// repeated fields, cloning is only needed if there are more than one repeated fields
-		for j := 1; j < len(repeatedFields); j++ {
-			keyPartsCopy := make([]*Selector, len(compositeKeys[0])-1)
-			copy(keyPartsCopy, compositeKeys[0][0:len(compositeKeys[0])-1])
-			keyPartsCopy = append(keyPartsCopy, repeatedFields[j])
-			compositeKeys = append(compositeKeys, keyPartsCopy)
+		var values []interface{}
+		for _, sel := range repeatedFields {
+			values = append(values, equalityValues(sel)...)
+		}
+
+		// as we may have found multiple values for this field so clone the existing set of keys and add each value
+		// to all of them.
+		var expanded [][]interface{}
+		for _, keyParts := range compositeKeys {
+			for _, v := range values {
+				keyPartsCopy := make([]interface{}, len(keyParts), len(keyParts)+1)
+				copy(keyPartsCopy, keyParts)
+				expanded = append(expanded, append(keyPartsCopy, v))
+			}
 		}
+		compositeKeys = expanded
+	}
+
+	if parent == OrOP && len(userDefinedKeys) > 1 && len(compositeKeys) > 0 {
+		// this means OR can't build independently these keys
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "OR is not supported with composite primary keys")
 	}
 
-	// keys building is dependent on the filter type
 	var allKeys []keys.Key
 	for _, k := range compositeKeys {
-		switch parent {
-		case AndOP:
-			var primaryKeyParts []interface{}
-			for _, s := range k {
-				primaryKeyParts = append(primaryKeyParts, s.Matcher.GetValue().AsInterface())
-			}
+		key, err := s.keyEncodingFunc(k...)
+		if err != nil {
+			return nil, err
+		}
+		allKeys = append(allKeys, key)
+	}
+
+	return allKeys, nil
+}
+
+// equalityValues returns the values that the field of the selector can be equal to. The selector must be either
+// "$eq" or "$in".
+// A double value on an integer field can't be equal to any value of the field, so it is skipped.
+func equalityValues(sel *Selector) []interface{} {
+	var list []interface{}
+	values := []value.Value{sel.Matcher.GetValue()}
+	if array, ok := sel.Matcher.GetValue().(*value.ArrayValue); ok && sel.Matcher.Type() == IN {
+		values = *array
+	}
+	for _, v := range values {
+		if !isDoubleOnIntegerField(sel.FieldType, v) {
+			list = append(list, keyPart(v))
+		}
+	}
 
-			key, err := s.keyEncodingFunc(primaryKeyParts...)
+	return list
+}
+
+// isDoubleOnIntegerField returns true if the value is a double and the field is an integer. The parser converts the
+// double bounds of the ranges on integer fields to integers, so such a value is either not integral or it is out of
+// the range of the integers.
+func isDoubleOnIntegerField(fieldType schema.FieldType, v value.Value) bool {
+	_, ok := v.(*value.DoubleValue)
+	return ok && (fieldType == schema.Int32Type || fieldType == schema.Int64Type)
+}
+
+// KeyRange is a range of internal keys, Start is inclusive and End is exclusive. A boundary ending with
+// keys.MaxIndexPart sorts after all the keys that are prefixed by the remaining index parts of the boundary.
+type KeyRange struct {
+	Start keys.Key
+	End   keys.Key
+}
+
+// RangeKeyComposer is to generate internal key ranges from the filters so that rows can be read using range scans
+// instead of point lookups. The following rules are applied for RangeKeyComposer
+//  - For AND filters, equality on the leading fields of the userDefinedKeys forms the prefix of the range and the next
+//    field can have $gt/$gte/$lt/$lte conditions to bound the range. The prefix can be empty, but the leading field
+//    must have a condition.
+//  - For OR filters, every condition must be on the key and the key can't be composite, each condition then forms
+//    its own range.
+// Conditions that are not used for building the range are ignored, so the caller must apply the filter on the rows
+// returned by the range.
+type RangeKeyComposer struct {
+	// keyEncodingFunc returns encoded key from index parts
+	keyEncodingFunc func(indexParts ...interface{}) (keys.Key, error)
+}
+
+func NewRangeKeyComposer(keyEncodingFunc func(indexParts ...interface{}) (keys.Key, error)) *RangeKeyComposer {
+	return &RangeKeyComposer{
+		keyEncodingFunc: keyEncodingFunc,
+	}
+}
+
+// Compose is implementing the logic of composing key ranges
+func (r *RangeKeyComposer) Compose(selectors []*Selector, userDefinedKeys []*schema.Field, parent LogicalOP) ([]KeyRange, error) {
+	if parent == OrOP {
+		if len(userDefinedKeys) > 1 {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "OR is not supported with composite primary keys")
+		}
+
+		var ranges []KeyRange
+		for _, sel := range selectors {
+			if sel.Field != userDefinedKeys[0].FieldName {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "OR is only supported on primary key fields")
+			}
+			var err error
+			var kr []KeyRange
+			switch sel.Matcher.Type() {
+			case EQ:
+				kr, err = r.composeRange(nil, []*Selector{sel})
+			case GT, GTE, LT, LTE:
+				if !schema.IsKeyOrderedType(userDefinedKeys[0].DataType) {
+					return nil, keyOrderError(userDefinedKeys[0])
+				}
+				kr, err = r.composeRange(nil, []*Selector{sel})
+			case IN:
+				kr, err = r.composeRanges(equalityPrefixes([][]interface{}{nil}, sel), nil)
+			default:
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq/$in/$gt/$gte/$lt/$lte comparison, found '%s'", sel.Matcher.Type())
+			}
 			if err != nil {
 				return nil, err
 			}
-			allKeys = append(allKeys, key)
-		case OrOP:
-			for _, sel := range k {
-				if len(userDefinedKeys) > 1 {
-					// this means OR can't build independently these keys
-					return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "OR is not supported with composite primary keys")
-				}
+			ranges = append(ranges, kr...)
+		}
 
-				key, err := s.keyEncodingFunc(sel.Matcher.GetValue().AsInterface())
-				if err != nil {
-					return nil, err
+		return ranges, nil
+	}
+
+	var prefixes = [][]interface{}{nil}
+	for _, k := range userDefinedKeys {
+		var eq *Selector
+		var bounds []*Selector
+		for _, sel := range selectors {
+			if k.FieldName != sel.Field {
+				continue
+			}
+
+			switch sel.Matcher.Type() {
+			case EQ, IN:
+				if eq != nil {
+					// with AND there is no use of EQ on the same field
+					return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "reusing same fields for conditions on equality")
+				}
+				eq = sel
+			case GT, GTE, LT, LTE:
+				if !schema.IsKeyOrderedType(k.DataType) {
+					return nil, keyOrderError(k)
 				}
+				bounds = append(bounds, sel)
+			default:
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq/$in/$gt/$gte/$lt/$lte comparison, found '%s'", sel.Matcher.Type())
+			}
+		}
 
-				allKeys = append(allKeys, key)
+		if eq != nil {
+			// the bounds are redundant in this case, the caller filtering the rows will take care of them
+			if prefixes = equalityPrefixes(prefixes, eq); len(prefixes) == 0 {
+				// empty "$in", nothing can match
+				return nil, nil
 			}
+			continue
 		}
+		if len(bounds) == 0 && len(prefixes[0]) == 0 {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "filters doesn't contains primary key fields")
+		}
+
+		return r.composeRanges(prefixes, bounds)
 	}
 
-	return allKeys, nil
+	return r.composeRanges(prefixes, nil)
+}
+
+// keyOrderError is returned for a range on a field whose keys are not in the order of the values.
+func keyOrderError(field *schema.Field) error {
+	return api.Errorf(api.Code_INVALID_ARGUMENT, "range is not supported on the key field '%s' of type '%s'", field.FieldName, schema.FieldNames[field.DataType])
+}
+
+// composeRanges returns the ranges for all the prefixes using the same bounds.
+func (r *RangeKeyComposer) composeRanges(prefixes [][]interface{}, bounds []*Selector) ([]KeyRange, error) {
+	var ranges []KeyRange
+	for _, prefix := range prefixes {
+		kr, err := r.composeRange(prefix, bounds)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, kr...)
+	}
+
+	return ranges, nil
+}
+
+// equalityPrefixes appends the values of the "$eq" or "$in" selector to the prefixes. A prefix is formed for each
+// value, so "$in" multiplies the number of prefixes.
+func equalityPrefixes(prefixes [][]interface{}, sel *Selector) [][]interface{} {
+	var expanded [][]interface{}
+	for _, prefix := range prefixes {
+		for _, v := range equalityValues(sel) {
+			prefixCopy := make([]interface{}, len(prefix), len(prefix)+1)
+			copy(prefixCopy, prefix)
+			expanded = append(expanded, append(prefixCopy, v))
+		}
+	}
+
+	return expanded
+}
+
+// composeRange returns the range of keys prefixed by the prefix and bounded by the bounds on the next field of the
+// key. An empty list is returned if the bounds can't be satisfied.
+func (r *RangeKeyComposer) composeRange(prefix []interface{}, bounds []*Selector) ([]KeyRange, error) {
+	var lower, upper *Selector
+	for _, b := range bounds {
+		if isDoubleOnIntegerField(b.FieldType, b.Matcher.GetValue()) {
+			if d := *b.Matcher.GetValue().(*value.DoubleValue); b.Matcher.Type() == EQ ||
+				(d > 0) == (b.Matcher.Type() == GT || b.Matcher.Type() == GTE) {
+				// equality with a non integral value, a lower bound above all the integers or an upper bound
+				// below all the integers, nothing can satisfy it
+				return nil, nil
+			}
+			// the bound is beyond all the integers, so it is not bounding the range
+			continue
+		}
+
+		switch b.Matcher.Type() {
+		case EQ:
+			lower, upper = b, b
+		case GT, GTE:
+			if tighter, err := isTighterBound(b, lower, 1); err != nil {
+				return nil, err
+			} else if tighter {
+				lower = b
+			}
+		case LT, LTE:
+			if tighter, err := isTighterBound(b, upper, -1); err != nil {
+				return nil, err
+			} else if tighter {
+				upper = b
+			}
+		}
+	}
+
+	if lower != nil && upper != nil {
+		res, err := lower.Matcher.GetValue().CompareTo(upper.Matcher.GetValue())
+		if err != nil {
+			return nil, err
+		}
+		if res > 0 || (res == 0 && (lower.Matcher.Type() == GT || upper.Matcher.Type() == LT)) {
+			// nothing can satisfy the bounds
+			return nil, nil
+		}
+	}
+
+	var startParts, endParts []interface{}
+	startParts = append(startParts, prefix...)
+	if lower != nil {
+		startParts = append(startParts, keyPart(lower.Matcher.GetValue()))
+		if lower.Matcher.Type() == GT {
+			startParts = append(startParts, keys.MaxIndexPart)
+		}
+	}
+
+	endParts = append(endParts, prefix...)
+	if upper != nil {
+		endParts = append(endParts, keyPart(upper.Matcher.GetValue()))
+		if upper.Matcher.Type() != LT {
+			endParts = append(endParts, keys.MaxIndexPart)
+		}
+	} else {
+		endParts = append(endParts, keys.MaxIndexPart)
+	}
+
+	start, err := r.keyEncodingFunc(startParts...)
+	if err != nil {
+		return nil, err
+	}
+	end, err := r.keyEncodingFunc(endParts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return []KeyRange{{Start: start, End: end}}, nil
+}
+
+// KeyRangeFilters returns the filters matching exactly the keys of the range, it is the reverse of composeRange. The
+// start and end are the index parts of the boundaries without the encoded index name. The leading parts that are same
+// in both the boundaries are the equality on the userDefinedKeys, and the next part of the start and the end are the
+// lower and the upper bound of the next field. An error is returned if the range is not of this form.
+func KeyRangeFilters(userDefinedKeys []*schema.Field, start []interface{}, end []interface{}) ([]Filter, error) {
+	startExclusive, endInclusive := false, false
+	if n := len(start); n > 0 && start[n-1] == keys.MaxIndexPart {
+		start, startExclusive = start[:n-1], true
+	}
+	if n := len(end); n > 0 && end[n-1] == keys.MaxIndexPart {
+		end, endInclusive = end[:n-1], true
+	}
+
+	prefix := 0
+	for prefix < len(start) && prefix < len(end) && reflect.DeepEqual(start[prefix], end[prefix]) {
+		prefix++
+	}
+	if len(start) > prefix+1 || len(end) > prefix+1 || (len(start) == prefix && startExclusive) ||
+		(len(end) == prefix && !endInclusive) || len(start) > len(userDefinedKeys) || len(end) > len(userDefinedKeys) {
+		return nil, api.Errorf(api.Code_INTERNAL, "range can't be converted to filters")
+	}
+
+	var filters []Filter
+	for i := 0; i < prefix; i++ {
+		v, err := keyPartValue(userDefinedKeys[i], start[i])
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, NewSelector(userDefinedKeys[i].FieldName, userDefinedKeys[i].DataType, NewEqualityMatcher(v)))
+	}
+
+	bound := func(field *schema.Field, part interface{}, op string) error {
+		v, err := keyPartValue(field, part)
+		if err != nil {
+			return err
+		}
+		matcher, err := NewMatcher(op, v)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, NewSelector(field.FieldName, field.DataType, matcher))
+		return nil
+	}
+	if len(start) > prefix {
+		op := GTE
+		if startExclusive {
+			op = GT
+		}
+		if err := bound(userDefinedKeys[prefix], start[prefix], op); err != nil {
+			return nil, err
+		}
+	}
+	if len(end) > prefix {
+		op := LT
+		if endInclusive {
+			op = LTE
+		}
+		if err := bound(userDefinedKeys[prefix], end[prefix], op); err != nil {
+			return nil, err
+		}
+	}
+
+	return filters, nil
+}
+
+// keyJSON escapes the strings like the JSON of the documents, without escaping the HTML characters.
+var keyJSON = jsoniter.Config{EscapeHTML: false}.Froze()
+
+// keyPart returns the index part of the value. The keys of the documents are built from the strings as they are in
+// the JSON of the document, so the strings of the filters that are unescaped are escaped back to their JSON form.
+func keyPart(v value.Value) interface{} {
+	if s, ok := v.(*value.StringValue); ok {
+		if escaped, err := keyJSON.MarshalToString(string(*s)); err == nil {
+			return escaped[1 : len(escaped)-1]
+		}
+	}
+
+	return v.AsInterface()
+}
+
+// keyPartValue returns the value of the field from the index part, it is the reverse of keyPart.
+func keyPartValue(field *schema.Field, part interface{}) (value.Value, error) {
+	switch t := part.(type) {
+	case int:
+		// the keys unpacked from the database have the integers as int if they fit
+		if field.DataType == schema.Int32Type || field.DataType == schema.Int64Type {
+			return value.NewIntValue(int64(t)), nil
+		}
+	case int64:
+		if field.DataType == schema.Int32Type || field.DataType == schema.Int64Type {
+			return value.NewIntValue(t), nil
+		}
+	case float64:
+		if field.DataType == schema.DoubleType {
+			return value.NewDoubleValue(t), nil
+		}
+	case []byte:
+		if field.DataType == schema.ByteType {
+			return value.NewBytesValue(t), nil
+		}
+	case string:
+		switch field.DataType {
+		case schema.StringType:
+			if unescaped, err := jsonparser.ParseString([]byte(t)); err == nil {
+				return value.NewStringValue(unescaped), nil
+			}
+		case schema.UUIDType, schema.DateTimeType:
+			// the key has the text of the document, the value keeps it
+			if v, err := value.NewValue(field.DataType, []byte(t)); err == nil {
+				return v, nil
+			}
+		}
+	}
+
+	return nil, api.Errorf(api.Code_INTERNAL, "unsupported key part '%v' of field '%s'", part, field.FieldName)
+}
+
+// isTighterBound returns true if the candidate narrows the range more than the current bound. The direction is
+// positive for lower bounds and negative for upper bounds.
+func isTighterBound(candidate *Selector, current *Selector, direction int) (bool, error) {
+	if current == nil {
+		return true, nil
+	}
+
+	res, err := candidate.Matcher.GetValue().CompareTo(current.Matcher.GetValue())
+	if err != nil {
+		return false, err
+	}
+	if res == 0 {
+		// exclusive bound is tighter than the inclusive one
+		return candidate.Matcher.Type() == GT || candidate.Matcher.Type() == LT, nil
+	}
+
+	return res*direction > 0, nil
 }
@@ -56,7 +56,7 @@ func TestKeyBuilder(t *testing.T) {
 			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}, {FieldName: "c", DataType: schema.Int64Type}, {FieldName: "b", DataType: schema.Int64Type}},
 			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}, {FieldName: "c", DataType: schema.Int64Type}, {FieldName: "b", DataType: schema.Int64Type}},
 			[]byte(`{"a": 10, "b": {"$eq": 10}, "c": {"$gt": 15}}`),
-			api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq comparison, found '$gt'"),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq/$in comparison, found '$gt'"),
 			nil,
 		},
 		{
@@ -111,10 +111,45 @@ func TestKeyBuilder(t *testing.T) {
 			[]byte(`{"$or":[{"$and":[{"K1":"bar"},{"K2":3}]},{"$and":[{"K1":"foo"},{"K2":2}]}]}`),
 			nil,
 			[]keys.Key{keys.NewKey(nil, "bar", int64(3)), keys.NewKey(nil, "foo", int64(2))},
+		}, {
+			// in on the single key
+			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}, {FieldName: "b", DataType: schema.Int64Type}},
+			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}},
+			[]byte(`{"a": {"$in": [1, 2, 3]}, "b": 10}`),
+			nil,
+			[]keys.Key{keys.NewKey(nil, int64(1)), keys.NewKey(nil, int64(2)), keys.NewKey(nil, int64(3))},
+		}, {
+			// in on the composite key
+			[]*schema.Field{{FieldName: "K1", DataType: schema.StringType}, {FieldName: "K2", DataType: schema.Int64Type}},
+			[]*schema.Field{{FieldName: "K1", DataType: schema.StringType}, {FieldName: "K2", DataType: schema.Int64Type}},
+			[]byte(`{"K1": {"$in": ["foo", "bar"]}, "K2": {"$in": [1, 2]}}`),
+			nil,
+			[]keys.Key{keys.NewKey(nil, "foo", int64(1)), keys.NewKey(nil, "foo", int64(2)), keys.NewKey(nil, "bar", int64(1)), keys.NewKey(nil, "bar", int64(2))},
+		}, {
+			// in with OR parent filter
+			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}},
+			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}},
+			[]byte(`{"$or": [{"a": {"$in": [1, 2]}}, {"a": 3}]}`),
+			nil,
+			[]keys.Key{keys.NewKey(nil, int64(1)), keys.NewKey(nil, int64(2)), keys.NewKey(nil, int64(3))},
+		}, {
+			// the strings of the keys are in their JSON form, like in the documents
+			[]*schema.Field{{FieldName: "a", DataType: schema.StringType}},
+			[]*schema.Field{{FieldName: "a", DataType: schema.StringType}},
+			[]byte(`{"a": "a\"b<c"}`),
+			nil,
+			[]keys.Key{keys.NewKey(nil, `a\"b<c`)},
+		}, {
+			// not in can't be used for building the keys
+			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}},
+			[]*schema.Field{{FieldName: "a", DataType: schema.Int64Type}},
+			[]byte(`{"a": {"$nin": [1, 2]}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "filters only supporting $eq/$in comparison, found '$nin'"),
+			nil,
 		},
 	}
 	for _, c := range cases {
-		b := NewKeyBuilder(NewStrictEqKeyComposer(dummyEncodeFunc))
+		b := NewKeyBuilder[keys.Key](NewStrictEqKeyComposer(dummyEncodeFunc))
 		filters := testFilters(t, c.userFields, c.userInput)
 		buildKeys, err := b.Build(filters, c.userKeys)
 		require.Equal(t, c.expError, err)
@@ -132,9 +167,204 @@ func TestKeyBuilder(t *testing.T) {
 	}
 }
 
+func TestRangeKeyComposer(t *testing.T) {
+	max := keys.MaxIndexPart
+	compositeFields := []*schema.Field{{FieldName: "cust_id", DataType: schema.Int64Type}, {FieldName: "order_id", DataType: schema.Int64Type}, {FieldName: "status", DataType: schema.StringType}, {FieldName: "created", DataType: schema.DateTimeType}}
+	compositeKeys := []*schema.Field{{FieldName: "cust_id", DataType: schema.Int64Type}, {FieldName: "order_id", DataType: schema.Int64Type}}
+	singleKey := []*schema.Field{{FieldName: "cust_id", DataType: schema.Int64Type}}
+
+	cases := []struct {
+		userKeys  []*schema.Field
+		userInput []byte
+		expError  error
+		expRanges []KeyRange
+	}{
+		{
+			// prefix of the composite key with a range on the next field
+			compositeKeys,
+			[]byte(`{"cust_id": 5, "order_id": {"$gt": 100}}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(5), int64(100), max), keys.NewKey(nil, int64(5), max)}},
+		},
+		{
+			// multiple operators on the same field, the tightest bound is used
+			compositeKeys,
+			[]byte(`{"cust_id": 5, "order_id": {"$gte": 100, "$gt": 50, "$lte": 200}}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(5), int64(100)), keys.NewKey(nil, int64(5), int64(200), max)}},
+		},
+		{
+			// only the prefix of the composite key, non key fields are ignored
+			compositeKeys,
+			[]byte(`{"cust_id": 5, "status": "open"}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(5)), keys.NewKey(nil, int64(5), max)}},
+		},
+		{
+			// range on the leading field
+			compositeKeys,
+			[]byte(`{"cust_id": {"$lt": 5}}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil), keys.NewKey(nil, int64(5))}},
+		},
+		{
+			// all the key fields with equality
+			compositeKeys,
+			[]byte(`{"cust_id": 5, "order_id": 10}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(5), int64(10)), keys.NewKey(nil, int64(5), int64(10), max)}},
+		},
+		{
+			// bounds that can't be satisfied
+			compositeKeys,
+			[]byte(`{"cust_id": {"$gt": 5, "$lt": 5}}`),
+			nil,
+			nil,
+		},
+		{
+			// or on the single key
+			singleKey,
+			[]byte(`{"$or": [{"cust_id": {"$gte": 10}}, {"cust_id": 1}]}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(10)), keys.NewKey(nil, max)}, {keys.NewKey(nil, int64(1)), keys.NewKey(nil, int64(1), max)}},
+		},
+		{
+			// in on the prefix of the composite key
+			compositeKeys,
+			[]byte(`{"cust_id": {"$in": [1, 2]}, "order_id": {"$lt": 10}}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(1)), keys.NewKey(nil, int64(1), int64(10))}, {keys.NewKey(nil, int64(2)), keys.NewKey(nil, int64(2), int64(10))}},
+		},
+		{
+			// the date time keys are the text of the document, they are not ordered by the time
+			[]*schema.Field{{FieldName: "created", DataType: schema.DateTimeType}},
+			[]byte(`{"created": {"$gte": "2022-01-01T05:00:00+05:00"}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "range is not supported on the key field 'created' of type 'datetime'"),
+			nil,
+		},
+		{
+			// equality on the date time key uses the text of the filter
+			[]*schema.Field{{FieldName: "created", DataType: schema.DateTimeType}},
+			[]byte(`{"created": "2022-01-01T05:00:00+05:00"}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, "2022-01-01T05:00:00+05:00"), keys.NewKey(nil, "2022-01-01T05:00:00+05:00", max)}},
+		},
+		{
+			// double bound on an integer key
+			singleKey,
+			[]byte(`{"cust_id": {"$gt": 4.5, "$lt": 1e20}}`),
+			nil,
+			[]KeyRange{{keys.NewKey(nil, int64(5)), keys.NewKey(nil, max)}},
+		},
+		{
+			// double bound that is below all the integers
+			singleKey,
+			[]byte(`{"cust_id": {"$lt": -1e20}}`),
+			nil,
+			nil,
+		},
+		{
+			// equality with a double on an integer key
+			compositeKeys,
+			[]byte(`{"cust_id": {"$in": [1.5, 2]}, "order_id": 1.5}`),
+			nil,
+			nil,
+		},
+		{
+			// empty in
+			compositeKeys,
+			[]byte(`{"cust_id": {"$in": []}}`),
+			nil,
+			nil,
+		},
+		{
+			// no condition on the leading field
+			compositeKeys,
+			[]byte(`{"order_id": {"$gt": 100}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "filters doesn't contains primary key fields"),
+			nil,
+		},
+		{
+			// or with composite key
+			compositeKeys,
+			[]byte(`{"$or": [{"cust_id": 1}, {"cust_id": 2}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "OR is not supported with composite primary keys"),
+			nil,
+		},
+		{
+			// or with non key field
+			singleKey,
+			[]byte(`{"$or": [{"cust_id": 1}, {"status": "open"}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "OR is only supported on primary key fields"),
+			nil,
+		},
+	}
+	for _, c := range cases {
+		b := NewKeyBuilder[KeyRange](NewRangeKeyComposer(dummyEncodeFunc))
+		filters := testFilters(t, compositeFields, c.userInput)
+		buildRanges, err := b.Build(filters, c.userKeys)
+		require.Equal(t, c.expError, err, string(c.userInput))
+		require.ElementsMatch(t, c.expRanges, buildRanges, string(c.userInput))
+	}
+}
+
+func TestKeyRangeFilters(t *testing.T) {
+	max := keys.MaxIndexPart
+	compositeKeys := []*schema.Field{{FieldName: "cust_id", DataType: schema.Int64Type}, {FieldName: "order_id", DataType: schema.StringType}}
+
+	cases := []struct {
+		userInput []byte
+		expFilter []byte
+	}{
+		{
+			[]byte(`{"cust_id": 5, "order_id": {"$gt": "a"}}`),
+			[]byte(`{"cust_id": 5, "order_id": {"$gt": "a"}}`),
+		},
+		{
+			[]byte(`{"cust_id": {"$gte": 5, "$lte": 10}}`),
+			[]byte(`{"cust_id": {"$gte": 5, "$lte": 10}}`),
+		},
+		{
+			[]byte(`{"cust_id": {"$lt": 5}}`),
+			[]byte(`{"cust_id": {"$lt": 5}}`),
+		},
+		{
+			// the bounds are equal, so it is an equality
+			[]byte(`{"cust_id": {"$gte": 5, "$lte": 5}}`),
+			[]byte(`{"cust_id": 5}`),
+		},
+		{
+			[]byte(`{"cust_id": 5, "order_id": "a"}`),
+			[]byte(`{"cust_id": 5, "order_id": "a"}`),
+		},
+		{
+			[]byte(`{"cust_id": 5}`),
+			[]byte(`{"cust_id": 5}`),
+		},
+	}
+	for _, c := range cases {
+		b := NewKeyBuilder[KeyRange](NewRangeKeyComposer(dummyEncodeFunc))
+		ranges, err := b.Build(testFilters(t, compositeKeys, c.userInput), compositeKeys)
+		require.NoError(t, err)
+		require.Len(t, ranges, 1)
+
+		filters, err := KeyRangeFilters(compositeKeys, ranges[0].Start.IndexParts(), ranges[0].End.IndexParts())
+		require.NoError(t, err, string(c.userInput))
+		require.ElementsMatch(t, testFilters(t, compositeKeys, c.expFilter), filters, string(c.userInput))
+	}
+
+	// only the ranges built from the filters can be converted
+	_, err := KeyRangeFilters(compositeKeys, []interface{}{int64(1), "a"}, []interface{}{int64(2), "b"})
+	require.Error(t, err)
+	_, err = KeyRangeFilters(compositeKeys, []interface{}{int64(1)}, []interface{}{int64(1)})
+	require.Error(t, err)
+	_, err = KeyRangeFilters(compositeKeys, []interface{}{"a"}, []interface{}{max})
+	require.Error(t, err)
+}
+
 func BenchmarkStrictEqKeyComposer_Compose(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		kb := NewKeyBuilder(NewStrictEqKeyComposer(dummyEncodeFunc))
+		kb := NewKeyBuilder[keys.Key](NewStrictEqKeyComposer(dummyEncodeFunc))
 		filters := testFilters(b, []*schema.Field{{FieldName: "a", DataType: schema.Int64Type}, {FieldName: "b", DataType: schema.Int64Type}, {FieldName: "c", DataType: schema.Int64Type}}, []byte(`{"b": 10, "a": {"$eq": 10}, "c": "foo"}}`))
 		_, err := kb.Build(filters, []*schema.Field{{FieldName: "a", DataType: schema.Int64Type}, {FieldName: "b", DataType: schema.Int64Type}, {FieldName: "c", DataType: schema.Int64Type}})
 		require.NoError(b, err)
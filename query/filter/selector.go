@@ -16,6 +16,11 @@ package filter
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
 )
 
 // Selector is a condition defined inside a filter. It has a field which corresponding the field on which condition
@@ -28,39 +33,120 @@ import (
 //    {f:20} (default is "$eq" so we automatically append EqualityMatcher for this case in parser)
 //    {f:<Expr>}
 type Selector struct {
-	Field   string
-	Matcher ValueMatcher
+	Field     string
+	FieldType schema.FieldType
+	Matcher   ValueMatcher
 }
 
 // NewSelector returns Selector object
-func NewSelector(field string, matcher ValueMatcher) *Selector {
+func NewSelector(field string, fieldType schema.FieldType, matcher ValueMatcher) *Selector {
 	return &Selector{
-		Field:   field,
-		Matcher: matcher,
+		Field:     field,
+		FieldType: fieldType,
+		Matcher:   matcher,
 	}
 }
 
-// Matches returns true if the input doc matches this filter.
+// Matches returns true if the input doc matches this filter. The value of the field is extracted from the raw JSON
+// document and converted to a value using the type of the field so that it can be compared with the value that the
+// matcher holds. A document that doesn't have the field or has it set to null only matches the negations like "$ne",
+// "$nin" or "$exists": false. A value that doesn't have the type of the field is not equal to any value of the filter,
+// so it is also matched like a missing field.
+//
+// The field can be a path to a nested field. If the path goes through an array of objects then the selector is
+// evaluated on the field of all the objects, it matches if the field of any object matches the condition, and for
+// negations it matches only if the field of all the objects matches it.
+//
+// The array operators are evaluated on the raw JSON array of the field.
 func (s *Selector) Matches(doc []byte) bool {
-	//ToDo: not implemented
-	return false
+	docValues := getValues(doc, strings.Split(s.Field, schema.FieldPathSeparator))
+	if len(docValues) == 0 {
+		return matchesMissing(s.Matcher)
+	}
+	if e, ok := s.Matcher.(*ExistsMatcher); ok {
+		// no need to build the value, also the field may be an object or an array
+		return e.Exists
+	}
+	if a, ok := s.Matcher.(ArrayMatcher); ok {
+		for _, docValue := range docValues {
+			if a.MatchesArray(docValue) {
+				return true
+			}
+		}
+		return false
+	}
+
+	all := isNegation(s.Matcher)
+	for _, docValue := range docValues {
+		var matches bool
+		if v, err := value.NewValue(s.FieldType, docValue); err != nil {
+			// the value doesn't have the type of the field
+			matches = matchesMissing(s.Matcher)
+		} else {
+			matches = s.Matcher.Matches(v)
+		}
+
+		if matches != all {
+			return !all
+		}
+	}
+
+	return all
 }
 
-func (s *Selector) ToSearchFilter() string {
-	var op string
-	switch s.Matcher.Type() {
-	case EQ:
-		op = "%s:=%v"
-	case GT:
-		op = "%s:>%v"
-	case GTE:
-		op = "%s:>=%v"
-	case LT:
-		op = "%s:<%v"
-	case LTE:
-		op = "%s:<=%v"
+// getValues returns the raw values present at the path in the document, null values are ignored. If there is an
+// array of objects in the path then the remaining path is looked up in all the objects of the array. The strings are
+// returned unescaped.
+func getValues(doc []byte, path []string) [][]byte {
+	docValue, dataType, _, err := jsonparser.Get(doc, path[0])
+	if err != nil || dataType == jsonparser.NotExist || dataType == jsonparser.Null {
+		return nil
+	}
+	if len(path) == 1 {
+		if docValue, err = unescape(docValue, dataType); err != nil {
+			return nil
+		}
+		return [][]byte{docValue}
 	}
-	return fmt.Sprintf(op, s.Field, s.Matcher.GetValue().AsInterface())
+
+	switch dataType {
+	case jsonparser.Object:
+		return getValues(docValue, path[1:])
+	case jsonparser.Array:
+		var values [][]byte
+		_, _ = jsonparser.ArrayEach(docValue, func(item []byte, itemType jsonparser.ValueType, _ int, _ error) {
+			if itemType == jsonparser.Object {
+				values = append(values, getValues(item, path[1:])...)
+			}
+		})
+		return values
+	}
+
+	return nil
+}
+
+// unescape returns the string value without its escape sequences, jsonparser returns the strings as they are in the
+// JSON. Any other value is returned as it is.
+func unescape(v []byte, dataType jsonparser.ValueType) ([]byte, error) {
+	if dataType != jsonparser.String {
+		return v, nil
+	}
+
+	s, err := jsonparser.ParseString(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// newValue returns the value of the field type for the value returned by jsonparser.
+func newValue(fieldType schema.FieldType, v []byte, dataType jsonparser.ValueType) (value.Value, error) {
+	v, err := unescape(v, dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	return value.NewValue(fieldType, v)
 }
 
 // String a helpful method for logging.
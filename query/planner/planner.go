@@ -0,0 +1,361 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/query/search"
+	"github.com/tigrisdata/tigris/query/sort"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+type PlanType string
+
+const (
+	// PointLookupPlan reads the rows using the primary keys built from the equalities in the filter.
+	PointLookupPlan PlanType = "point_lookup"
+	// RangeScanPlan scans the primary key ranges built from the comparisons in the filter.
+	RangeScanPlan PlanType = "range_scan"
+	// SearchPlan pushes the filter down to the search index.
+	SearchPlan PlanType = "search"
+	// FullScanPlan scans the complete collection.
+	FullScanPlan PlanType = "full_scan"
+)
+
+type SortType string
+
+const (
+	// KeyOrderSort means the rows read by the plan are already in the requested order.
+	KeyOrderSort SortType = "key_order"
+	// ReverseKeyOrderSort means the plan needs to read the rows in the reverse primary key order.
+	ReverseKeyOrderSort SortType = "reverse_key_order"
+	// SearchSort pushes the sort down to the search index.
+	SearchSort SortType = "search"
+	// InMemorySort sorts the rows read by the plan in memory.
+	InMemorySort SortType = "in_memory"
+)
+
+// maxSearchSortFields is the maximum number of fields the search index can sort on.
+const maxSearchSortFields = 3
+
+// The costs are relative numbers that are only used to compare the plans. A point lookup is a single read, a range
+// is scanning an unknown number of rows, search is an index lookup but needs to fetch the documents from the search
+// store page by page, and a full scan reads all the rows of the collection.
+const (
+	pointLookupCost = 1
+	rangeScanCost   = 10
+	searchCost      = 1000
+	fullScanCost    = 100000
+)
+
+// Plan is the way a read query is executed. Only the fields that are needed for the type of the plan are set.
+type Plan struct {
+	Type PlanType
+	Cost float64
+	// Keys are the primary keys for the point lookup, or the table key for the full scan.
+	Keys []keys.Key
+	// Ranges are the primary key ranges for the range scan.
+	Ranges []filter.KeyRange
+	// SearchFilter is the filter pushed down to search.
+	SearchFilter string
+	// Residual is the filter that needs to be applied on the rows read by the plan, nil if the rows returned by the
+	// plan are already filtered.
+	Residual *filter.WrappedFilter
+	// Sort is how the rows are returned in the requested order, empty if no order is requested.
+	Sort SortType
+	// SearchSort is the sort pushed down to search, it may only be the tiebreak on the primary key fields.
+	SearchSort string
+	// Candidates are all the plans that are considered by the planner, including the chosen one.
+	Candidates []*Candidate
+}
+
+// Candidate is a plan that is considered by the planner, Reason is set if the plan is not possible for the query.
+type Candidate struct {
+	Type   PlanType
+	Cost   float64
+	Reason string
+}
+
+// Planner builds all the plans that are possible for a filter and picks the one with the lowest cost.
+type Planner struct {
+	collection      *schema.DefaultCollection
+	table           []byte
+	keyEncodingFunc func(indexParts ...interface{}) (keys.Key, error)
+	searchEnabled   bool
+}
+
+// NewPlanner returns Planner for the collection. The table is the encoded table name of the collection and
+// keyEncodingFunc encodes the primary key of the collection. A search plan is only considered if searchEnabled is set.
+func NewPlanner(collection *schema.DefaultCollection, table []byte, keyEncodingFunc func(indexParts ...interface{}) (keys.Key, error), searchEnabled bool) *Planner {
+	return &Planner{
+		collection:      collection,
+		table:           table,
+		keyEncodingFunc: keyEncodingFunc,
+		searchEnabled:   searchEnabled,
+	}
+}
+
+// Plan returns the cheapest plan for the filter. An error is returned only if the filter is not valid, a full scan is
+// always possible.
+func (p *Planner) Plan(reqFilter []byte) (*Plan, error) {
+	if len(reqFilter) == 0 || filter.IsFullCollectionScan(reqFilter) {
+		plan, _ := p.fullScan(nil)
+		plan.Candidates = []*Candidate{{Type: FullScanPlan, Cost: plan.Cost}}
+		return plan, nil
+	}
+
+	filters, err := filter.NewFactory(p.collection.Fields).Factorize(reqFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	var chosen *Plan
+	var candidates []*Candidate
+	for _, build := range []func([]filter.Filter) (*Plan, error){p.pointLookup, p.rangeScan, p.search, p.fullScan} {
+		plan, err := build(filters)
+		if err != nil {
+			candidates = append(candidates, &Candidate{Type: plan.Type, Reason: err.Error()})
+			continue
+		}
+
+		candidates = append(candidates, &Candidate{Type: plan.Type, Cost: plan.Cost})
+		if chosen == nil || plan.Cost < chosen.Cost {
+			chosen = plan
+		}
+	}
+	chosen.Candidates = candidates
+
+	return chosen, nil
+}
+
+func (p *Planner) pointLookup(filters []filter.Filter) (*Plan, error) {
+	plan := &Plan{Type: PointLookupPlan}
+
+	kb := filter.NewKeyBuilder[keys.Key](filter.NewStrictEqKeyComposer(p.keyEncodingFunc))
+	iKeys, err := kb.Build(filters, p.collection.Indexes.PrimaryKey.Fields)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Keys = iKeys
+	plan.Cost = float64(len(iKeys) * pointLookupCost)
+	// keys may be built using only the primary key fields, so the rows still need to be matched with the filter
+	plan.Residual = filter.NewWrappedFilter(filters)
+	return plan, nil
+}
+
+func (p *Planner) rangeScan(filters []filter.Filter) (*Plan, error) {
+	plan := &Plan{Type: RangeScanPlan}
+
+	kb := filter.NewKeyBuilder[filter.KeyRange](filter.NewRangeKeyComposer(p.keyEncodingFunc))
+	keyRanges, err := kb.Build(filters, p.collection.Indexes.PrimaryKey.Fields)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Ranges = keyRanges
+	plan.Cost = float64(len(keyRanges) * rangeScanCost)
+	plan.Residual = filter.NewWrappedFilter(filters)
+	return plan, nil
+}
+
+func (p *Planner) search(filters []filter.Filter) (*Plan, error) {
+	plan := &Plan{Type: SearchPlan}
+	if !p.searchEnabled {
+		return plan, fmt.Errorf("search is not enabled for reads")
+	}
+
+	searchFilter, err := search.NewBuilder(p.collection.Fields).FromFilter(filters)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.SearchFilter = searchFilter
+	plan.Cost = searchCost
+	return plan, nil
+}
+
+func (p *Planner) fullScan(filters []filter.Filter) (*Plan, error) {
+	plan := &Plan{
+		Type: FullScanPlan,
+		Keys: []keys.Key{keys.NewKey(p.table)},
+		Cost: fullScanCost,
+	}
+	if len(filters) > 0 {
+		plan.Residual = filter.NewWrappedFilter(filters)
+	}
+
+	return plan, nil
+}
+
+// SetSort decides how the rows read by the plan are returned in the order of the sort fields. The primary key order
+// is used if the fields are the primary key fields in the same direction, ignoring the fields that are fixed by the
+// range. The numeric fields are sorted by the search index, and for everything else the rows are sorted in memory.
+// The search index is also sorted by the primary key if it can, so that the ties are always in the same order and an
+// offset of the search read refers to the same document.
+func (p *Planner) SetSort(plan *Plan, ordering sort.Ordering) {
+	if plan.Type == SearchPlan && len(ordering) == 0 {
+		plan.SearchSort = p.searchSort(nil)
+	}
+	if len(ordering) == 0 {
+		return
+	}
+
+	switch plan.Type {
+	case RangeScanPlan:
+		if len(plan.Ranges) == 1 {
+			plan.Sort = p.keyOrderSort(ordering, fixedKeyParts(plan.Ranges[0]))
+		}
+	case FullScanPlan:
+		plan.Sort = p.keyOrderSort(ordering, 0)
+	case SearchPlan:
+		plan.SearchSort = p.searchSort(ordering)
+		if len(plan.SearchSort) > 0 {
+			plan.Sort = SearchSort
+		}
+	}
+
+	if len(plan.Sort) == 0 {
+		plan.Sort = InMemorySort
+	}
+}
+
+// keyOrderSort returns the key order sort if the ordering matches the primary key, the first fixed fields of the
+// primary key have a single value, so they can be anywhere in the ordering.
+func (p *Planner) keyOrderSort(ordering sort.Ordering, fixed int) SortType {
+	pkFields := p.collection.Indexes.PrimaryKey.Fields
+	fixedFields := make(map[string]struct{})
+	for _, f := range pkFields[:fixed] {
+		fixedFields[f.FieldName] = struct{}{}
+	}
+
+	var sortType SortType
+	next := fixed
+	for _, sf := range ordering {
+		if _, ok := fixedFields[sf.Name]; ok {
+			continue
+		}
+		if next == len(pkFields) {
+			// the primary key is unique, the fields after it don't change the order
+			break
+		}
+		if pkFields[next].FieldName != sf.Name || !schema.IsKeyOrderedType(pkFields[next].DataType) {
+			return ""
+		}
+
+		direction := KeyOrderSort
+		if !sf.Ascending {
+			direction = ReverseKeyOrderSort
+		}
+		if len(sortType) > 0 && sortType != direction {
+			return ""
+		}
+		sortType = direction
+		next++
+	}
+
+	if len(sortType) == 0 {
+		// only the fixed fields are in the ordering
+		return KeyOrderSort
+	}
+	return sortType
+}
+
+// searchSort returns the sort_by for the search index, empty if the search index can't sort on the fields.
+func (p *Planner) searchSort(ordering sort.Ordering) string {
+	if len(ordering) > maxSearchSortFields {
+		return ""
+	}
+
+	var sortBy []string
+	for _, sf := range ordering {
+		if !p.searchSortable(sf.Name) {
+			return ""
+		}
+
+		if sf.Ascending {
+			sortBy = append(sortBy, sf.Name+":asc")
+		} else {
+			sortBy = append(sortBy, sf.Name+":desc")
+		}
+	}
+
+	if tiebreak := p.searchTiebreak(ordering); len(tiebreak) > 0 && len(sortBy)+len(tiebreak) <= maxSearchSortFields {
+		sortBy = append(sortBy, tiebreak...)
+	}
+	return strings.Join(sortBy, ",")
+}
+
+// searchTiebreak returns the sort_by of the primary key fields that are not in the ordering. It is empty if the search
+// index can't sort on one of these fields, the order of the ties is then decided by the search index.
+func (p *Planner) searchTiebreak(ordering sort.Ordering) []string {
+	ordered := make(map[string]struct{})
+	for _, sf := range ordering {
+		ordered[sf.Name] = struct{}{}
+	}
+
+	var tiebreak []string
+	for _, f := range p.collection.Indexes.PrimaryKey.Fields {
+		if _, ok := ordered[f.FieldName]; ok {
+			continue
+		}
+		if !p.searchSortable(f.FieldName) {
+			return nil
+		}
+		tiebreak = append(tiebreak, f.FieldName+":asc")
+	}
+
+	return tiebreak
+}
+
+// searchSortable returns true if the search index can sort on the field, only the numeric fields are sortable.
+func (p *Planner) searchSortable(name string) bool {
+	field := schema.GetField(p.collection.Fields, name)
+	if field == nil {
+		return false
+	}
+
+	switch field.Type() {
+	case schema.Int32Type, schema.Int64Type, schema.DoubleType:
+		return true
+	default:
+		return false
+	}
+}
+
+// fixedKeyParts returns the number of the leading primary key parts that have the same value in the complete range.
+func fixedKeyParts(r filter.KeyRange) int {
+	start, end := r.Start.IndexParts(), r.End.IndexParts()
+	if len(start) == 0 || len(end) == 0 {
+		return 0
+	}
+	// the zeroth entry represents index key name
+	start, end = start[1:], end[1:]
+
+	var fixed int
+	for fixed < len(start) && fixed < len(end) {
+		if start[fixed] == keys.MaxIndexPart || !reflect.DeepEqual(start[fixed], end[fixed]) {
+			break
+		}
+		fixed++
+	}
+
+	return fixed
+}
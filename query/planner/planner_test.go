@@ -0,0 +1,306 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/query/sort"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+func testCollection(t *testing.T) *schema.DefaultCollection {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"pkey": {"type": "integer"},
+		"name": {"type": "string"},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	},
+	"primary_key": ["pkey"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+
+	return schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+}
+
+// testIndexName is the encoded name of the primary key index, it is the first part of the keys like the keys encoded
+// by the metadata encoder.
+const testIndexName = "pkey"
+
+func testKeyEncodingFunc(indexParts ...interface{}) (keys.Key, error) {
+	return keys.NewKey([]byte("t1"), append([]interface{}{testIndexName}, indexParts...)...), nil
+}
+
+func TestPlanner(t *testing.T) {
+	collection := testCollection(t)
+
+	cases := []struct {
+		userInput     []byte
+		searchEnabled bool
+		expPlan       PlanType
+		expResidual   bool
+	}{
+		{[]byte(`{}`), true, FullScanPlan, false},
+		{[]byte(`{"pkey": 1}`), true, PointLookupPlan, true},
+		{[]byte(`{"pkey": {"$in": [1, 2, 3]}, "name": "foo"}`), true, PointLookupPlan, true},
+		{[]byte(`{"pkey": {"$gt": 1}}`), true, RangeScanPlan, true},
+		{[]byte(`{"name": "foo"}`), true, SearchPlan, false},
+		{[]byte(`{"name": "foo"}`), false, FullScanPlan, true},
+		{[]byte(`{"tags": {"$size": 2}}`), true, FullScanPlan, true},
+	}
+	for _, c := range cases {
+		plan, err := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, c.searchEnabled).Plan(c.userInput)
+		require.NoError(t, err)
+		require.Equal(t, c.expPlan, plan.Type, string(c.userInput))
+		require.Equal(t, c.expResidual, plan.Residual != nil, string(c.userInput))
+	}
+}
+
+func TestPlannerCandidates(t *testing.T) {
+	collection := testCollection(t)
+
+	plan, err := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true).Plan([]byte(`{"pkey": {"$gte": 1, "$lt": 5}}`))
+	require.NoError(t, err)
+	require.Equal(t, RangeScanPlan, plan.Type)
+	require.Empty(t, plan.Keys)
+	require.Len(t, plan.Ranges, 1)
+	require.Equal(t, keys.NewKey([]byte("t1"), testIndexName, int64(1)), plan.Ranges[0].Start)
+
+	require.Len(t, plan.Candidates, 4)
+	require.Equal(t, PointLookupPlan, plan.Candidates[0].Type)
+	require.NotEmpty(t, plan.Candidates[0].Reason)
+	for _, c := range plan.Candidates[1:] {
+		require.Empty(t, c.Reason)
+		require.LessOrEqual(t, plan.Cost, c.Cost)
+	}
+
+	// "$or" on the primary key is scanned as multiple ranges
+	plan, err = NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true).Plan([]byte(`{"$or": [{"pkey": {"$lt": 1}}, {"pkey": {"$gt": 5}}]}`))
+	require.NoError(t, err)
+	require.Equal(t, RangeScanPlan, plan.Type)
+	require.Len(t, plan.Ranges, 2)
+
+	_, err = NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true).Plan([]byte(`{"foo": 1}`))
+	require.Error(t, err)
+}
+
+func TestPlannerSort(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"a": {"type": "integer"},
+		"b": {"type": "string"},
+		"c": {"type": "number"},
+		"d": {"type": "string"}
+	},
+	"primary_key": ["a", "b"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	collection := schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+
+	asc := func(name string) sort.SortField { return sort.SortField{Name: name, Ascending: true} }
+	desc := func(name string) sort.SortField { return sort.SortField{Name: name} }
+
+	cases := []struct {
+		userInput     []byte
+		ordering      sort.Ordering
+		expPlan       PlanType
+		expSort       SortType
+		expSearchSort string
+	}{
+		{[]byte(`{}`), sort.Ordering{asc("a"), asc("b")}, FullScanPlan, KeyOrderSort, ""},
+		{[]byte(`{}`), sort.Ordering{desc("a")}, FullScanPlan, ReverseKeyOrderSort, ""},
+		{[]byte(`{}`), sort.Ordering{desc("a"), desc("b"), asc("c")}, FullScanPlan, ReverseKeyOrderSort, ""},
+		{[]byte(`{}`), sort.Ordering{asc("a"), desc("b")}, FullScanPlan, InMemorySort, ""},
+		{[]byte(`{}`), sort.Ordering{asc("b")}, FullScanPlan, InMemorySort, ""},
+		{[]byte(`{"a": {"$gt": 1}}`), sort.Ordering{desc("a")}, RangeScanPlan, ReverseKeyOrderSort, ""},
+		{[]byte(`{"a": 1, "b": {"$gt": "x"}}`), sort.Ordering{desc("b")}, RangeScanPlan, ReverseKeyOrderSort, ""},
+		{[]byte(`{"a": 1, "b": {"$gt": "x"}}`), sort.Ordering{asc("b"), desc("a")}, RangeScanPlan, KeyOrderSort, ""},
+		{[]byte(`{"$or": [{"a": {"$lt": 1}}, {"a": {"$gt": 5}}]}`), sort.Ordering{asc("a")}, SearchPlan, SearchSort, "a:asc"},
+		{[]byte(`{"a": 1, "b": "x"}`), sort.Ordering{asc("a")}, PointLookupPlan, InMemorySort, ""},
+		{[]byte(`{"d": "x"}`), sort.Ordering{desc("c"), asc("a")}, SearchPlan, SearchSort, "c:desc,a:asc"},
+		{[]byte(`{"d": "x"}`), sort.Ordering{asc("b")}, SearchPlan, InMemorySort, ""},
+	}
+	for _, c := range cases {
+		p := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true)
+		plan, err := p.Plan(c.userInput)
+		require.NoError(t, err)
+		require.Equal(t, c.expPlan, plan.Type, string(c.userInput))
+
+		p.SetSort(plan, c.ordering)
+		require.Equal(t, c.expSort, plan.Sort, "%s %v", c.userInput, c.ordering)
+		require.Equal(t, c.expSearchSort, plan.SearchSort, "%s %v", c.userInput, c.ordering)
+	}
+}
+
+func TestPlannerSortSingleKeyField(t *testing.T) {
+	collection := testCollection(t)
+
+	asc := func(name string) sort.SortField { return sort.SortField{Name: name, Ascending: true} }
+	desc := func(name string) sort.SortField { return sort.SortField{Name: name} }
+
+	cases := []struct {
+		userInput []byte
+		ordering  sort.Ordering
+		expSort   SortType
+	}{
+		{[]byte(`{"pkey": {"$gt": 5}}`), sort.Ordering{desc("pkey")}, ReverseKeyOrderSort},
+		{[]byte(`{"pkey": {"$gt": 5}}`), sort.Ordering{asc("pkey")}, KeyOrderSort},
+		{[]byte(`{"pkey": {"$gte": 1, "$lt": 5}}`), sort.Ordering{desc("pkey"), asc("name")}, ReverseKeyOrderSort},
+		{[]byte(`{"pkey": {"$lt": 5}}`), sort.Ordering{asc("name")}, InMemorySort},
+	}
+	for _, c := range cases {
+		p := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, false)
+		plan, err := p.Plan(c.userInput)
+		require.NoError(t, err)
+		require.Equal(t, RangeScanPlan, plan.Type, string(c.userInput))
+
+		p.SetSort(plan, c.ordering)
+		require.Equal(t, c.expSort, plan.Sort, "%s %v", c.userInput, c.ordering)
+	}
+}
+
+func TestPlannerDateTimeKey(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"created": {"type": "string", "format": "date-time"}
+	},
+	"primary_key": ["created"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	collection := schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+
+	// the keys are the text of the documents, so they are not in the order of the time
+	p := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, false)
+	plan, err := p.Plan([]byte(`{"created": {"$gt": "2022-01-01T00:00:00Z"}}`))
+	require.NoError(t, err)
+	require.Equal(t, FullScanPlan, plan.Type)
+	require.NotNil(t, plan.Residual)
+
+	p.SetSort(plan, sort.Ordering{{Name: "created", Ascending: true}})
+	require.Equal(t, InMemorySort, plan.Sort)
+
+	plan, err = p.Plan([]byte(`{"created": "2022-01-01T00:00:00Z"}`))
+	require.NoError(t, err)
+	require.Equal(t, PointLookupPlan, plan.Type)
+	require.Equal(t, []keys.Key{keys.NewKey([]byte("t1"), testIndexName, "2022-01-01T00:00:00Z")}, plan.Keys)
+}
+
+func TestPlannerTypedKeyEqualityAcrossPlans(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"id": {"type": "string", "format": "uuid"},
+		"created": {"type": "string", "format": "date-time"}
+	},
+	"primary_key": ["id", "created"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	collection := schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+
+	doc := []byte(`{"id": "1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E", "created": "2022-01-01T00:00:00+00:00"}`)
+	docKey, err := testKeyEncodingFunc("1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E", "2022-01-01T00:00:00+00:00")
+	require.NoError(t, err)
+
+	cases := []struct {
+		userInput []byte
+		expMatch  bool
+	}{
+		{[]byte(`{"id": "1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E", "created": "2022-01-01T00:00:00+00:00"}`), true},
+		{[]byte(`{"id": "1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e", "created": "2022-01-01T00:00:00+00:00"}`), false},
+		{[]byte(`{"id": "1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E", "created": "2022-01-01T00:00:00Z"}`), false},
+	}
+	for _, c := range cases {
+		p := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true)
+		filters, err := filter.NewFactory(collection.Fields).Factorize(c.userInput)
+		require.NoError(t, err)
+
+		point, err := p.pointLookup(filters)
+		require.NoError(t, err)
+		var found bool
+		for _, k := range point.Keys {
+			found = found || reflect.DeepEqual(k, docKey)
+		}
+		require.Equal(t, c.expMatch, found && point.Residual.Matches(doc), string(c.userInput))
+
+		scan, err := p.fullScan(filters)
+		require.NoError(t, err)
+		require.Equal(t, c.expMatch, scan.Residual.Matches(doc), string(c.userInput))
+
+		// the search index has the text of the document, and the date time is not pushed down
+		_, err = p.search(filters)
+		require.Error(t, err, string(c.userInput))
+	}
+
+	// the search filter has the text of the filter, so it only matches the documents having the same text
+	filters, err := filter.NewFactory(collection.Fields).Factorize([]byte(`{"id": "1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e"}`))
+	require.NoError(t, err)
+	plan, err := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true).search(filters)
+	require.NoError(t, err)
+	require.Equal(t, "id:=`1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e`", plan.SearchFilter)
+}
+
+func TestPlannerSearchTiebreak(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"pkey": {"type": "integer"},
+		"n": {"type": "integer"},
+		"m": {"type": "integer"},
+		"c": {"type": "number"},
+		"name": {"type": "string"}
+	},
+	"primary_key": ["pkey"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	collection := schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+
+	asc := func(name string) sort.SortField { return sort.SortField{Name: name, Ascending: true} }
+	desc := func(name string) sort.SortField { return sort.SortField{Name: name} }
+
+	cases := []struct {
+		ordering      sort.Ordering
+		expSort       SortType
+		expSearchSort string
+	}{
+		{nil, "", "pkey:asc"},
+		{sort.Ordering{desc("n")}, SearchSort, "n:desc,pkey:asc"},
+		{sort.Ordering{desc("pkey"), asc("n")}, SearchSort, "pkey:desc,n:asc"},
+		// the search index can't sort on more fields
+		{sort.Ordering{asc("n"), desc("c"), asc("m")}, SearchSort, "n:asc,c:desc,m:asc"},
+		{sort.Ordering{asc("name")}, InMemorySort, ""},
+	}
+	for _, c := range cases {
+		p := NewPlanner(collection, []byte("t1"), testKeyEncodingFunc, true)
+		plan, err := p.Plan([]byte(`{"name": "x"}`))
+		require.NoError(t, err)
+		require.Equal(t, SearchPlan, plan.Type)
+
+		p.SetSort(plan, c.ordering)
+		require.Equal(t, c.expSort, plan.Sort, "%v", c.ordering)
+		require.Equal(t, c.expSearchSort, plan.SearchSort, "%v", c.ordering)
+	}
+}
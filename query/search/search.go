@@ -15,9 +15,39 @@
 package search
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
 	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+const (
+	searchAnd = "&&"
+	searchOr  = "||"
 )
 
+var rangeOps = map[string]string{
+	filter.GT:  ":>",
+	filter.GTE: ":>=",
+	filter.LT:  ":<",
+	filter.LTE: ":<=",
+}
+
+// equalityOps are the search operators of the equalities, "$ne" and "$nin" are only pushed down when negated. These
+// are exact matches, a ":" on a string field matches any document having the tokens of the value.
+var equalityOps = map[string]string{
+	filter.EQ:  ":=",
+	filter.NE:  ":=",
+	filter.IN:  ":=",
+	filter.NIN: ":=",
+}
+
 type Query struct{}
 
 type Spec struct {
@@ -25,19 +55,269 @@ type Spec struct {
 	Filter []filter.Filter
 }
 
-type Builder struct{}
+// NotPushdownError is returned by the Builder when a filter can't be expressed as a search filter. Instead of failing
+// the request, the caller is expected to evaluate the filter on the rows read from the database.
+type NotPushdownError struct {
+	Field  string
+	Reason string
+}
+
+func (e *NotPushdownError) Error() string {
+	return fmt.Sprintf("filter on field '%s' can't be pushed down to search, %s", e.Field, e.Reason)
+}
+
+func notPushdown(field string, format string, args ...interface{}) *NotPushdownError {
+	return &NotPushdownError{
+		Field:  field,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// IsNotPushdown returns true if the error is returned because the filter can't be expressed as a search filter.
+func IsNotPushdown(err error) bool {
+	var e *NotPushdownError
+	return errors.As(err, &e)
+}
+
+// Builder compiles the filters to the filter syntax of the search store i.e. typesense "filter_by". The conditions
+// are joined using "&&" and "||", a nested logical filter is wrapped in parentheses when it is joined using a
+// different operator than its parent. The values are formatted as per their type, and the strings are wrapped in
+// backticks so that the values having special characters like "," or "&&" are matched as it is.
+type Builder struct {
+	searchFields map[string]struct{}
+}
+
+// NewBuilder returns Builder for the fields of a collection. Only the fields and the flattened nested fields of the
+// objects are in the search index, so a filter on a path going through an array of objects is not pushed down.
+func NewBuilder(fields []*schema.Field) *Builder {
+	searchFields := make(map[string]struct{})
+	for _, f := range fields {
+		searchFields[f.FieldName] = struct{}{}
+		for _, nested := range schema.FlattenObjectField(f) {
+			searchFields[nested.FieldName] = struct{}{}
+		}
+	}
+
+	return &Builder{
+		searchFields: searchFields,
+	}
+}
+
+// expr is a compiled filter along with the logical operator that is joining its conditions, op is empty if the
+// expr is a single condition.
+type expr struct {
+	str string
+	op  filter.LogicalOP
+}
+
+// FromFilter returns the search filter for the filters, the top level filters are joined using "&&". A
+// NotPushdownError is returned if any condition can't be expressed as a search filter.
+func (b *Builder) FromFilter(filters []filter.Filter) (string, error) {
+	if len(filters) == 0 {
+		return "", nil
+	}
+
+	e, err := b.compileLogical(filter.AndOP, filters)
+	if err != nil {
+		return "", err
+	}
+
+	return e.str, nil
+}
+
+func (b *Builder) compile(f filter.Filter) (expr, error) {
+	switch t := f.(type) {
+	case *filter.Selector:
+		return b.compileMatcher(t.Field, t.FieldType, t.Matcher, false)
+	case *filter.AndFilter:
+		return b.compileLogical(filter.AndOP, t.GetFilters())
+	case *filter.OrFilter:
+		return b.compileLogical(filter.OrOP, t.GetFilters())
+	default:
+		return expr{}, notPushdown("", "unsupported filter '%v'", f)
+	}
+}
+
+func (b *Builder) compileLogical(op filter.LogicalOP, filters []filter.Filter) (expr, error) {
+	var parts []string
+	for _, f := range filters {
+		e, err := b.compile(f)
+		if err != nil {
+			return expr{}, err
+		}
+		if len(filters) == 1 {
+			return e, nil
+		}
+
+		if len(e.op) > 0 && e.op != op {
+			parts = append(parts, "("+e.str+")")
+		} else {
+			parts = append(parts, e.str)
+		}
+	}
+
+	joiner := searchAnd
+	if op == filter.OrOP {
+		joiner = searchOr
+	}
+	return expr{str: strings.Join(parts, joiner), op: op}, nil
+}
+
+// compileMatcher returns the search filter for the condition on the field. If negate is set then the condition is
+// negated. In search a comparison never matches a document that doesn't have the field, but the negations like "$ne",
+// "$nin" or "$not" with "$eq" match such documents, so these are not pushed down.
+func (b *Builder) compileMatcher(field string, fieldType schema.FieldType, matcher filter.ValueMatcher, negate bool) (expr, error) {
+	if _, ok := b.searchFields[field]; !ok {
+		return expr{}, notPushdown(field, "field is not in the search index")
+	}
 
-func NewBuilder() *Builder {
-	return &Builder{}
+	var op string
+	switch matcher.Type() {
+	case filter.EQ, filter.IN:
+		if negate {
+			return expr{}, notPushdown(field, "'$not' with '%s' is not supported", matcher.Type())
+		}
+		op = equalityOps[matcher.Type()]
+	case filter.NE, filter.NIN:
+		if !negate {
+			return expr{}, notPushdown(field, "'%s' is not supported", matcher.Type())
+		}
+		op = equalityOps[matcher.Type()]
+	case filter.GT, filter.GTE, filter.LT, filter.LTE:
+		if negate {
+			return expr{}, notPushdown(field, "'$not' with '%s' is not supported", matcher.Type())
+		}
+		op = rangeOps[matcher.Type()]
+	case filter.NOT:
+		not := matcher.(*filter.NotMatcher)
+		if negate || len(not.Matchers) != 1 {
+			return expr{}, notPushdown(field, "'$not' with multiple or nested operators is not supported")
+		}
+		return b.compileMatcher(field, fieldType, not.Matchers[0], true)
+	case filter.ALL:
+		return b.compileAll(field, matcher.(*filter.AllMatcher), negate)
+	case filter.ELEMMATCH:
+		return b.compileElemMatch(field, matcher.(*filter.ElemMatchMatcher), negate)
+	default:
+		return expr{}, notPushdown(field, "'%s' is not supported", matcher.Type())
+	}
+
+	v, err := b.literal(field, fieldType, matcher.GetValue())
+	if err != nil {
+		return expr{}, err
+	}
+	return expr{str: field + op + v}, nil
 }
 
-func (f *Builder) FromFilter(filters []filter.Filter) string {
-	var str string
-	for i, f := range filters {
-		str += f.ToSearchFilter()
-		if i < len(filters)-1 {
-			str += "&&"
+// compileAll returns the search filter for "$all", an equality on an array field in search matches if any element
+// of the array is equal to the value, so these equalities are joined using "&&".
+func (b *Builder) compileAll(field string, all *filter.AllMatcher, negate bool) (expr, error) {
+	if negate || len(*all.Values) == 0 {
+		return expr{}, notPushdown(field, "'%s' is not supported", all.Type())
+	}
+
+	var conditions []string
+	for _, v := range *all.Values {
+		str, err := b.literal(field, all.ItemType, v)
+		if err != nil {
+			return expr{}, err
 		}
+		conditions = append(conditions, field+":="+str)
 	}
-	return str
+	if len(conditions) == 1 {
+		return expr{str: conditions[0]}, nil
+	}
+	return expr{str: strings.Join(conditions, searchAnd), op: filter.AndOP}, nil
+}
+
+// compileElemMatch returns the search filter for "$elemMatch" on an array of primitive types. A comparison on an
+// array field in search matches if any element satisfies it, so a single operator can be used as it is, and a "$gte"
+// with "$lte" is translated to a range filter as both must be satisfied by the same element.
+func (b *Builder) compileElemMatch(field string, elemMatch *filter.ElemMatchMatcher, negate bool) (expr, error) {
+	if negate || elemMatch.Filter != nil {
+		return expr{}, notPushdown(field, "'%s' is not supported", elemMatch.Type())
+	}
+
+	switch len(elemMatch.Matchers) {
+	case 1:
+		switch elemMatch.Matchers[0].Type() {
+		case filter.EQ, filter.GT, filter.GTE, filter.LT, filter.LTE, filter.IN:
+			return b.compileMatcher(field, elemMatch.ItemType, elemMatch.Matchers[0], false)
+		}
+	case 2:
+		var lower, upper value.Value
+		for _, m := range elemMatch.Matchers {
+			switch m.Type() {
+			case filter.GTE:
+				lower = m.GetValue()
+			case filter.LTE:
+				upper = m.GetValue()
+			}
+		}
+		if lower != nil && upper != nil {
+			l, err := b.literal(field, elemMatch.ItemType, lower)
+			if err != nil {
+				return expr{}, err
+			}
+			u, err := b.literal(field, elemMatch.ItemType, upper)
+			if err != nil {
+				return expr{}, err
+			}
+			return expr{str: fmt.Sprintf("%s:[%s..%s]", field, l, u)}, nil
+		}
+	}
+
+	return expr{}, notPushdown(field, "'%s' with these operators is not supported", elemMatch.Type())
+}
+
+// literal returns the value formatted as per its type. The strings are wrapped in backticks, a string that has a
+// backtick can't be escaped so it is not pushed down. A double on an integer field is not pushed down as it is
+// compared differently by search.
+func (b *Builder) literal(field string, fieldType schema.FieldType, v value.Value) (string, error) {
+	switch t := v.(type) {
+	case *value.IntValue:
+		return strconv.FormatInt(int64(*t), 10), nil
+	case *value.DoubleValue:
+		if fieldType == schema.Int32Type || fieldType == schema.Int64Type {
+			// the value is either not integral or out of the range of the integers
+			return "", notPushdown(field, "value '%v' is not supported on an integer field", *t)
+		}
+		if math.IsNaN(float64(*t)) || math.IsInf(float64(*t), 0) {
+			return "", notPushdown(field, "value '%v' is not supported", *t)
+		}
+		return strconv.FormatFloat(float64(*t), 'f', -1, 64), nil
+	case *value.BoolValue:
+		return strconv.FormatBool(bool(*t)), nil
+	case *value.StringValue:
+		return b.quote(field, string(*t))
+	case *value.UUIDValue:
+		return b.quote(field, t.String())
+	case *value.DateTimeValue:
+		// the search index has the date time as the string that is in the document, so it can't be compared with
+		// the time
+		return "", notPushdown(field, "date time values are not supported")
+	case *value.BytesValue:
+		// bytes are indexed as base64 encoded string
+		return b.quote(field, base64.StdEncoding.EncodeToString([]byte(*t)))
+	case *value.ArrayValue:
+		var list []string
+		for _, item := range *t {
+			str, err := b.literal(field, fieldType, item)
+			if err != nil {
+				return "", err
+			}
+			list = append(list, str)
+		}
+		return "[" + strings.Join(list, ",") + "]", nil
+	default:
+		return "", notPushdown(field, "value '%v' is not supported", v)
+	}
+}
+
+func (b *Builder) quote(field string, str string) (string, error) {
+	if strings.Contains(str, "`") {
+		return "", notPushdown(field, "string with '`' is not supported")
+	}
+
+	return "`" + str + "`", nil
 }
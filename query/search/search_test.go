@@ -24,15 +24,178 @@ import (
 
 func TestSearchBuilder(t *testing.T) {
 	js := []byte(`{"a": 4, "$and": [{"int_value":1}, {"string_value1": "shoe"}]}`)
-	f := filter.NewFactory([]*schema.Field{
+	fields := []*schema.Field{
 		{FieldName: "a", DataType: schema.Int64Type},
 		{FieldName: "int_value", DataType: schema.Int64Type},
 		{FieldName: "string_value1", DataType: schema.StringType},
-	})
+	}
+	f := filter.NewFactory(fields)
 	filters, err := f.Factorize(js)
 	require.NoError(t, err)
 	require.Len(t, filters, 2)
 
-	b := Builder{}
-	require.Equal(t, "a:=4&&int_value:=1&&string_value1:=shoe", b.FromFilter(filters))
+	b := NewBuilder(fields)
+	searchFilter, err := b.FromFilter(filters)
+	require.NoError(t, err)
+	require.Equal(t, "a:=4&&int_value:=1&&string_value1:=`shoe`", searchFilter)
+}
+
+func TestSearchBuilderInOperators(t *testing.T) {
+	js := []byte(`{"a": {"$in": [1, 2, 3]}, "b": {"$not": {"$nin": ["foo", "bar"]}}}`)
+	fields := []*schema.Field{
+		{FieldName: "a", DataType: schema.Int64Type},
+		{FieldName: "b", DataType: schema.StringType},
+	}
+	f := filter.NewFactory(fields)
+	filters, err := f.Factorize(js)
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+
+	b := NewBuilder(fields)
+	searchFilter, err := b.FromFilter(filters)
+	require.NoError(t, err)
+	require.Equal(t, "a:=[1,2,3]&&b:=[`foo`,`bar`]", searchFilter)
+}
+
+func TestSearchBuilderNegation(t *testing.T) {
+	fields := []*schema.Field{
+		{FieldName: "a", DataType: schema.Int64Type},
+		{FieldName: "b", DataType: schema.StringType},
+	}
+	f := filter.NewFactory(fields)
+
+	cases := []struct {
+		userInput []byte
+		expFilter string
+		expError  error
+	}{
+		{[]byte(`{"a": {"$not": {"$ne": 1}}}`), "a:=1", nil},
+		{[]byte(`{"b": {"$not": {"$nin": ["foo"]}}}`), "b:=[`foo`]", nil},
+		// search doesn't match the documents without the field, so the negations can't be pushed down
+		{[]byte(`{"a": {"$ne": 1}}`), "", &NotPushdownError{Field: "a", Reason: "'$ne' is not supported"}},
+		{[]byte(`{"b": {"$nin": ["foo"]}}`), "", &NotPushdownError{Field: "b", Reason: "'$nin' is not supported"}},
+		{[]byte(`{"a": {"$not": {"$eq": 1}}}`), "", &NotPushdownError{Field: "a", Reason: "'$not' with '$eq' is not supported"}},
+		{[]byte(`{"b": {"$not": {"$in": ["foo"]}}}`), "", &NotPushdownError{Field: "b", Reason: "'$not' with '$in' is not supported"}},
+		{[]byte(`{"a": {"$not": {"$gt": 1}}}`), "", &NotPushdownError{Field: "a", Reason: "'$not' with '$gt' is not supported"}},
+		{[]byte(`{"a": {"$exists": true}}`), "", &NotPushdownError{Field: "a", Reason: "'$exists' is not supported"}},
+		{[]byte(`{"a": {"$not": {"$gt": 1, "$lt": 5}}}`), "", &NotPushdownError{Field: "a", Reason: "'$not' with multiple or nested operators is not supported"}},
+	}
+	for _, c := range cases {
+		filters, err := f.Factorize(c.userInput)
+		require.NoError(t, err)
+
+		b := NewBuilder(fields)
+		searchFilter, err := b.FromFilter(filters)
+		require.Equal(t, c.expError, err, string(c.userInput))
+		require.Equal(t, c.expFilter, searchFilter, string(c.userInput))
+	}
+}
+
+func TestSearchBuilderArrayOperators(t *testing.T) {
+	fields := []*schema.Field{
+		{FieldName: "tags", DataType: schema.ArrayType, Fields: []*schema.Field{
+			{DataType: schema.StringType},
+		}},
+		{FieldName: "scores", DataType: schema.ArrayType, Fields: []*schema.Field{
+			{DataType: schema.Int64Type},
+		}},
+		{FieldName: "items", DataType: schema.ArrayType, Fields: []*schema.Field{
+			{FieldName: "name", DataType: schema.StringType},
+			{FieldName: "quantity", DataType: schema.Int64Type},
+		}},
+	}
+	f := filter.NewFactory(fields)
+
+	cases := []struct {
+		userInput []byte
+		expFilter string
+		expError  error
+	}{
+		{[]byte(`{"tags": {"$all": ["red", "blue"]}}`), "tags:=`red`&&tags:=`blue`", nil},
+		{[]byte(`{"scores": {"$elemMatch": {"$gt": 80}}}`), "scores:>80", nil},
+		{[]byte(`{"scores": {"$elemMatch": {"$gte": 80, "$lte": 90}}}`), "scores:[80..90]", nil},
+		{[]byte(`{"scores": {"$elemMatch": {"$gt": 80, "$lt": 90}}}`), "", &NotPushdownError{Field: "scores", Reason: "'$elemMatch' with these operators is not supported"}},
+		{[]byte(`{"tags": {"$size": 2}}`), "", &NotPushdownError{Field: "tags", Reason: "'$size' is not supported"}},
+		{[]byte(`{"items": {"$elemMatch": {"name": "shoe"}}}`), "", &NotPushdownError{Field: "items", Reason: "'$elemMatch' is not supported"}},
+		// the fields of the objects of an array are not flattened in the search index
+		{[]byte(`{"items.name": "shoe"}`), "", &NotPushdownError{Field: "items.name", Reason: "field is not in the search index"}},
+		{[]byte(`{"items.quantity": {"$gt": 1}}`), "", &NotPushdownError{Field: "items.quantity", Reason: "field is not in the search index"}},
+	}
+	for _, c := range cases {
+		filters, err := f.Factorize(c.userInput)
+		require.NoError(t, err)
+
+		b := NewBuilder(fields)
+		searchFilter, err := b.FromFilter(filters)
+		require.Equal(t, c.expError, err, string(c.userInput))
+		require.Equal(t, c.expFilter, searchFilter, string(c.userInput))
+	}
+}
+
+func TestSearchBuilderNestedFields(t *testing.T) {
+	fields := []*schema.Field{
+		{FieldName: "address", DataType: schema.ObjectType, Fields: []*schema.Field{
+			{FieldName: "city", DataType: schema.StringType},
+			{FieldName: "geo", DataType: schema.ObjectType, Fields: []*schema.Field{
+				{FieldName: "zip", DataType: schema.Int64Type},
+			}},
+		}},
+	}
+	f := filter.NewFactory(fields)
+
+	filters, err := f.Factorize([]byte(`{"address.city": "sf", "address.geo.zip": {"$gt": 100}}`))
+	require.NoError(t, err)
+	searchFilter, err := NewBuilder(fields).FromFilter(filters)
+	require.NoError(t, err)
+	require.Equal(t, "address.city:=`sf`&&address.geo.zip:>100", searchFilter)
+
+	// the builder of the other collection doesn't have the fields
+	_, err = NewBuilder(nil).FromFilter(filters)
+	require.Equal(t, &NotPushdownError{Field: "address.city", Reason: "field is not in the search index"}, err)
+}
+
+func TestSearchBuilderLogical(t *testing.T) {
+	fields := []*schema.Field{
+		{FieldName: "a", DataType: schema.Int64Type},
+		{FieldName: "b", DataType: schema.StringType},
+		{FieldName: "c", DataType: schema.DoubleType},
+		{FieldName: "d", DataType: schema.BoolType},
+		{FieldName: "tags", DataType: schema.ArrayType, Fields: []*schema.Field{
+			{DataType: schema.StringType},
+		}},
+	}
+	f := filter.NewFactory(fields)
+
+	cases := []struct {
+		userInput []byte
+		expFilter string
+	}{
+		{[]byte(`{"$or": [{"a": 1}, {"b": "foo"}]}`), "a:=1||b:=`foo`"},
+		{[]byte(`{"d": true, "$or": [{"a": 1}, {"b": "foo"}]}`), "d:=true&&(a:=1||b:=`foo`)"},
+		{[]byte(`{"$or": [{"a": 1}, {"$and": [{"b": "foo"}, {"c": {"$gt": 1.5}}]}]}`), "a:=1||(b:=`foo`&&c:>1.5)"},
+		{[]byte(`{"$or": [{"a": {"$gt": 1, "$lt": 5}}, {"$or": [{"b": "x"}, {"b": "y"}]}]}`), "(a:>1&&a:<5)||b:=`x`||b:=`y`"},
+		{[]byte(`{"$or": [{"tags": {"$all": ["x", "y"]}}, {"a": 2}]}`), "(tags:=`x`&&tags:=`y`)||a:=2"},
+		{[]byte(`{"b": "foo, bar && (baz)"}`), "b:=`foo, bar && (baz)`"},
+		{[]byte(`{"c": 100000000000000000000}`), "c:=100000000000000000000"},
+		{[]byte(`{"a": {"$gt": 1.5, "$lte": 4.5}}`), "a:>=2&&a:<=4"},
+	}
+	for _, c := range cases {
+		filters, err := f.Factorize(c.userInput)
+		require.NoError(t, err)
+
+		searchFilter, err := NewBuilder(fields).FromFilter(filters)
+		require.NoError(t, err, string(c.userInput))
+		require.Equal(t, c.expFilter, searchFilter, string(c.userInput))
+	}
+
+	filters, err := f.Factorize([]byte(`{"a": 1.5}`))
+	require.NoError(t, err)
+	_, err = NewBuilder(fields).FromFilter(filters)
+	require.Equal(t, &NotPushdownError{Field: "a", Reason: "value '1.5' is not supported on an integer field"}, err)
+
+	filters, err = f.Factorize([]byte(`{"$or": [{"a": 1}, {"b": "foo` + "`" + `"}]}`))
+	require.NoError(t, err)
+	_, err = NewBuilder(fields).FromFilter(filters)
+	require.True(t, IsNotPushdown(err))
+	require.Equal(t, &NotPushdownError{Field: "b", Reason: "string with '`' is not supported"}, err)
 }
@@ -0,0 +1,189 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sort
+
+import (
+	"strings"
+
+	"github.com/buger/jsonparser"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+const (
+	ascending  = "$asc"
+	descending = "$desc"
+)
+
+// SortField is a field that the documents are sorted on, the Name can be the path of a nested field i.e. "address.city".
+type SortField struct {
+	Name      string
+	Ascending bool
+}
+
+// Ordering is the list of fields that the documents are sorted on, a field is only used to order the documents that
+// have the same values for all the fields before it.
+type Ordering []SortField
+
+// UnmarshalSort parses the sort passed in the request, it is an array of objects each having a single field with its
+// direction,
+//    [{"<field1>": "$asc"}, {"<field2>": "$desc"}]
+func UnmarshalSort(input []byte) (Ordering, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+
+	invalid := api.Errorf(api.Code_INVALID_ARGUMENT, "sort needs an array of fields with '%s' or '%s'", ascending, descending)
+	if _, dataType, _, err := jsonparser.Get(input); err != nil || dataType != jsonparser.Array {
+		return nil, invalid
+	}
+
+	var ordering Ordering
+	var itemErr error
+	seen := make(map[string]struct{})
+	_, err := jsonparser.ArrayEach(input, func(item []byte, dataType jsonparser.ValueType, _ int, _ error) {
+		if itemErr != nil {
+			return
+		}
+		if dataType != jsonparser.Object {
+			itemErr = invalid
+			return
+		}
+
+		var fields int
+		itemErr = jsonparser.ObjectEach(item, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+			fields++
+			if dataType != jsonparser.String || (string(v) != ascending && string(v) != descending) {
+				return invalid
+			}
+			if _, ok := seen[string(key)]; ok {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "sort field '%s' is used more than once", string(key))
+			}
+			seen[string(key)] = struct{}{}
+
+			ordering = append(ordering, SortField{Name: string(key), Ascending: string(v) == ascending})
+			return nil
+		})
+		if itemErr == nil && fields != 1 {
+			itemErr = invalid
+		}
+	})
+	if itemErr != nil {
+		return nil, itemErr
+	}
+	if err != nil {
+		return nil, invalid
+	}
+
+	return ordering, nil
+}
+
+// IsSortable returns true if the documents can be sorted on the field of this type.
+func IsSortable(fieldType schema.FieldType) bool {
+	switch fieldType {
+	case schema.BoolType, schema.Int32Type, schema.Int64Type, schema.DoubleType, schema.StringType, schema.ByteType,
+		schema.UUIDType, schema.DateTimeType:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sorter compares the documents as per the ordering. The values are compared as per the type of the field, and a
+// missing or null value is lower than any other value.
+type Sorter struct {
+	keys []sortKey
+}
+
+type sortKey struct {
+	path      []string
+	fieldType schema.FieldType
+	ascending bool
+}
+
+// NewSorter returns a Sorter for the ordering, an error is returned if a field doesn't exist in the schema or the
+// documents can't be sorted on it.
+func NewSorter(ordering Ordering, fields []*schema.Field) (*Sorter, error) {
+	s := &Sorter{}
+	for _, sf := range ordering {
+		field := schema.GetField(fields, sf.Name)
+		if field == nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "sort field '%s' doesn't exist in the schema", sf.Name)
+		}
+		if !IsSortable(field.Type()) {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "sort on field '%s' of type '%s' is not supported", sf.Name, schema.FieldNames[field.Type()])
+		}
+
+		s.keys = append(s.keys, sortKey{
+			path:      strings.Split(sf.Name, schema.FieldPathSeparator),
+			fieldType: field.Type(),
+			ascending: sf.Ascending,
+		})
+	}
+
+	return s, nil
+}
+
+// Values returns the values of the sort fields in the document, a nil value is returned for a missing field.
+func (s *Sorter) Values(doc []byte) ([]value.Value, error) {
+	values := make([]value.Value, len(s.keys))
+	for i, k := range s.keys {
+		v, dataType, _, err := jsonparser.Get(doc, k.path...)
+		if err == jsonparser.KeyPathNotFoundError || (err == nil && dataType == jsonparser.Null) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if values[i], err = value.NewValue(k.fieldType, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// Compare returns a negative number if the document having the values a sorts before the document having the values b,
+// a positive number if it sorts after it and zero if the order of the documents is not defined by the ordering.
+func (s *Sorter) Compare(a []value.Value, b []value.Value) int {
+	for i, k := range s.keys {
+		var res int
+		switch {
+		case a[i] == nil && b[i] == nil:
+			continue
+		case a[i] == nil:
+			res = -1
+		case b[i] == nil:
+			res = 1
+		default:
+			var err error
+			if res, err = a[i].CompareTo(b[i]); err != nil {
+				// the values of a field always have the same type
+				continue
+			}
+		}
+
+		if res != 0 {
+			if !k.ascending {
+				return -res
+			}
+			return res
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sort
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+func TestUnmarshalSort(t *testing.T) {
+	cases := []struct {
+		input    []byte
+		expected Ordering
+		expError error
+	}{
+		{
+			[]byte(`[{"a": "$asc"}, {"b.c": "$desc"}]`),
+			Ordering{{Name: "a", Ascending: true}, {Name: "b.c", Ascending: false}},
+			nil,
+		},
+		{
+			nil,
+			nil,
+			nil,
+		},
+		{
+			[]byte(`{"a": "$asc"}`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "sort needs an array of fields with '$asc' or '$desc'"),
+		},
+		{
+			[]byte(`[{"a": "asc"}]`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "sort needs an array of fields with '$asc' or '$desc'"),
+		},
+		{
+			[]byte(`[{"a": "$asc", "b": "$asc"}]`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "sort needs an array of fields with '$asc' or '$desc'"),
+		},
+		{
+			[]byte(`[{"a": "$asc"}, {"a": "$desc"}]`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "sort field 'a' is used more than once"),
+		},
+	}
+	for _, c := range cases {
+		ordering, err := UnmarshalSort(c.input)
+		require.Equal(t, c.expError, err, string(c.input))
+		require.Equal(t, c.expected, ordering, string(c.input))
+	}
+}
+
+func TestSorter(t *testing.T) {
+	fields := []*schema.Field{
+		{FieldName: "a", DataType: schema.Int64Type},
+		{FieldName: "b", DataType: schema.ObjectType, Fields: []*schema.Field{{FieldName: "c", DataType: schema.StringType}}},
+		{FieldName: "d", DataType: schema.ArrayType},
+	}
+
+	_, err := NewSorter(Ordering{{Name: "x", Ascending: true}}, fields)
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "sort field 'x' doesn't exist in the schema"), err)
+	_, err = NewSorter(Ordering{{Name: "d", Ascending: true}}, fields)
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "sort on field 'd' of type 'array' is not supported"), err)
+
+	sorter, err := NewSorter(Ordering{{Name: "a", Ascending: true}, {Name: "b.c", Ascending: false}}, fields)
+	require.NoError(t, err)
+
+	compare := func(a string, b string) int {
+		aValues, err := sorter.Values([]byte(a))
+		require.NoError(t, err)
+		bValues, err := sorter.Values([]byte(b))
+		require.NoError(t, err)
+		return sorter.Compare(aValues, bValues)
+	}
+	require.Less(t, compare(`{"a": 1, "b": {"c": "x"}}`, `{"a": 2, "b": {"c": "a"}}`), 0)
+	require.Less(t, compare(`{"a": 1, "b": {"c": "x"}}`, `{"a": 1, "b": {"c": "a"}}`), 0)
+	require.Greater(t, compare(`{"a": 1, "b": {"c": "a"}}`, `{"a": 1, "b": {"c": "x"}}`), 0)
+	require.Equal(t, 0, compare(`{"a": 1, "b": {"c": "a"}}`, `{"a": 1, "b": {"c": "a"}}`))
+	// missing and null values sort first
+	require.Less(t, compare(`{"b": {"c": "a"}}`, `{"a": -10}`), 0)
+	require.Less(t, compare(`{"a": null}`, `{"a": -10}`), 0)
+	// for a descending field the missing values are last
+	require.Greater(t, compare(`{"a": 1}`, `{"a": 1, "b": {"c": "a"}}`), 0)
+}
@@ -0,0 +1,295 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+const (
+	each  = "$each"
+	slice = "$slice"
+)
+
+// arrayOperand is the parsed value passed for an array field to one of the array operators.
+type arrayOperand struct {
+	path  []string
+	field *schema.Field
+	// items are the json encoded elements added by $push and $addToSet.
+	items []jsoniter.RawMessage
+	// slice is the "$slice" modifier of $push, positive keeps the first elements and negative keeps the last elements.
+	slice *int64
+	// matcher finds the elements removed by $pull.
+	matcher *filter.ElemMatchMatcher
+	// first is set if $pop removes the first element instead of the last one.
+	first bool
+}
+
+// buildArrayOperands parses the document passed to the array operators,
+//    { "$push": { <field1>: <value1>, <field2>: { "$each": [ <value1>, ... ], "$slice": <num> } } }
+//    { "$addToSet": { <field1>: <value1>, <field2>: { "$each": [ <value1>, ... ] } } }
+//    { "$pull": { <field1>: <value1>, <field2>: <conditions> } }
+//    { "$pop": { <field1>: 1, <field2>: -1 } }
+func (f *FieldOperator) buildArrayOperands(fields []*schema.Field) error {
+	if _, dataType, _, err := jsonparser.Get(f.Document); err != nil || dataType != jsonparser.Object {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with fields and values", f.Op)
+	}
+
+	err := jsonparser.ObjectEach(f.Document, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+		field, err := arrayField(fields, string(key), f.Op)
+		if err != nil {
+			return err
+		}
+
+		o := &arrayOperand{
+			path:  strings.Split(string(key), schema.FieldPathSeparator),
+			field: field,
+		}
+		raw := rawValue(v, dataType)
+		switch f.Op {
+		case Push, AddToSet:
+			err = o.buildItems(f.Op, raw, dataType)
+		case Pull:
+			err = o.buildMatcher(raw, v, dataType)
+		case Pop:
+			pop, err := strconv.ParseInt(string(v), 10, 64)
+			if dataType != jsonparser.Number || err != nil || (pop != 1 && pop != -1) {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs 1 or -1 for field '%s'", f.Op, string(key))
+			}
+			o.first = pop == -1
+		}
+		if err != nil {
+			return err
+		}
+
+		f.arrayOperands = append(f.arrayOperands, o)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(f.arrayOperands) == 0 {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with fields and values", f.Op)
+	}
+
+	return nil
+}
+
+// arrayField returns the array field for the path. The path can refer to the arrays nested in objects but not to the
+// arrays nested in another array.
+func arrayField(fields []*schema.Field, path string, op FieldOPType) (*schema.Field, error) {
+	field := schema.GetField(fields, path)
+	if field == nil {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "updating non schema field '%s'", path)
+	}
+	if field.Type() != schema.ArrayType {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is only supported on array fields, found '%s'", op, path)
+	}
+
+	if nestedInArray(fields, path) {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not supported on field '%s' nested in an array", op, path)
+	}
+
+	return field, nil
+}
+
+// buildItems parses the value of $push and $addToSet, it is either a single element or the elements passed in "$each".
+func (o *arrayOperand) buildItems(op FieldOPType, raw []byte, dataType jsonparser.ValueType) error {
+	if dataType != jsonparser.Object {
+		o.items = []jsoniter.RawMessage{raw}
+		return nil
+	}
+
+	var modifiers map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(raw, &modifiers); err != nil {
+		return err
+	}
+	if _, ok := modifiers[each]; !ok {
+		// an object is added to an array of objects
+		o.items = []jsoniter.RawMessage{raw}
+		return nil
+	}
+
+	path := strings.Join(o.path, schema.FieldPathSeparator)
+	for k, v := range modifiers {
+		switch {
+		case k == each:
+			if err := jsoniter.Unmarshal(v, &o.items); err != nil {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of values for field '%s'", each, path)
+			}
+		case k == slice && op == Push:
+			n, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an integer for field '%s'", slice, path)
+			}
+			o.slice = &n
+		default:
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported modifier '%s' with '%s'", k, op)
+		}
+	}
+
+	return nil
+}
+
+// buildMatcher parses the value of $pull. For an array of primitive types it is either the value of the elements that
+// are removed or the conditions on the elements. For an array of objects it is a filter on the fields of the objects.
+func (o *arrayOperand) buildMatcher(raw []byte, v []byte, dataType jsonparser.ValueType) error {
+	conditions := raw
+	switch dataType {
+	case jsonparser.Object:
+	case jsonparser.Boolean, jsonparser.Number, jsonparser.String:
+		if o.field.ItemField() == nil {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with conditions for field '%s'", Pull, o.field.FieldName)
+		}
+		conditions = []byte(`{"` + filter.EQ + `": ` + string(raw) + `}`)
+	default:
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' doesn't support value '%s'", Pull, string(v))
+	}
+
+	var err error
+	o.matcher, err = filter.BuildElemMatcher(o.field, conditions)
+	return err
+}
+
+// applyArray applies the operator on the array fields of the document. A missing array is treated as an empty array.
+func (f *FieldOperator) applyArray(doc []byte) ([]byte, error) {
+	for _, o := range f.arrayOperands {
+		var items []jsoniter.RawMessage
+		existing, dataType, _, err := jsonparser.Get(doc, o.path...)
+		switch {
+		case err == jsonparser.KeyPathNotFoundError || (err == nil && dataType == jsonparser.Null):
+		case err != nil:
+			return nil, err
+		case dataType != jsonparser.Array:
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' is not an array", strings.Join(o.path, schema.FieldPathSeparator))
+		default:
+			if err = jsoniter.Unmarshal(existing, &items); err != nil {
+				return nil, err
+			}
+		}
+
+		switch f.Op {
+		case Push:
+			items = append(items, o.items...)
+			items = sliceItems(items, o.slice)
+		case AddToSet:
+			for _, item := range o.items {
+				if !containsItem(o.field, items, item) {
+					items = append(items, item)
+				}
+			}
+		case Pull:
+			var retained []jsoniter.RawMessage
+			for _, item := range items {
+				v, dataType, _, err := jsonparser.Get(item)
+				if err != nil || !o.matcher.MatchesElement(v, dataType) {
+					retained = append(retained, item)
+				}
+			}
+			items = retained
+		case Pop:
+			if len(items) == 0 {
+				continue
+			}
+			if o.first {
+				items = items[1:]
+			} else {
+				items = items[:len(items)-1]
+			}
+		}
+
+		if items == nil {
+			items = []jsoniter.RawMessage{}
+		}
+		array, err := jsoniter.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = jsonparser.Set(doc, array, o.path...); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// sliceItems keeps the first n elements if n is positive and the last n elements if n is negative.
+func sliceItems(items []jsoniter.RawMessage, n *int64) []jsoniter.RawMessage {
+	switch {
+	case n == nil:
+		return items
+	case *n >= 0 && int(*n) < len(items):
+		return items[:*n]
+	case *n < 0 && int(-*n) < len(items):
+		return items[len(items)+int(*n):]
+	}
+
+	return items
+}
+
+// containsItem returns true if an element of the array is equal to the item. The elements of an array of primitive
+// types are compared as values of the item type, other elements are compared after decoding them.
+func containsItem(field *schema.Field, items []jsoniter.RawMessage, item jsoniter.RawMessage) bool {
+	for _, existing := range items {
+		if bytes.Equal(existing, item) || equalItems(field.ItemField(), existing, item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equalItems(itemField *schema.Field, a jsoniter.RawMessage, b jsoniter.RawMessage) bool {
+	if itemField != nil {
+		aRaw, _, _, errA := jsonparser.Get(a)
+		bRaw, _, _, errB := jsonparser.Get(b)
+		if errA == nil && errB == nil {
+			aValue, errA := value.NewValue(itemField.DataType, aRaw)
+			bValue, errB := value.NewValue(itemField.DataType, bRaw)
+			if errA == nil && errB == nil {
+				cmp, err := aValue.CompareTo(bValue)
+				return err == nil && cmp == 0
+			}
+		}
+	}
+
+	var aDecoded, bDecoded interface{}
+	if err := jsoniter.Unmarshal(a, &aDecoded); err != nil {
+		return false
+	}
+	if err := jsoniter.Unmarshal(b, &bDecoded); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(aDecoded, bDecoded)
+}
+
+// rawValue returns the json encoded value, the strings returned by jsonparser are without the quotes.
+func rawValue(v []byte, dataType jsonparser.ValueType) []byte {
+	if dataType == jsonparser.String {
+		return []byte(`"` + string(v) + `"`)
+	}
+
+	return v
+}
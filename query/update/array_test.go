@@ -0,0 +1,129 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+func testArrayFields() []*schema.Field {
+	return []*schema.Field{
+		{FieldName: "a", DataType: schema.Int64Type},
+		{FieldName: "tags", DataType: schema.ArrayType, Fields: []*schema.Field{{DataType: schema.StringType}}},
+		{FieldName: "scores", DataType: schema.ArrayType, Fields: []*schema.Field{{DataType: schema.DoubleType}}},
+		{FieldName: "items", DataType: schema.ArrayType, Fields: []*schema.Field{
+			{FieldName: "id", DataType: schema.Int64Type},
+			{FieldName: "product", DataType: schema.StringType},
+			{FieldName: "labels", DataType: schema.ArrayType, Fields: []*schema.Field{{DataType: schema.StringType}}},
+		}},
+		{FieldName: "d", DataType: schema.ObjectType, Fields: []*schema.Field{
+			{FieldName: "tags", DataType: schema.ArrayType, Fields: []*schema.Field{{DataType: schema.StringType}}},
+		}},
+	}
+}
+
+func TestMergeAndGet_Array(t *testing.T) {
+	existingDoc := []byte(`{"a": 1, "tags": ["a", "b"], "scores": [1, 2.5, 3], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": ["x"]}}`)
+	cases := []struct {
+		reqInput  []byte
+		outputDoc string
+	}{
+		{
+			[]byte(`{"$push": {"tags": "c", "d.tags": "y"}}`),
+			`{"a": 1, "tags": ["a", "b", "c"], "scores": [1, 2.5, 3], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": ["x", "y"]}}`,
+		}, {
+			[]byte(`{"$push": {"tags": {"$each": ["c", "d", "e"], "$slice": -3}, "items": {"id": 3, "product": "baz"}}}`),
+			`{"a": 1, "tags": ["c", "d", "e"], "scores": [1, 2.5, 3], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}, {"id": 3, "product": "baz"}], "d": {"tags": ["x"]}}`,
+		}, {
+			[]byte(`{"$push": {"scores": {"$each": [4], "$slice": 2}}}`),
+			`{"a": 1, "tags": ["a", "b"], "scores": [1, 2.5], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": ["x"]}}`,
+		}, {
+			[]byte(`{"$addToSet": {"tags": {"$each": ["b", "c", "c"]}, "scores": 1.0, "items": {"product": "bar", "id": 2}}}`),
+			`{"a": 1, "tags": ["a", "b", "c"], "scores": [1, 2.5, 3], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": ["x"]}}`,
+		}, {
+			[]byte(`{"$pull": {"tags": "a", "scores": {"$gt": 2}, "items": {"product": "foo"}}}`),
+			`{"a": 1, "tags": ["b"], "scores": [1], "items": [{"id": 2, "product": "bar"}], "d": {"tags": ["x"]}}`,
+		}, {
+			[]byte(`{"$pull": {"d.tags": "x"}}`),
+			`{"a": 1, "tags": ["a", "b"], "scores": [1, 2.5, 3], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": []}}`,
+		}, {
+			[]byte(`{"$pop": {"tags": -1, "scores": 1}}`),
+			`{"a": 1, "tags": ["b"], "scores": [1, 2.5], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": ["x"]}}`,
+		}, {
+			[]byte(`{"$set": {"a": 2}, "$push": {"tags": "c"}, "$pull": {"scores": 1}}`),
+			`{"a": 2, "tags": ["a", "b", "c"], "scores": [2.5, 3], "items": [{"id": 1, "product": "foo"}, {"id": 2, "product": "bar"}], "d": {"tags": ["x"]}}`,
+		},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, testArrayFields())
+		require.NoError(t, err, string(c.reqInput))
+
+		actualOut, err := f.MergeAndGet(existingDoc)
+		require.NoError(t, err, string(c.reqInput))
+		require.JSONEq(t, c.outputDoc, string(actualOut), string(c.reqInput))
+	}
+}
+
+func TestMergeAndGet_ArrayMissingFields(t *testing.T) {
+	cases := []struct {
+		reqInput  []byte
+		outputDoc string
+	}{
+		{[]byte(`{"$push": {"tags": "a"}}`), `{"a": 1, "tags": ["a"]}`},
+		{[]byte(`{"$addToSet": {"d.tags": "a"}}`), `{"a": 1, "d": {"tags": ["a"]}}`},
+		{[]byte(`{"$pull": {"tags": "a"}}`), `{"a": 1, "tags": []}`},
+		{[]byte(`{"$pop": {"tags": 1}}`), `{"a": 1}`},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, testArrayFields())
+		require.NoError(t, err, string(c.reqInput))
+
+		actualOut, err := f.MergeAndGet([]byte(`{"a": 1}`))
+		require.NoError(t, err, string(c.reqInput))
+		require.JSONEq(t, c.outputDoc, string(actualOut), string(c.reqInput))
+	}
+
+	f, err := BuildFieldOperators([]byte(`{"$push": {"tags": "a"}}`), testArrayFields())
+	require.NoError(t, err)
+	_, err = f.MergeAndGet([]byte(`{"tags": "a"}`))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "field 'tags' is not an array"), err)
+}
+
+func TestBuildFieldOperators_ArrayErrors(t *testing.T) {
+	cases := []struct {
+		reqInput []byte
+		expErr   error
+	}{
+		{[]byte(`{"$push": ["a"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$push' needs an object with fields and values")},
+		{[]byte(`{"$push": {"x": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "updating non schema field 'x'")},
+		{[]byte(`{"$push": {"a": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$push' is only supported on array fields, found 'a'")},
+		{[]byte(`{"$push": {"items.labels": "a"}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$push' is not supported on field 'items.labels' nested in an array")},
+		{[]byte(`{"$push": {"tags": {"$each": "a"}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$each' needs an array of values for field 'tags'")},
+		{[]byte(`{"$push": {"tags": {"$each": ["a"], "$slice": "1"}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$slice' needs an integer for field 'tags'")},
+		{[]byte(`{"$addToSet": {"tags": {"$each": ["a"], "$slice": 1}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported modifier '$slice' with '$addToSet'")},
+		{[]byte(`{"$pull": {"items": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$pull' needs an object with conditions for field 'items'")},
+		{[]byte(`{"$pull": {"tags": ["a"]}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$pull' doesn't support value '[\"a\"]'")},
+		{[]byte(`{"$pull": {"items": {"x": 1}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "querying on non schema field 'x'")},
+		{[]byte(`{"$pop": {"tags": 2}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$pop' needs 1 or -1 for field 'tags'")},
+	}
+	for _, c := range cases {
+		_, err := BuildFieldOperators(c.reqInput, testArrayFields())
+		require.Equal(t, c.expErr, err, string(c.reqInput))
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/value"
+)
+
+// operand is the value passed for a field to one of the numeric operators.
+type operand struct {
+	path  []string
+	field *schema.Field
+	// raw is the json encoded value, it is used as it is when the operator replaces the value of the field.
+	raw   []byte
+	value value.Value
+}
+
+// buildOperands parses the document passed to $increment, $decrement, $multiply, $min or $max i.e.
+// { "$increment": { <field1>: <value1>, ... } }. The values are converted using the type of the field in the schema.
+func (f *FieldOperator) buildOperands(fields []*schema.Field) error {
+	if _, dataType, _, err := jsonparser.Get(f.Document); err != nil || dataType != jsonparser.Object {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with fields and values", f.Op)
+	}
+
+	err := jsonparser.ObjectEach(f.Document, func(key []byte, v []byte, dataType jsonparser.ValueType, _ int) error {
+		field := schema.GetField(fields, string(key))
+		if field == nil {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "updating non schema field '%s'", string(key))
+		}
+		if err := checkNotPrimaryKey(fields, string(key), f.Op); err != nil {
+			return err
+		}
+		if !supportsNumericOperator(f.Op, field.DataType) {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not supported on field '%s' of type '%s'", f.Op, string(key), schema.FieldNames[field.DataType])
+		}
+
+		stringField := field.DataType == schema.StringType || field.DataType == schema.DateTimeType
+		if (dataType == jsonparser.String) != stringField || (!stringField && dataType != jsonparser.Number) {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs a value of type '%s' for field '%s'", f.Op, schema.FieldNames[field.DataType], string(key))
+		}
+
+		val, err := value.NewValue(field.DataType, v)
+		if err != nil {
+			return err
+		}
+		if _, ok := val.(*value.DoubleValue); ok && field.DataType != schema.DoubleType {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an integer value for field '%s'", f.Op, string(key))
+		}
+
+		f.operands = append(f.operands, &operand{
+			path:  strings.Split(string(key), schema.FieldPathSeparator),
+			field: field,
+			raw:   rawValue(v, dataType),
+			value: val,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(f.operands) == 0 {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with fields and values", f.Op)
+	}
+
+	return nil
+}
+
+// supportsNumericOperator returns true if the operator can be applied on the field type. The arithmetic operators are
+// only supported on numbers, $min and $max also work on the types that can be compared.
+func supportsNumericOperator(op FieldOPType, fieldType schema.FieldType) bool {
+	switch fieldType {
+	case schema.Int32Type, schema.Int64Type, schema.DoubleType:
+		return true
+	case schema.StringType, schema.DateTimeType:
+		return op == Min || op == Max
+	default:
+		return false
+	}
+}
+
+// applyNumeric applies the operator on the fields of the document. A field that is not present in the document is
+// treated as zero by the arithmetic operators and is set to the value by $min and $max.
+func (f *FieldOperator) applyNumeric(doc []byte) ([]byte, error) {
+	for _, o := range f.operands {
+		var current value.Value
+		existing, dataType, _, err := jsonparser.Get(doc, o.path...)
+		switch {
+		case err == jsonparser.KeyPathNotFoundError || (err == nil && dataType == jsonparser.Null):
+		case err != nil:
+			return nil, err
+		default:
+			if current, err = value.NewValue(o.field.DataType, existing); err != nil {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' has a value '%s' that is not a '%s'", strings.Join(o.path, schema.FieldPathSeparator), existing, schema.FieldNames[o.field.DataType])
+			}
+		}
+
+		result, err := f.compute(o, current)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			// the existing value is kept
+			continue
+		}
+
+		if doc, err = jsonparser.Set(doc, result, o.path...); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// compute returns the json encoded value of the field after applying the operator, nil if the value doesn't change.
+func (f *FieldOperator) compute(o *operand, current value.Value) ([]byte, error) {
+	if f.Op == Min || f.Op == Max {
+		if current == nil {
+			return o.raw, nil
+		}
+
+		cmp, err := current.CompareTo(o.value)
+		if err != nil {
+			return nil, err
+		}
+		if (f.Op == Min && cmp > 0) || (f.Op == Max && cmp < 0) {
+			return o.raw, nil
+		}
+		return nil, nil
+	}
+
+	path := strings.Join(o.path, schema.FieldPathSeparator)
+	overflow := api.Errorf(api.Code_INVALID_ARGUMENT, "value of field '%s' overflows %s", path, schema.FieldNames[o.field.DataType])
+	switch v := o.value.(type) {
+	case *value.IntValue:
+		var existing int64
+		if current != nil {
+			c, ok := current.(*value.IntValue)
+			if !ok {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "field '%s' has a value '%v' that is not an integer", path, current.AsInterface())
+			}
+			existing = int64(*c)
+		}
+
+		result, ok := intArithmetic(f.Op, existing, int64(*v))
+		if !ok || (o.field.DataType == schema.Int32Type && (result > math.MaxInt32 || result < math.MinInt32)) {
+			return nil, overflow
+		}
+		return []byte(strconv.FormatInt(result, 10)), nil
+	case *value.DoubleValue:
+		var existing float64
+		if current != nil {
+			existing = float64(*current.(*value.DoubleValue))
+		}
+
+		result := doubleArithmetic(f.Op, existing, float64(*v))
+		if math.IsInf(result, 0) || math.IsNaN(result) {
+			return nil, overflow
+		}
+		return jsoniter.Marshal(result)
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not supported on field '%s'", f.Op, path)
+}
+
+// intArithmetic applies the arithmetic operator, returns false if the result overflows int64.
+func intArithmetic(op FieldOPType, existing int64, operand int64) (int64, bool) {
+	switch op {
+	case Increment:
+		result := existing + operand
+		return result, (operand >= 0) == (result >= existing)
+	case Decrement:
+		result := existing - operand
+		return result, (operand >= 0) == (result <= existing)
+	case Multiply:
+		if existing == 0 || operand == 0 {
+			return 0, true
+		}
+		result := existing * operand
+		if result/operand != existing || (existing == -1 && operand == math.MinInt64) || (operand == -1 && existing == math.MinInt64) {
+			return 0, false
+		}
+		return result, true
+	}
+
+	return 0, false
+}
+
+func doubleArithmetic(op FieldOPType, existing float64, operand float64) float64 {
+	switch op {
+	case Increment:
+		return existing + operand
+	case Decrement:
+		return existing - operand
+	case Multiply:
+		return existing * operand
+	}
+
+	return math.NaN()
+}
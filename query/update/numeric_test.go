@@ -0,0 +1,160 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+func testFields() []*schema.Field {
+	primary := true
+	return []*schema.Field{
+		{FieldName: "pkey", DataType: schema.Int64Type, PrimaryKeyField: &primary},
+		{FieldName: "a", DataType: schema.Int64Type},
+		{FieldName: "b", DataType: schema.Int32Type},
+		{FieldName: "c", DataType: schema.DoubleType},
+		{FieldName: "s", DataType: schema.StringType},
+		{FieldName: "t", DataType: schema.DateTimeType},
+		{FieldName: "bool", DataType: schema.BoolType},
+		{FieldName: "d", DataType: schema.ObjectType, Fields: []*schema.Field{
+			{FieldName: "f", DataType: schema.Int64Type},
+		}},
+	}
+}
+
+func TestMergeAndGet_Numeric(t *testing.T) {
+	existingDoc := []byte(`{"pkey": 1, "a": 10, "b": 20, "c": 1.5, "s": "foo", "t": "2022-01-02T00:00:00Z", "d": {"f": 5}}`)
+	cases := []struct {
+		reqInput  []byte
+		outputDoc string
+	}{
+		{
+			[]byte(`{"$increment": {"a": 1, "b": -30, "c": 0.25, "d.f": 5}}`),
+			`{"pkey": 1, "a": 11, "b": -10, "c": 1.75, "s": "foo", "t": "2022-01-02T00:00:00Z", "d": {"f": 10}}`,
+		}, {
+			[]byte(`{"$decrement": {"a": 11, "c": 2}}`),
+			`{"pkey": 1, "a": -1, "b": 20, "c": -0.5, "s": "foo", "t": "2022-01-02T00:00:00Z", "d": {"f": 5}}`,
+		}, {
+			[]byte(`{"$multiply": {"a": 3, "b": -1, "c": 2}}`),
+			`{"pkey": 1, "a": 30, "b": -20, "c": 3, "s": "foo", "t": "2022-01-02T00:00:00Z", "d": {"f": 5}}`,
+		}, {
+			[]byte(`{"$min": {"a": 5, "b": 30, "c": 1.0, "s": "bar"}}`),
+			`{"pkey": 1, "a": 5, "b": 20, "c": 1.0, "s": "bar", "t": "2022-01-02T00:00:00Z", "d": {"f": 5}}`,
+		}, {
+			[]byte(`{"$max": {"a": 5, "b": 30, "t": "2022-02-01T00:00:00Z"}}`),
+			`{"pkey": 1, "a": 10, "b": 30, "c": 1.5, "s": "foo", "t": "2022-02-01T00:00:00Z", "d": {"f": 5}}`,
+		}, {
+			[]byte(`{"$set": {"a": 100}, "$increment": {"b": 1}, "$unset": ["s"]}`),
+			`{"pkey": 1, "a": 100, "b": 21, "c": 1.5, "t": "2022-01-02T00:00:00Z", "d": {"f": 5}}`,
+		},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, testFields())
+		require.NoError(t, err, string(c.reqInput))
+
+		actualOut, err := f.MergeAndGet(existingDoc)
+		require.NoError(t, err, string(c.reqInput))
+		require.JSONEq(t, c.outputDoc, string(actualOut), string(c.reqInput))
+	}
+}
+
+func TestMergeAndGet_NumericMissingFields(t *testing.T) {
+	existingDoc := []byte(`{"pkey": 1, "c": null}`)
+	cases := []struct {
+		reqInput  []byte
+		outputDoc string
+	}{
+		{[]byte(`{"$increment": {"a": 2, "c": 1.5}}`), `{"pkey": 1, "c": 1.5, "a": 2}`},
+		{[]byte(`{"$decrement": {"a": 2}}`), `{"pkey": 1, "c": null, "a": -2}`},
+		{[]byte(`{"$multiply": {"a": 2}}`), `{"pkey": 1, "c": null, "a": 0}`},
+		{[]byte(`{"$max": {"d.f": 2}}`), `{"pkey": 1, "c": null, "d": {"f": 2}}`},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, testFields())
+		require.NoError(t, err, string(c.reqInput))
+
+		actualOut, err := f.MergeAndGet(existingDoc)
+		require.NoError(t, err, string(c.reqInput))
+		require.JSONEq(t, c.outputDoc, string(actualOut), string(c.reqInput))
+	}
+}
+
+func TestMergeAndGet_NumericOverflow(t *testing.T) {
+	cases := []struct {
+		existingDoc []byte
+		reqInput    []byte
+		expErr      error
+	}{
+		{
+			[]byte(`{"b": 2147483647}`),
+			[]byte(`{"$increment": {"b": 1}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "value of field 'b' overflows int32"),
+		}, {
+			[]byte(`{"a": -9223372036854775808}`),
+			[]byte(`{"$decrement": {"a": 1}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "value of field 'a' overflows int64"),
+		}, {
+			[]byte(`{"a": 9223372036854775807}`),
+			[]byte(`{"$multiply": {"a": 2}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "value of field 'a' overflows int64"),
+		}, {
+			[]byte(`{"a": -9223372036854775808}`),
+			[]byte(`{"$multiply": {"a": -1}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "value of field 'a' overflows int64"),
+		}, {
+			[]byte(`{"c": 1e308}`),
+			[]byte(`{"$multiply": {"c": 10}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "value of field 'c' overflows double"),
+		}, {
+			[]byte(`{"a": "foo"}`),
+			[]byte(`{"$increment": {"a": 1}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "field 'a' has a value 'foo' that is not a 'int64'"),
+		},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, testFields())
+		require.NoError(t, err, string(c.reqInput))
+
+		_, err = f.MergeAndGet(c.existingDoc)
+		require.Equal(t, c.expErr, err, string(c.reqInput))
+	}
+}
+
+func TestBuildFieldOperators_NumericErrors(t *testing.T) {
+	cases := []struct {
+		reqInput []byte
+		expErr   error
+	}{
+		{[]byte(`{"$increment": [1]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' needs an object with fields and values")},
+		{[]byte(`{"$increment": {}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' needs an object with fields and values")},
+		{[]byte(`{"$increment": {"x": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "updating non schema field 'x'")},
+		{[]byte(`{"$increment": {"pkey": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field 'pkey' can't be updated using '$increment'")},
+		{[]byte(`{"$unset": ["pkey"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field 'pkey' can't be unset")},
+		{[]byte(`{"$increment": {"s": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' is not supported on field 's' of type 'string'")},
+		{[]byte(`{"$max": {"bool": true}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$max' is not supported on field 'bool' of type 'bool'")},
+		{[]byte(`{"$increment": {"a": "1"}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' needs a value of type 'int64' for field 'a'")},
+		{[]byte(`{"$min": {"s": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$min' needs a value of type 'string' for field 's'")},
+		{[]byte(`{"$increment": {"a": 1.5}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' needs an integer value for field 'a'")},
+		{[]byte(`{"$increment": {"b": 2147483648}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "value '2147483648' overflows int32")},
+	}
+	for _, c := range cases {
+		_, err := BuildFieldOperators(c.reqInput, testFields())
+		require.Equal(t, c.expErr, err, string(c.reqInput))
+	}
+}
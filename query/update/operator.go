@@ -16,11 +16,12 @@ package update
 
 import (
 	"bytes"
-	"fmt"
+	"strings"
 
 	"github.com/buger/jsonparser"
 	jsoniter "github.com/json-iterator/go"
 	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
 	"github.com/tigrisdata/tigris/util/log"
 )
 
@@ -28,13 +29,38 @@ import (
 type FieldOPType string
 
 const (
-	set FieldOPType = "$set"
+	Set FieldOPType = "$set"
+	// Unset removes the fields from the document, "$remove" is accepted as an alias.
+	Unset  FieldOPType = "$unset"
+	remove FieldOPType = "$remove"
+	// Increment, Decrement and Multiply are applied on the numeric fields, Min and Max replace the value of the field
+	// if the passed value is lower or greater than the existing value.
+	Increment FieldOPType = "$increment"
+	Decrement FieldOPType = "$decrement"
+	Multiply  FieldOPType = "$multiply"
+	Min       FieldOPType = "$min"
+	Max       FieldOPType = "$max"
+	// Push, AddToSet, Pull and Pop modify the array fields in place.
+	Push     FieldOPType = "$push"
+	AddToSet FieldOPType = "$addToSet"
+	Pull     FieldOPType = "$pull"
+	Pop      FieldOPType = "$pop"
+	// Merge applies a JSON merge patch (RFC 7396) and Patch applies the operations of a JSON patch (RFC 6902) on the
+	// document, these can't be used along with the other operators.
+	Merge FieldOPType = "$merge"
+	Patch FieldOPType = "$patch"
 )
 
+// numericOperators are applied in this order after the $set operator.
+var numericOperators = []FieldOPType{Increment, Decrement, Multiply, Min, Max}
+
+// arrayOperators are applied in this order after the numeric operators.
+var arrayOperators = []FieldOPType{Push, AddToSet, Pull, Pop}
+
 // BuildFieldOperators un-marshals request "fields" present in the Update API and returns a FieldOperatorFactory
 // The FieldOperatorFactory has the logic to remove/merge the JSON passed in the input and the one present in the
-// database.
-func BuildFieldOperators(reqFields []byte) (*FieldOperatorFactory, error) {
+// database. The fields of the collection are used to apply the operators using the type of the field.
+func BuildFieldOperators(reqFields []byte, fields []*schema.Field) (*FieldOperatorFactory, error) {
 	var decodedOperators map[string]jsoniter.RawMessage
 	if err := jsoniter.Unmarshal(reqFields, &decodedOperators); log.E(err) {
 		return nil, err
@@ -43,10 +69,76 @@ func BuildFieldOperators(reqFields []byte) (*FieldOperatorFactory, error) {
 	var operators = make(map[string]*FieldOperator)
 	for op, val := range decodedOperators {
 		switch op {
-		case string(set):
-			operators[string(set)] = NewFieldOperator(set, val)
+		case string(Set):
+			operator := NewFieldOperator(Set, val)
+			setFields, err := operator.setFields()
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range setFields {
+				if err = checkNotPrimaryKey(fields, f, Set); err != nil {
+					return nil, err
+				}
+				if nestedInArray(fields, f) {
+					return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' is not supported on field '%s' nested in an array", Set, f)
+				}
+			}
+			operators[string(Set)] = operator
+		case string(Unset), string(remove):
+			if _, ok := operators[string(Unset)]; ok {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' and '%s' can't be used together", Unset, remove)
+			}
+
+			operator := NewFieldOperator(Unset, val)
+			unsetFields, err := operator.unsetFields()
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range unsetFields {
+				if err = checkNotPrimaryKey(fields, f, Unset); err != nil {
+					return nil, err
+				}
+			}
+			operators[string(Unset)] = operator
+		case string(Increment), string(Decrement), string(Multiply), string(Min), string(Max):
+			operator := NewFieldOperator(FieldOPType(op), val)
+			if err := operator.buildOperands(fields); err != nil {
+				return nil, err
+			}
+			operators[op] = operator
+		case string(Push), string(AddToSet), string(Pull), string(Pop):
+			operator := NewFieldOperator(FieldOPType(op), val)
+			if err := operator.buildArrayOperands(fields); err != nil {
+				return nil, err
+			}
+			operators[op] = operator
+		case string(Merge):
+			operator := NewFieldOperator(Merge, val)
+			if err := operator.buildMerge(fields); err != nil {
+				return nil, err
+			}
+			operators[op] = operator
+		case string(Patch):
+			operator := NewFieldOperator(Patch, val)
+			if err := operator.buildPatch(fields); err != nil {
+				return nil, err
+			}
+			operators[op] = operator
+		default:
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported update operator '%s'", op)
+		}
+	}
+	if len(operators) == 0 {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "no update operator present in the fields parameter")
+	}
+	for _, op := range []FieldOPType{Merge, Patch} {
+		if _, ok := operators[string(op)]; ok && len(operators) > 1 {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' can't be used with other update operators", op)
 		}
 	}
+	if err := checkOverlappingFields(operators); err != nil {
+		return nil, err
+	}
 
 	return &FieldOperatorFactory{
 		FieldOperators: operators,
@@ -59,31 +151,140 @@ type FieldOperatorFactory struct {
 	FieldOperators map[string]*FieldOperator
 }
 
-// MergeAndGet method to converts the input to the output after applying all the operators.
+// MergeAndGet method to converts the input to the output after applying all the operators. The fields are first set,
+// then the numeric and the array operators are applied and at the end the fields are removed. The $merge and $patch
+// are always used alone.
 func (factory *FieldOperatorFactory) MergeAndGet(existingDoc jsoniter.RawMessage) (jsoniter.RawMessage, error) {
-	setFieldOp := factory.FieldOperators[string(set)]
-	if setFieldOp == nil {
-		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "set operator not present in the fields parameter")
+	// the existing document is not modified, the operators are applied on a copy of it.
+	out := append(jsoniter.RawMessage{}, existingDoc...)
+
+	var err error
+	if mergeFieldOp := factory.FieldOperators[string(Merge)]; mergeFieldOp != nil {
+		return applyMerge(out, mergeFieldOp.Document)
 	}
-	out, err := factory.apply(existingDoc, setFieldOp.Document)
-	if err != nil {
-		return nil, err
+	if patchFieldOp := factory.FieldOperators[string(Patch)]; patchFieldOp != nil {
+		return patchFieldOp.applyPatch(out)
+	}
+
+	if setFieldOp := factory.FieldOperators[string(Set)]; setFieldOp != nil {
+		if out, err = applySet(out, setFieldOp.Document); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, op := range numericOperators {
+		if numericFieldOp := factory.FieldOperators[string(op)]; numericFieldOp != nil {
+			if out, err = numericFieldOp.applyNumeric(out); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, op := range arrayOperators {
+		if arrayFieldOp := factory.FieldOperators[string(op)]; arrayFieldOp != nil {
+			if out, err = arrayFieldOp.applyArray(out); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if unsetFieldOp := factory.FieldOperators[string(Unset)]; unsetFieldOp != nil {
+		fields, err := unsetFieldOp.unsetFields()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fields {
+			path := strings.Split(f, schema.FieldPathSeparator)
+			if _, _, _, err := jsonparser.Get(out, path...); err != nil {
+				// field is not present in the document
+				continue
+			}
+			out = jsonparser.Delete(out, path...)
+		}
 	}
 
 	return out, nil
 }
 
-func (factory *FieldOperatorFactory) apply(input jsoniter.RawMessage, setDoc jsoniter.RawMessage) (jsoniter.RawMessage, error) {
+// checkOverlappingFields returns an error if a field is updated by more than one operator. The operators are applied
+// one after the other, so the result would depend on the order they are applied in. A field overlaps with the fields
+// nested in it as well.
+func checkOverlappingFields(operators map[string]*FieldOperator) error {
+	type updatedField struct {
+		path string
+		op   FieldOPType
+	}
+
+	var updated []updatedField
+	for _, op := range append(append(append([]FieldOPType{Set}, numericOperators...), arrayOperators...), Unset) {
+		operator := operators[string(op)]
+		if operator == nil {
+			continue
+		}
+
+		paths, err := operator.updatedFields()
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			for _, u := range updated {
+				if isSameOrNested(p, u.path) || isSameOrNested(u.path, p) {
+					return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' and '%s' can't update the same field '%s'", u.op, op, u.path)
+				}
+			}
+		}
+		for _, p := range paths {
+			updated = append(updated, updatedField{path: p, op: op})
+		}
+	}
+
+	return nil
+}
+
+// isSameOrNested returns true if the path is same as the parent or is the path of a field nested in it.
+func isSameOrNested(path string, parent string) bool {
+	return path == parent || strings.HasPrefix(path, parent+schema.FieldPathSeparator)
+}
+
+// nestedInArray returns true if a parent of the field in the path is an array. The operators can only address the
+// fields nested in objects.
+func nestedInArray(fields []*schema.Field, path string) bool {
+	parts := strings.Split(path, schema.FieldPathSeparator)
+	for i := 1; i < len(parts); i++ {
+		if parent := schema.GetField(fields, strings.Join(parts[:i], schema.FieldPathSeparator)); parent != nil && parent.Type() == schema.ArrayType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkNotPrimaryKey returns an error if the path refers to a primary key field, these fields can't be modified by
+// the operators as the key of the document is built using them.
+func checkNotPrimaryKey(fields []*schema.Field, path string, op FieldOPType) error {
+	name := strings.Split(path, schema.FieldPathSeparator)[0]
+	if field := schema.GetField(fields, name); field != nil && field.IsPrimaryKey() {
+		if op == Unset {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field '%s' can't be unset", name)
+		}
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field '%s' can't be updated using '%s'", name, op)
+	}
+
+	return nil
+}
+
+// applySet sets the fields of the $set document in the input. A key of the $set document can be the path of a nested
+// field i.e. "address.city", the objects in the path are created if they don't exist.
+func applySet(input jsoniter.RawMessage, setDoc jsoniter.RawMessage) (jsoniter.RawMessage, error) {
 	var (
 		output []byte = input
 		err    error
 	)
 	err = jsonparser.ObjectEach(setDoc, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
-		switch dataType {
-		case jsonparser.String:
-			value = []byte(fmt.Sprintf(`"%s"`, value))
-		}
-		output, err = jsonparser.Set(output, value, string(key))
+		// jsonparser returns the strings without the quotes but with the escape sequences, so quoting it back
+		// returns the same JSON string as in the request.
+		output, err = jsonparser.Set(output, rawValue(value, dataType), strings.Split(string(key), schema.FieldPathSeparator)...)
 		if err != nil {
 			return err
 		}
@@ -97,13 +298,56 @@ func (factory *FieldOperatorFactory) apply(input jsoniter.RawMessage, setDoc jso
 	return output, nil
 }
 
+// setFields returns the keys of the $set document.
+func (f *FieldOperator) setFields() ([]string, error) {
+	if _, dataType, _, err := jsonparser.Get(f.Document); err != nil || dataType != jsonparser.Object {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an object with fields and values", f.Op)
+	}
+
+	var fields []string
+	err := jsonparser.ObjectEach(f.Document, func(key []byte, _ []byte, _ jsonparser.ValueType, _ int) error {
+		fields = append(fields, string(key))
+		return nil
+	})
+	return fields, err
+}
+
+// updatedFields returns the paths of the fields updated by the operator, it is not supported by $merge and $patch.
+func (f *FieldOperator) updatedFields() ([]string, error) {
+	switch f.Op {
+	case Set:
+		return f.setFields()
+	case Unset:
+		return f.unsetFields()
+	}
+
+	var fields []string
+	for _, o := range f.operands {
+		fields = append(fields, strings.Join(o.path, schema.FieldPathSeparator))
+	}
+	for _, o := range f.arrayOperands {
+		fields = append(fields, strings.Join(o.path, schema.FieldPathSeparator))
+	}
+	return fields, nil
+}
+
 // A FieldOperator can be of the following type:
 // { "$set": { <field1>: <value1>, ... } }
-// { "$incr": { <field1>: <value> } }
-// { "$remove": ["d"] }
+// { "$increment": { <field1>: <value> } }
+// { "$push": { <field1>: <value> } }
+// { "$unset": ["d", "e.f"] } or { "$unset": { "d": "", "e.f": "" } }
+// { "$merge": { <field1>: <value1>, <field2>: null } }
+// { "$patch": [ { "op": <op>, "path": <pointer>, "value": <value> } ] }
 type FieldOperator struct {
 	Op       FieldOPType
 	Document jsoniter.RawMessage
+
+	// operands are the parsed values of the numeric operators.
+	operands []*operand
+	// arrayOperands are the parsed values of the array operators.
+	arrayOperands []*arrayOperand
+	// patchOperations are the parsed operations of $patch.
+	patchOperations []*patchOperation
 }
 
 // NewFieldOperator returns a FieldOperator
@@ -114,10 +358,58 @@ func NewFieldOperator(op FieldOPType, val jsoniter.RawMessage) *FieldOperator {
 	}
 }
 
+// DeserializeDoc returns the decoded document of the operator. The nested paths of $set are expanded to objects, so
+// that the document can be validated against the schema of the collection.
 func (f *FieldOperator) DeserializeDoc() (interface{}, error) {
+	doc := f.Document
+	if f.Op == Set {
+		var err error
+		if doc, err = applySet([]byte(`{}`), f.Document); err != nil {
+			return nil, err
+		}
+	}
+
 	var v interface{}
-	dec := jsoniter.NewDecoder(bytes.NewReader(f.Document))
+	dec := jsoniter.NewDecoder(bytes.NewReader(doc))
 	dec.UseNumber()
 	err := dec.Decode(&v)
 	return v, err
 }
+
+// unsetFields returns the fields passed to the $unset operator, the fields are either passed as an array of names or
+// as the keys of an object.
+func (f *FieldOperator) unsetFields() ([]string, error) {
+	var fields []string
+	invalid := api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of field names", f.Op)
+
+	_, dataType, _, err := jsonparser.Get(f.Document)
+	if err != nil {
+		return nil, invalid
+	}
+
+	switch dataType {
+	case jsonparser.Array:
+		var itemErr error
+		if _, err = jsonparser.ArrayEach(f.Document, func(value []byte, dataType jsonparser.ValueType, _ int, _ error) {
+			if dataType != jsonparser.String || len(value) == 0 {
+				itemErr = invalid
+				return
+			}
+			fields = append(fields, string(value))
+		}); err != nil || itemErr != nil {
+			return nil, invalid
+		}
+	case jsonparser.Object:
+		if err = jsonparser.ObjectEach(f.Document, func(key []byte, _ []byte, _ jsonparser.ValueType, _ int) error {
+			fields = append(fields, string(key))
+			return nil
+		}); err != nil {
+			return nil, invalid
+		}
+	}
+	if len(fields) == 0 {
+		return nil, invalid
+	}
+
+	return fields, nil
+}
@@ -15,11 +15,13 @@
 package update
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
 )
 
 func TestMergeAndGet(t *testing.T) {
@@ -33,32 +35,32 @@ func TestMergeAndGet(t *testing.T) {
 			[]byte(`{"a": 10}`),
 			[]byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`),
 			[]byte(`{"a": 10, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`),
-			set,
+			Set,
 		}, {
 			[]byte(`{"b": "bar", "a": 10}`),
 			[]byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`),
 			[]byte(`{"a": 10, "b": "bar", "c": 1.01, "d": {"f": 22, "g": 44}}`),
-			set,
+			Set,
 		}, {
 			[]byte(`{"b": "test", "c": 10.22}`),
 			[]byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`),
 			[]byte(`{"a": 1, "b": "test", "c": 10.22, "d": {"f": 22, "g": 44}}`),
-			set,
+			Set,
 		}, {
 			[]byte(`{"c": 10.000022, "e": "new"}`),
 			[]byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`),
 			[]byte(`{"a": 1, "b": "foo", "c": 10.000022, "d": {"f": 22, "g": 44},"e":"new"}`),
-			set,
+			Set,
 		}, {
 			[]byte(`{"e": "again", "a": 1.000000022, "c": 23}`),
 			[]byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`),
 			[]byte(`{"a": 1.000000022, "b": "foo", "c": 23, "d": {"f": 22, "g": 44},"e":"again"}`),
-			set,
+			Set,
 		},
 	}
 	for _, c := range cases {
 		reqInput := []byte(fmt.Sprintf(`{"%s": %s}`, c.apply, c.inputDoc))
-		f, err := BuildFieldOperators(reqInput)
+		f, err := BuildFieldOperators(reqInput, nil)
 		require.NoError(t, err)
 
 		actualOut, err := f.MergeAndGet(c.existingDoc)
@@ -91,7 +93,7 @@ func TestMergeAndGet_MarshalInput(t *testing.T) {
 				"bytes_value":  []byte(`"simple_insert1_update"`),
 			},
 			[]byte(`{"pkey_int":100,"int_value":200,"string_value":"simple_insert1_update_modified","bool_value":false,"double_value":200.00001,"bytes_value":"InNpbXBsZV9pbnNlcnQxX3VwZGF0ZV9tb2RpZmllZCI="}`),
-			set,
+			Set,
 		},
 	}
 	for _, c := range cases {
@@ -99,7 +101,7 @@ func TestMergeAndGet_MarshalInput(t *testing.T) {
 		reqInput[string(c.apply)] = c.inputDoc
 		input, err := jsoniter.Marshal(reqInput)
 		require.NoError(t, err)
-		f, err := BuildFieldOperators(input)
+		f, err := BuildFieldOperators(input, nil)
 		require.NoError(t, err)
 		existingDoc, err := jsoniter.Marshal(c.existingDoc)
 		require.NoError(t, err)
@@ -108,3 +110,122 @@ func TestMergeAndGet_MarshalInput(t *testing.T) {
 		require.JSONEqf(t, string(c.outputDoc), string(actualOut), fmt.Sprintf("exp '%s' actual '%s'", string(c.outputDoc), string(actualOut)))
 	}
 }
+
+func TestMergeAndGet_Unset(t *testing.T) {
+	existingDoc := []byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`)
+	cases := []struct {
+		reqInput  []byte
+		outputDoc jsoniter.RawMessage
+	}{
+		{
+			[]byte(`{"$unset": ["b"]}`),
+			[]byte(`{"a": 1, "c": 1.01, "d": {"f": 22, "g": 44}}`),
+		}, {
+			[]byte(`{"$unset": ["d.f", "x", "d.x"]}`),
+			[]byte(`{"a": 1, "b": "foo", "c": 1.01, "d": {"g": 44}}`),
+		}, {
+			[]byte(`{"$remove": {"c": "", "d": ""}}`),
+			[]byte(`{"a": 1, "b": "foo"}`),
+		}, {
+			[]byte(`{"$set": {"b": "bar", "e": 1}, "$unset": ["a", "d.f"]}`),
+			[]byte(`{"b": "bar", "c": 1.01, "d": {"g": 44}, "e": 1}`),
+		},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, nil)
+		require.NoError(t, err)
+
+		actualOut, err := f.MergeAndGet(existingDoc)
+		require.NoError(t, err)
+		require.JSONEq(t, string(c.outputDoc), string(actualOut), string(c.reqInput))
+	}
+
+	// the existing document is not modified
+	require.JSONEq(t, `{"a": 1, "b": "foo", "c": 1.01, "d": {"f": 22, "g": 44}}`, string(existingDoc))
+}
+
+func TestBuildFieldOperators_Errors(t *testing.T) {
+	cases := []struct {
+		reqInput []byte
+		expErr   error
+	}{
+		{[]byte(`{}`), api.Errorf(api.Code_INVALID_ARGUMENT, "no update operator present in the fields parameter")},
+		{[]byte(`{"$foo": {"a": 1}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported update operator '$foo'")},
+		{[]byte(`{"$unset": []}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$unset' needs an array of field names")},
+		{[]byte(`{"$unset": [1]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$unset' needs an array of field names")},
+		{[]byte(`{"$unset": "a"}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$unset' needs an array of field names")},
+		{[]byte(`{"$unset": ["a"], "$remove": ["b"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$unset' and '$remove' can't be used together")},
+	}
+	for _, c := range cases {
+		_, err := BuildFieldOperators(c.reqInput, nil)
+		require.Equal(t, c.expErr, err, string(c.reqInput))
+	}
+}
+
+func TestBuildFieldOperators_OverlappingFields(t *testing.T) {
+	cases := []struct {
+		reqInput []byte
+		expErr   error
+	}{
+		{[]byte(`{"$set": {"a": 1}, "$unset": ["a"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$set' and '$unset' can't update the same field 'a'")},
+		{[]byte(`{"$set": {"d": {"f": 1}}, "$remove": ["d.f"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$set' and '$unset' can't update the same field 'd'")},
+		{[]byte(`{"$increment": {"d.f": 1}, "$set": {"d": {}}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$set' and '$increment' can't update the same field 'd'")},
+		{[]byte(`{"$increment": {"a": 1}, "$max": {"a": 10}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' and '$max' can't update the same field 'a'")},
+		{[]byte(`{"$increment": {"a": 1}, "$unset": ["a"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$increment' and '$unset' can't update the same field 'a'")},
+		{[]byte(`{"$set": {"a": 1, "d.f": 2}, "$increment": {"b": 1}, "$unset": ["s", "dd"]}`), nil},
+	}
+	for _, c := range cases {
+		_, err := BuildFieldOperators(c.reqInput, testFields())
+		require.Equal(t, c.expErr, err, string(c.reqInput))
+	}
+}
+
+func TestMergeAndGet_NestedSet(t *testing.T) {
+	existingDoc := []byte(`{"a": 1, "d": {"f": 22, "g": 44}}`)
+	cases := []struct {
+		reqInput  []byte
+		outputDoc string
+	}{
+		{
+			[]byte(`{"$set": {"d.f": 1}}`),
+			`{"a": 1, "d": {"f": 1, "g": 44}}`,
+		}, {
+			[]byte(`{"$set": {"d.h.i": "x", "e.f": [1, 2]}}`),
+			`{"a": 1, "d": {"f": 22, "g": 44, "h": {"i": "x"}}, "e": {"f": [1, 2]}}`,
+		}, {
+			[]byte(`{"$set": {"s": "a \"quoted\" \\ value é"}}`),
+			`{"a": 1, "d": {"f": 22, "g": 44}, "s": "a \"quoted\" \\ value é"}`,
+		},
+	}
+	for _, c := range cases {
+		f, err := BuildFieldOperators(c.reqInput, nil)
+		require.NoError(t, err, string(c.reqInput))
+
+		actualOut, err := f.MergeAndGet(existingDoc)
+		require.NoError(t, err, string(c.reqInput))
+		require.JSONEq(t, c.outputDoc, string(actualOut), string(c.reqInput))
+	}
+
+	// the nested paths are expanded to validate the fields against the schema
+	f, err := BuildFieldOperators([]byte(`{"$set": {"d.f": 1, "a": "foo"}}`), nil)
+	require.NoError(t, err)
+	doc, err := f.FieldOperators[string(Set)].DeserializeDoc()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": "foo", "d": map[string]interface{}{"f": json.Number("1")}}, doc)
+}
+
+func TestBuildFieldOperators_SetErrors(t *testing.T) {
+	fields := append(testFields(), testArrayFields()[3])
+	cases := []struct {
+		reqInput []byte
+		expErr   error
+	}{
+		{[]byte(`{"$set": ["a"]}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$set' needs an object with fields and values")},
+		{[]byte(`{"$set": {"pkey": 2}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field 'pkey' can't be updated using '$set'")},
+		{[]byte(`{"$set": {"items.id": 2}}`), api.Errorf(api.Code_INVALID_ARGUMENT, "'$set' is not supported on field 'items.id' nested in an array")},
+	}
+	for _, c := range cases {
+		_, err := BuildFieldOperators(c.reqInput, fields)
+		require.Equal(t, c.expErr, err, string(c.reqInput))
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+// The operations of the JSON patch.
+const (
+	patchAdd     = "add"
+	patchRemove  = "remove"
+	patchReplace = "replace"
+	patchMove    = "move"
+	patchCopy    = "copy"
+	patchTest    = "test"
+)
+
+// patchOperation is a single operation of the JSON patch, the path and from are parsed JSON pointers.
+type patchOperation struct {
+	Op    string              `json:"op"`
+	Path  string              `json:"path"`
+	From  string              `json:"from"`
+	Value jsoniter.RawMessage `json:"value"`
+
+	path []string
+	from []string
+}
+
+// buildMerge validates the document passed to $merge,
+//    { "$merge": { <field1>: <value1>, <field2>: null, <field3>: { <nested1>: <value1> } } }
+func (f *FieldOperator) buildMerge(fields []*schema.Field) error {
+	mergeFields, err := f.setFields()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range mergeFields {
+		if err = checkNotPrimaryKey(fields, name, f.Op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildPatch parses the operations passed to $patch,
+//    { "$patch": [ { "op": "replace", "path": "/a/b", "value": <value> }, { "op": "move", "from": "/c", "path": "/d" } ] }
+func (f *FieldOperator) buildPatch(fields []*schema.Field) error {
+	if _, dataType, _, err := jsonparser.Get(f.Document); err != nil || dataType != jsonparser.Array {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of operations", f.Op)
+	}
+
+	var operations []*patchOperation
+	if err := jsoniter.Unmarshal(f.Document, &operations); err != nil {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of operations", f.Op)
+	}
+	if len(operations) == 0 {
+		return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of operations", f.Op)
+	}
+
+	for _, o := range operations {
+		var err error
+		if o == nil {
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' needs an array of operations", f.Op)
+		}
+		if o.path, err = parsePointer(o.Path); err != nil {
+			return err
+		}
+
+		switch o.Op {
+		case patchAdd, patchReplace, patchTest:
+			if o.Value == nil {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' operation '%s' needs a value", f.Op, o.Op)
+			}
+		case patchMove, patchCopy:
+			if o.from, err = parsePointer(o.From); err != nil {
+				return err
+			}
+			if o.Op == patchMove && isPrefixPath(o.from, o.path) && len(o.from) < len(o.path) {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' can't move '%s' to its child '%s'", f.Op, o.From, o.Path)
+			}
+		case patchRemove:
+		default:
+			return api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported '%s' operation '%s'", f.Op, o.Op)
+		}
+
+		if o.Op == patchTest {
+			continue
+		}
+		// the whole document or the primary key fields can't be modified
+		for _, path := range [][]string{o.path, o.from} {
+			if path == nil {
+				continue
+			}
+			if len(path) == 0 {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "'%s' operation '%s' can't modify the whole document", f.Op, o.Op)
+			}
+			if err = checkNotPrimaryKey(fields, path[0], f.Op); err != nil {
+				return err
+			}
+		}
+	}
+
+	f.patchOperations = operations
+	return nil
+}
+
+// parsePointer returns the reference tokens of the JSON pointer (RFC 6901), an empty pointer refers to the whole
+// document.
+func parsePointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+	if pointer[0] != '/' {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "invalid JSON pointer '%s'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefixPath(prefix []string, path []string) bool {
+	return len(prefix) <= len(path) && reflect.DeepEqual(prefix, path[:len(prefix)])
+}
+
+// applyMerge applies the merge patch (RFC 7396) on the document. A null removes the field, an object is merged with
+// the existing object of the field and any other value replaces the field.
+func applyMerge(doc []byte, patch []byte) ([]byte, error) {
+	out := doc
+	err := jsonparser.ObjectEach(patch, func(key []byte, value []byte, dataType jsonparser.ValueType, _ int) error {
+		var err error
+		existing, existingType, _, getErr := jsonparser.Get(out, string(key))
+		switch dataType {
+		case jsonparser.Null:
+			if getErr == nil {
+				out = jsonparser.Delete(out, string(key))
+			}
+		case jsonparser.Object:
+			if getErr != nil || existingType != jsonparser.Object {
+				existing = []byte(`{}`)
+			}
+			var merged []byte
+			if merged, err = applyMerge(existing, value); err != nil {
+				return err
+			}
+			out, err = jsonparser.Set(out, merged, string(key))
+		default:
+			out, err = jsonparser.Set(out, rawValue(value, dataType), string(key))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// applyPatch applies the operations of the JSON patch (RFC 6902) in order. A failed "test" operation fails the
+// whole patch with a precondition error.
+func (f *FieldOperator) applyPatch(doc []byte) ([]byte, error) {
+	var err error
+	for _, o := range f.patchOperations {
+		switch o.Op {
+		case patchAdd:
+			doc, err = modifyPath(doc, o.path, o.Path, func(parent []byte, token string) ([]byte, error) {
+				return addChild(parent, token, o.Value, o.Path)
+			})
+		case patchRemove:
+			doc, err = modifyPath(doc, o.path, o.Path, func(parent []byte, token string) ([]byte, error) {
+				return removeChild(parent, token, o.Path)
+			})
+		case patchReplace:
+			doc, err = modifyPath(doc, o.path, o.Path, func(parent []byte, token string) ([]byte, error) {
+				if _, err := getChild(parent, token, o.Path); err != nil {
+					return nil, err
+				}
+				return setChild(parent, token, o.Value, false, o.Path)
+			})
+		case patchMove, patchCopy:
+			var v []byte
+			if v, err = getPath(doc, o.from, o.From); err != nil {
+				return nil, err
+			}
+			if o.Op == patchMove {
+				if doc, err = modifyPath(doc, o.from, o.From, func(parent []byte, token string) ([]byte, error) {
+					return removeChild(parent, token, o.From)
+				}); err != nil {
+					return nil, err
+				}
+			}
+			doc, err = modifyPath(doc, o.path, o.Path, func(parent []byte, token string) ([]byte, error) {
+				return addChild(parent, token, v, o.Path)
+			})
+		case patchTest:
+			var v []byte
+			if v, err = getPath(doc, o.path, o.Path); err != nil {
+				return nil, err
+			}
+			if !equalJSON(v, o.Value) {
+				return nil, api.Errorf(api.Code_FAILED_PRECONDITION, "'%s' test failed, value at '%s' is not equal to '%s'", f.Op, o.Path, string(o.Value))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// modifyPath calls modify with the parent of the path and the last token of the path, the modified parent then
+// replaces the parent in the document.
+func modifyPath(doc []byte, path []string, pointer string, modify func(parent []byte, token string) ([]byte, error)) ([]byte, error) {
+	if len(path) == 1 {
+		return modify(doc, path[0])
+	}
+
+	child, err := getChild(doc, path[0], pointer)
+	if err != nil {
+		return nil, err
+	}
+	if child, err = modifyPath(child, path[1:], pointer, modify); err != nil {
+		return nil, err
+	}
+	return setChild(doc, path[0], child, false, pointer)
+}
+
+// getPath returns the json encoded value at the path.
+func getPath(doc []byte, path []string, pointer string) ([]byte, error) {
+	var err error
+	for _, token := range path {
+		if doc, err = getChild(doc, token, pointer); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// getChild returns the json encoded member of the object or the element of the array referred by the token.
+func getChild(parent []byte, token string, pointer string) ([]byte, error) {
+	v, dataType, _, err := jsonparser.Get(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dataType {
+	case jsonparser.Object:
+		if v, dataType, _, err = jsonparser.Get(parent, token); err == nil {
+			return rawValue(v, dataType), nil
+		}
+	case jsonparser.Array:
+		items, err := arrayItems(v)
+		if err != nil {
+			return nil, err
+		}
+		if idx, ok := arrayIndex(token, len(items)-1); ok {
+			return items[idx], nil
+		}
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "path '%s' doesn't exist in the document", pointer)
+}
+
+// setChild sets the member of the object or replaces the element of the array referred by the token. If insert is
+// set then the value is inserted in the array at the index instead, "-" appends the value to the array.
+func setChild(parent []byte, token string, value []byte, insert bool, pointer string) ([]byte, error) {
+	v, dataType, _, err := jsonparser.Get(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dataType {
+	case jsonparser.Object:
+		return jsonparser.Set(parent, value, token)
+	case jsonparser.Array:
+		items, err := arrayItems(v)
+		if err != nil {
+			return nil, err
+		}
+		if insert {
+			idx, ok := len(items), token == "-"
+			if !ok {
+				idx, ok = arrayIndex(token, len(items))
+			}
+			if ok {
+				items = append(items[:idx], append([]jsoniter.RawMessage{value}, items[idx:]...)...)
+				return jsoniter.Marshal(items)
+			}
+		} else if idx, ok := arrayIndex(token, len(items)-1); ok {
+			items[idx] = value
+			return jsoniter.Marshal(items)
+		}
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "path '%s' doesn't exist in the document", pointer)
+}
+
+// addChild adds the member to the object, replacing the existing one, or inserts the element in the array.
+func addChild(parent []byte, token string, value []byte, pointer string) ([]byte, error) {
+	return setChild(parent, token, value, true, pointer)
+}
+
+// removeChild removes the member of the object or the element of the array referred by the token.
+func removeChild(parent []byte, token string, pointer string) ([]byte, error) {
+	if _, err := getChild(parent, token, pointer); err != nil {
+		return nil, err
+	}
+
+	v, dataType, _, err := jsonparser.Get(parent)
+	if err != nil {
+		return nil, err
+	}
+	if dataType == jsonparser.Object {
+		return jsonparser.Delete(parent, token), nil
+	}
+
+	items, err := arrayItems(v)
+	if err != nil {
+		return nil, err
+	}
+	idx, _ := arrayIndex(token, len(items)-1)
+	return jsoniter.Marshal(append(items[:idx], items[idx+1:]...))
+}
+
+func arrayItems(array []byte) ([]jsoniter.RawMessage, error) {
+	items := []jsoniter.RawMessage{}
+	if err := jsoniter.Unmarshal(array, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// arrayIndex parses the token as an index of the array that is at most max, the index can't have leading zeros.
+func arrayIndex(token string, max int) (int, bool) {
+	if len(token) == 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > max {
+		return 0, false
+	}
+
+	return idx, true
+}
+
+// equalJSON returns true if the json encoded values are equal, the numbers are compared by their values.
+func equalJSON(a []byte, b []byte) bool {
+	var aDecoded, bDecoded interface{}
+	if err := jsoniter.Unmarshal(a, &aDecoded); err != nil {
+		return false
+	}
+	if err := jsoniter.Unmarshal(b, &bDecoded); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(aDecoded, bDecoded)
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+func TestMergeAndPatch(t *testing.T) {
+	primary := true
+	fields := []*schema.Field{
+		{FieldName: "id", DataType: schema.Int64Type, PrimaryKeyField: &primary},
+		{FieldName: "a", DataType: schema.Int64Type},
+	}
+	existing := []byte(`{"id": 1, "a": 1, "b": {"c": "foo", "d": 2}, "e": [1, 2, 3]}`)
+
+	cases := []struct {
+		name     string
+		fields   []byte
+		expected []byte
+		expError error
+	}{
+		{
+			"merge replaces, removes and merges the fields",
+			[]byte(`{"$merge": {"a": 10, "b": {"c": null, "f": {"g": 1}}, "e": [4], "h": null}}`),
+			[]byte(`{"id": 1, "a": 10, "b": {"d": 2, "f": {"g": 1}}, "e": [4]}`),
+			nil,
+		},
+		{
+			"merge replaces a non object with an object",
+			[]byte(`{"$merge": {"a": {"x": 1, "y": null}}}`),
+			[]byte(`{"id": 1, "a": {"x": 1}, "b": {"c": "foo", "d": 2}, "e": [1, 2, 3]}`),
+			nil,
+		},
+		{
+			"patch operations are applied in order",
+			[]byte(`{"$patch": [
+				{"op": "test", "path": "/b/d", "value": 2.0},
+				{"op": "replace", "path": "/a", "value": 5},
+				{"op": "add", "path": "/e/1", "value": 9},
+				{"op": "add", "path": "/e/-", "value": 10},
+				{"op": "remove", "path": "/e/0"},
+				{"op": "move", "from": "/b/c", "path": "/c"},
+				{"op": "copy", "from": "/b", "path": "/f"}
+			]}`),
+			[]byte(`{"id": 1, "a": 5, "b": {"d": 2}, "e": [9, 2, 3, 10], "c": "foo", "f": {"d": 2}}`),
+			nil,
+		},
+		{
+			"failed test",
+			[]byte(`{"$patch": [{"op": "test", "path": "/a", "value": 2}, {"op": "replace", "path": "/a", "value": 5}]}`),
+			nil,
+			api.Errorf(api.Code_FAILED_PRECONDITION, "'$patch' test failed, value at '/a' is not equal to '2'"),
+		},
+		{
+			"missing path",
+			[]byte(`{"$patch": [{"op": "replace", "path": "/x", "value": 5}]}`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "path '/x' doesn't exist in the document"),
+		},
+		{
+			"index out of range",
+			[]byte(`{"$patch": [{"op": "add", "path": "/e/4", "value": 5}]}`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "path '/e/4' doesn't exist in the document"),
+		},
+	}
+	for _, c := range cases {
+		factory, err := BuildFieldOperators(c.fields, fields)
+		require.NoError(t, err, c.name)
+
+		actual, err := factory.MergeAndGet(existing)
+		require.Equal(t, c.expError, err, c.name)
+		if c.expError == nil {
+			require.JSONEq(t, string(c.expected), string(actual), c.name)
+		}
+	}
+}
+
+func TestMergeAndPatchErrors(t *testing.T) {
+	primary := true
+	fields := []*schema.Field{
+		{FieldName: "id", DataType: schema.Int64Type, PrimaryKeyField: &primary},
+	}
+
+	cases := []struct {
+		fields   []byte
+		expError error
+	}{
+		{
+			[]byte(`{"$merge": {"id": 2}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field 'id' can't be updated using '$merge'"),
+		},
+		{
+			[]byte(`{"$merge": [1]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "'$merge' needs an object with fields and values"),
+		},
+		{
+			[]byte(`{"$merge": {"a": 1}, "$set": {"b": 1}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "'$merge' can't be used with other update operators"),
+		},
+		{
+			[]byte(`{"$patch": [{"op": "move", "from": "/id", "path": "/a"}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "primary key field 'id' can't be updated using '$patch'"),
+		},
+		{
+			[]byte(`{"$patch": [{"op": "replace", "path": "", "value": {}}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "'$patch' operation 'replace' can't modify the whole document"),
+		},
+		{
+			[]byte(`{"$patch": [{"op": "add", "path": "/a"}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "'$patch' operation 'add' needs a value"),
+		},
+		{
+			[]byte(`{"$patch": [{"op": "move", "from": "/a", "path": "/a/b"}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "'$patch' can't move '/a' to its child '/a/b'"),
+		},
+		{
+			[]byte(`{"$patch": [{"op": "foo", "path": "/a"}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported '$patch' operation 'foo'"),
+		},
+		{
+			[]byte(`{"$patch": [{"op": "remove", "path": "a"}]}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "invalid JSON pointer 'a'"),
+		},
+		{
+			[]byte(`{"$patch": {}}`),
+			api.Errorf(api.Code_INVALID_ARGUMENT, "'$patch' needs an array of operations"),
+		},
+	}
+	for _, c := range cases {
+		_, err := BuildFieldOperators(c.fields, fields)
+		require.Equal(t, c.expError, err, string(c.fields))
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"strings"
+
+	"github.com/buger/jsonparser"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/schema"
+)
+
+// NewDocument returns the document inserted by an upsert when no document is matching the filter. The fields of the
+// document are first set using the equality conditions of the filter, then the operators are applied on it the same
+// way as on an existing document. The conditions on the array fields or on the fields nested in an array are skipped
+// as they don't tell the value of the field.
+func (factory *FieldOperatorFactory) NewDocument(filters []filter.Filter, fields []*schema.Field) (jsoniter.RawMessage, error) {
+	doc := []byte(`{}`)
+	for _, sel := range filter.EqualitySelectors(filters) {
+		if sel.FieldType == schema.ArrayType || nestedInArray(fields, sel.Field) {
+			continue
+		}
+
+		raw, err := jsoniter.Marshal(sel.Matcher.GetValue().AsInterface())
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = jsonparser.Set(doc, raw, strings.Split(sel.Field, schema.FieldPathSeparator)...); err != nil {
+			return nil, err
+		}
+	}
+
+	return factory.MergeAndGet(doc)
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tigrisdata/tigris/query/filter"
+)
+
+func TestNewDocument(t *testing.T) {
+	cases := []struct {
+		filter    []byte
+		reqInput  []byte
+		outputDoc string
+	}{
+		{
+			[]byte(`{"pkey": 1}`),
+			[]byte(`{"$set": {"s": "foo", "d.f": 2}}`),
+			`{"pkey": 1, "s": "foo", "d": {"f": 2}}`,
+		}, {
+			[]byte(`{"pkey": 1, "a": {"$gt": 5}, "$and": [{"s": "foo"}, {"d.f": {"$eq": 3}}]}`),
+			[]byte(`{"$increment": {"b": 2}}`),
+			`{"pkey": 1, "s": "foo", "d": {"f": 3}, "b": 2}`,
+		}, {
+			[]byte(`{"$or": [{"pkey": 1}, {"pkey": 2}], "t": "2022-01-02T00:00:00Z"}`),
+			[]byte(`{"$set": {"s": "foo"}}`),
+			`{"t": "2022-01-02T00:00:00Z", "s": "foo"}`,
+		}, {
+			[]byte(`{"s": "bar"}`),
+			[]byte(`{"$set": {"s": "foo"}}`),
+			`{"s": "foo"}`,
+		},
+	}
+	for _, c := range cases {
+		filters, err := filter.NewFactory(testFields()).Factorize(c.filter)
+		require.NoError(t, err, string(c.filter))
+
+		f, err := BuildFieldOperators(c.reqInput, testFields())
+		require.NoError(t, err, string(c.reqInput))
+
+		actualOut, err := f.NewDocument(filters, testFields())
+		require.NoError(t, err, string(c.reqInput))
+		require.JSONEq(t, c.outputDoc, string(actualOut), string(c.filter))
+	}
+}
@@ -158,6 +158,20 @@ func buildSearchSchema(name string, fields []*Field) *tsApi.CollectionSchema {
 			Optional: &ptrTrue,
 			Index:    &indexable,
 		})
+
+		// the object is stored as a string, so the nested fields are added separately to make them searchable
+		for _, nested := range FlattenObjectField(f) {
+			indexable := IndexableField(nested)
+			facetable := FacetableField(nested)
+
+			searchFields = append(searchFields, tsApi.Field{
+				Name:     nested.FieldName,
+				Facet:    &facetable,
+				Type:     ToSearchFieldType(nested),
+				Optional: &ptrTrue,
+				Index:    &indexable,
+			})
+		}
 	}
 
 	return &tsApi.CollectionSchema{
@@ -29,6 +29,9 @@ const (
 	searchArrayType  = "[]"
 )
 
+// FieldPathSeparator is used to refer to the nested fields i.e. "address.city".
+const FieldPathSeparator = "."
+
 const (
 	UnknownType FieldType = iota
 	NullType
@@ -145,6 +148,17 @@ func IsValidIndexType(t FieldType) bool {
 	}
 }
 
+// IsKeyOrderedType returns true if the keys of the field are in the same order as the values. The UUID and the date
+// time keys have the text of the document, while their values are compared after parsing the text.
+func IsKeyOrderedType(t FieldType) bool {
+	switch t {
+	case UUIDType, DateTimeType:
+		return false
+	default:
+		return true
+	}
+}
+
 func IndexableField(field *Field) bool {
 	switch field.Type() {
 	case BoolType, Int32Type, Int64Type, UUIDType, StringType, DateTimeType, DoubleType:
@@ -295,3 +309,60 @@ func (f *Field) IsPrimaryKey() bool {
 func (f *Field) IsAutoGenerated() bool {
 	return f.AutoGenerated != nil && *f.AutoGenerated
 }
+
+// ItemField returns the field describing the items of an array if the items are not objects. For an array of objects
+// the nested fields are the properties of the objects, so nil is returned.
+func (f *Field) ItemField() *Field {
+	if f.Type() == ArrayType && len(f.Fields) == 1 && len(f.Fields[0].FieldName) == 0 {
+		return f.Fields[0]
+	}
+
+	return nil
+}
+
+// GetField returns the field that is referred by the path, the path is either the name of a top level field or the
+// names of the nested fields joined using FieldPathSeparator. A path can traverse objects and arrays of objects.
+// Returns nil if there is no field for the path.
+func GetField(fields []*Field, path string) *Field {
+	var field *Field
+	for _, name := range strings.Split(path, FieldPathSeparator) {
+		field = nil
+		for _, f := range fields {
+			if f.FieldName == name {
+				field = f
+				break
+			}
+		}
+		if field == nil {
+			return nil
+		}
+		fields = field.Fields
+	}
+
+	return field
+}
+
+// FlattenObjectField returns the nested fields of an object field, the name of the returned fields is the complete
+// path of the field i.e. "address.city". Nested objects are flattened as well, but arrays are returned as it is.
+func FlattenObjectField(field *Field) []*Field {
+	if field.Type() != ObjectType {
+		return nil
+	}
+
+	var flattened []*Field
+	for _, nested := range field.Fields {
+		if nested.Type() == ObjectType {
+			for _, f := range FlattenObjectField(nested) {
+				f.FieldName = field.FieldName + FieldPathSeparator + f.FieldName
+				flattened = append(flattened, f)
+			}
+			continue
+		}
+
+		f := *nested
+		f.FieldName = field.FieldName + FieldPathSeparator + nested.FieldName
+		flattened = append(flattened, &f)
+	}
+
+	return flattened
+}
@@ -270,3 +270,67 @@ func TestCreateCollectionFromSchema(t *testing.T) {
 		require.Nil(t, fields[1].AutoGenerated)
 	})
 }
+
+func TestNestedFields(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"id": {"type": "integer"},
+		"address": {
+			"type": "object",
+			"properties": {
+				"city": {"type": "string"},
+				"geo": {
+					"type": "object",
+					"properties": {
+						"lat": {"type": "number"}
+					}
+				},
+				"zip": {"type": "array", "items": {"type": "integer"}}
+			}
+		},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"quantity": {"type": "integer"}
+				}
+			}
+		}
+	},
+	"primary_key": ["id"]
+}`)
+	sch, err := Build("t1", reqSchema)
+	require.NoError(t, err)
+
+	require.Equal(t, StringType, GetField(sch.Fields, "address.city").DataType)
+	require.Equal(t, DoubleType, GetField(sch.Fields, "address.geo.lat").DataType)
+	require.Equal(t, ArrayType, GetField(sch.Fields, "address.zip").DataType)
+	require.Equal(t, StringType, GetField(sch.Fields, "items.name").DataType)
+	require.Equal(t, Int64Type, GetField(sch.Fields, "id").DataType)
+	require.Nil(t, GetField(sch.Fields, "address.country"))
+	require.Nil(t, GetField(sch.Fields, "id.foo"))
+	require.Equal(t, Int64Type, GetField(sch.Fields, "address.zip").ItemField().DataType)
+	require.Nil(t, GetField(sch.Fields, "items").ItemField())
+
+	flattened := FlattenObjectField(GetField(sch.Fields, "address"))
+	var names []string
+	for _, f := range flattened {
+		names = append(names, f.FieldName)
+	}
+	require.ElementsMatch(t, []string{"address.city", "address.geo.lat", "address.zip"}, names)
+	require.Nil(t, FlattenObjectField(GetField(sch.Fields, "items")))
+
+	c := NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+	var searchFields = make(map[string]string)
+	for _, f := range c.SearchSchema.Fields {
+		searchFields[f.Name] = f.Type
+	}
+	require.Equal(t, "string", searchFields["address"])
+	require.Equal(t, "string", searchFields["address.city"])
+	require.Equal(t, "float", searchFields["address.geo.lat"])
+	require.Equal(t, "int64[]", searchFields["address.zip"])
+	require.Equal(t, "string", searchFields["items"])
+}
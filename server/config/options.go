@@ -31,6 +31,7 @@ type Config struct {
 	Auth         AuthConfig   `yaml:"auth" json:"auth"`
 	Cdc          CdcConfig    `yaml:"cdc" json:"cdc"`
 	Search       SearchConfig `yaml:"search" json:"search"`
+	Query        QueryConfig  `yaml:"query" json:"query"`
 	FoundationDB FoundationDBConfig
 }
 
@@ -41,6 +42,16 @@ type AuthConfig struct {
 	LogOnly          bool
 }
 
+// QueryConfig keeps the limits of the query execution.
+type QueryConfig struct {
+	// MaxSortRows is the maximum number of documents that are sorted in memory when the sort can't use the primary
+	// key order or the search index.
+	MaxSortRows int `mapstructure:"max_sort_rows" json:"max_sort_rows" yaml:"max_sort_rows"`
+	// MaxGroups is the maximum number of groups that a $group stage of an aggregation keeps in memory, it also limits
+	// the number of the values returned by a distinct.
+	MaxGroups int `mapstructure:"max_groups" json:"max_groups" yaml:"max_groups"`
+}
+
 type CdcConfig struct {
 	Enabled        bool
 	StreamInterval time.Duration
@@ -75,6 +86,10 @@ var DefaultConfig = Config{
 		WriteEnabled: true,
 		AuthKey:      "ts_test_key",
 	},
+	Query: QueryConfig{
+		MaxSortRows: 10000,
+		MaxGroups:   10000,
+	},
 }
 
 // FoundationDBConfig keeps FoundationDB configuration parameters
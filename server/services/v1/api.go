@@ -217,6 +217,8 @@ func (s *apiService) Update(ctx context.Context, r *api.UpdateRequest) (*api.Upd
 	return &api.UpdateResponse{
 		Status:        resp.status,
 		ModifiedCount: resp.modifiedCount,
+		Keys:          resp.allKeys,
+		Documents:     resp.documents,
 		Metadata: &api.ResponseMetadata{
 			UpdatedAt: resp.updatedAt.GetProtoTS(),
 		},
@@ -233,7 +235,9 @@ func (s *apiService) Delete(ctx context.Context, r *api.DeleteRequest) (*api.Del
 	}
 
 	return &api.DeleteResponse{
-		Status: resp.status,
+		Status:       resp.status,
+		DeletedCount: resp.deletedCount,
+		Documents:    resp.documents,
 		Metadata: &api.ResponseMetadata{
 			DeletedAt: resp.deletedAt.GetProtoTS(),
 		},
@@ -252,6 +256,54 @@ func (s *apiService) Read(r *api.ReadRequest, stream api.Tigris_ReadServer) erro
 	return nil
 }
 
+func (s *apiService) Explain(ctx context.Context, r *api.ExplainRequest) (*api.ExplainResponse, error) {
+	resp, err := s.sessions.Execute(ctx, &ReqOptions{
+		txCtx:       api.GetTransaction(ctx, r),
+		queryRunner: s.runnerFactory.GetExplainQueryRunner(r),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Response.(*api.ExplainResponse), nil
+}
+
+func (s *apiService) Aggregate(r *api.AggregateRequest, stream api.Tigris_AggregateServer) error {
+	_, err := s.sessions.Execute(stream.Context(), &ReqOptions{
+		txCtx:       api.GetTransaction(stream.Context(), r),
+		queryRunner: s.runnerFactory.GetAggregateQueryRunner(r, stream),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *apiService) Count(ctx context.Context, r *api.CountRequest) (*api.CountResponse, error) {
+	resp, err := s.sessions.Execute(ctx, &ReqOptions{
+		txCtx:       api.GetTransaction(ctx, r),
+		queryRunner: s.runnerFactory.GetCountQueryRunner(r),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Response.(*api.CountResponse), nil
+}
+
+func (s *apiService) Distinct(ctx context.Context, r *api.DistinctRequest) (*api.DistinctResponse, error) {
+	resp, err := s.sessions.Execute(ctx, &ReqOptions{
+		txCtx:       api.GetTransaction(ctx, r),
+		queryRunner: s.runnerFactory.GetDistinctQueryRunner(r),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Response.(*api.DistinctResponse), nil
+}
+
 func (s *apiService) CreateOrUpdateCollection(ctx context.Context, r *api.CreateOrUpdateCollectionRequest) (*api.CreateOrUpdateCollectionResponse, error) {
 	runner := s.runnerFactory.GetCollectionQueryRunner()
 	runner.SetCreateOrUpdateCollectionReq(r)
@@ -410,10 +462,15 @@ func (s *apiService) Stream(r *api.StreamRequest, stream api.Tigris_StreamServer
 				}
 
 				if r.Collection == "" || r.Collection == collection {
-					td, err := internal.Decode(op.Data)
-					if err != nil {
-						log.Err(err).Str("data", string(op.Data)).Msg("failed to decode data")
-						return api.Errorf(api.Code_INTERNAL, "failed to decode data")
+					// the delete events, including the range deletes, have only the keys
+					var data []byte
+					if len(op.Data) > 0 {
+						td, err := internal.Decode(op.Data)
+						if err != nil {
+							log.Err(err).Str("data", string(op.Data)).Msg("failed to decode data")
+							return api.Errorf(api.Code_INTERNAL, "failed to decode data")
+						}
+						data = td.RawData
 					}
 
 					event := &api.StreamEvent{
@@ -423,7 +480,7 @@ func (s *apiService) Stream(r *api.StreamRequest, stream api.Tigris_StreamServer
 						Key:        op.Key,
 						Lkey:       op.LKey,
 						Rkey:       op.RKey,
-						Data:       td.RawData,
+						Data:       data,
 						Last:       op.Last,
 					}
 
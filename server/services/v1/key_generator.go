@@ -152,17 +152,20 @@ func isNull(tp schema.FieldType, val []byte) bool {
 // value as well so that we don't need to recalculate it from jsonVal.
 func (g *generator) get(ctx context.Context, table []byte, field *schema.Field) ([]byte, value.Value, error) {
 	switch field.Type() {
-	case schema.StringType, schema.UUIDType:
+	case schema.StringType:
 		value := value.NewStringValue(uuid.NewUUIDAsString())
 		return []byte(fmt.Sprintf(`%s`, *value)), value, nil
+	case schema.UUIDType:
+		value := value.NewUUIDValue(uuid.New())
+		return []byte(value.String()), value, nil
 	case schema.ByteType:
 		value := value.NewBytesValue([]byte(uuid.NewUUIDAsString()))
 		b64 := base64.StdEncoding.EncodeToString([]byte(*value))
 		return []byte(fmt.Sprintf(`%s`, b64)), value, nil
 	case schema.DateTimeType:
 		// use timestamp nano to reduce the contention if multiple workers end up generating same timestamp.
-		value := value.NewStringValue(time.Now().UTC().Format(time.RFC3339Nano))
-		return []byte(fmt.Sprintf(`%s`, *value)), value, nil
+		value := value.NewDateTimeValue(time.Now().UTC())
+		return []byte(value.String()), value, nil
 	case schema.Int64Type:
 		// use timestamp nano to reduce the contention if multiple workers end up generating same timestamp.
 		value := value.NewIntValue(time.Now().UTC().UnixNano())
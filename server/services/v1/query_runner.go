@@ -18,28 +18,64 @@ import (
 	"bytes"
 	"context"
 
+	"github.com/buger/jsonparser"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
 	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/internal"
 	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/aggregation"
 	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/query/planner"
 	"github.com/tigrisdata/tigris/query/read"
+	qsort "github.com/tigrisdata/tigris/query/sort"
 	"github.com/tigrisdata/tigris/query/update"
 	"github.com/tigrisdata/tigris/schema"
 	"github.com/tigrisdata/tigris/server/cdc"
+	"github.com/tigrisdata/tigris/server/config"
 	"github.com/tigrisdata/tigris/server/metadata"
 	"github.com/tigrisdata/tigris/server/transaction"
 	"github.com/tigrisdata/tigris/store/kv"
 	"github.com/tigrisdata/tigris/store/search"
 	ulog "github.com/tigrisdata/tigris/util/log"
+	"github.com/tigrisdata/tigris/value"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// mutationBatchSize is the maximum number of rows read and mutated in a transaction by the updates and deletes that are
+// not part of an explicit transaction.
+const mutationBatchSize = 1000
+
 // QueryRunner is responsible for executing the current query and return the response
 type QueryRunner interface {
 	Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error)
 }
 
+// BatchQueryRunner is implemented by the runners that can split the work across multiple transactions. The batches
+// are only used if the query is not part of an explicit transaction.
+type BatchQueryRunner interface {
+	QueryRunner
+
+	// EnableBatches is called before the first Run, every Run then only does one batch of the work.
+	EnableBatches()
+	// OnBatchCommit is called once the transaction of a batch is committed. It returns the response of all the
+	// committed batches and whether there is more work left.
+	OnBatchCommit(resp *Response) (*Response, bool)
+	// OnBatchError is called if a batch fails after the earlier batches are committed. The committed batches are not
+	// rolled back, so the returned error has the counts of the work they did.
+	OnBatchError(err error) error
+}
+
+// RestartableQueryRunner is implemented by the runners whose reads can continue in new transactions when they run
+// longer than a transaction is allowed to. The restarts are only used if the query is not part of an explicit
+// transaction.
+type RestartableQueryRunner interface {
+	QueryRunner
+
+	// EnableRestarts is called before the Run.
+	EnableRestarts()
+}
+
 // QueryRunnerFactory is responsible for creating query runners for different queries
 type QueryRunnerFactory struct {
 	txMgr       *transaction.Manager
@@ -75,6 +111,7 @@ func (f *QueryRunnerFactory) GetReplaceQueryRunner(r *api.ReplaceRequest) *Repla
 func (f *QueryRunnerFactory) GetUpdateQueryRunner(r *api.UpdateRequest) *UpdateQueryRunner {
 	return &UpdateQueryRunner{
 		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		mutationBatches: newMutationBatches(),
 		req:             r,
 	}
 }
@@ -82,6 +119,7 @@ func (f *QueryRunnerFactory) GetUpdateQueryRunner(r *api.UpdateRequest) *UpdateQ
 func (f *QueryRunnerFactory) GetDeleteQueryRunner(r *api.DeleteRequest) *DeleteQueryRunner {
 	return &DeleteQueryRunner{
 		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		mutationBatches: newMutationBatches(),
 		req:             r,
 	}
 }
@@ -90,11 +128,48 @@ func (f *QueryRunnerFactory) GetDeleteQueryRunner(r *api.DeleteRequest) *DeleteQ
 func (f *QueryRunnerFactory) GetStreamingQueryRunner(r *api.ReadRequest, streaming Streaming) *StreamingQueryRunner {
 	return &StreamingQueryRunner{
 		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		txMgr:           f.txMgr,
+		req:             r,
+		streaming:       streaming,
+	}
+}
+
+// GetExplainQueryRunner returns ExplainQueryRunner
+func (f *QueryRunnerFactory) GetExplainQueryRunner(r *api.ExplainRequest) *ExplainQueryRunner {
+	return &ExplainQueryRunner{
+		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		req:             r,
+	}
+}
+
+// GetAggregateQueryRunner returns AggregateQueryRunner
+func (f *QueryRunnerFactory) GetAggregateQueryRunner(r *api.AggregateRequest, streaming AggregateStreaming) *AggregateQueryRunner {
+	return &AggregateQueryRunner{
+		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		txMgr:           f.txMgr,
 		req:             r,
 		streaming:       streaming,
 	}
 }
 
+// GetCountQueryRunner returns CountQueryRunner
+func (f *QueryRunnerFactory) GetCountQueryRunner(r *api.CountRequest) *CountQueryRunner {
+	return &CountQueryRunner{
+		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		txMgr:           f.txMgr,
+		req:             r,
+	}
+}
+
+// GetDistinctQueryRunner returns DistinctQueryRunner
+func (f *QueryRunnerFactory) GetDistinctQueryRunner(r *api.DistinctRequest) *DistinctQueryRunner {
+	return &DistinctQueryRunner{
+		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
+		txMgr:           f.txMgr,
+		req:             r,
+	}
+}
+
 func (f *QueryRunnerFactory) GetCollectionQueryRunner() *CollectionQueryRunner {
 	return &CollectionQueryRunner{
 		BaseQueryRunner: NewBaseQueryRunner(f.encoder, f.cdcMgr, f.txMgr, f.searchStore),
@@ -152,77 +227,194 @@ func (runner *BaseQueryRunner) GetCollections(db *metadata.Database, collName st
 	return collection, nil
 }
 
-func (runner *BaseQueryRunner) insertOrReplace(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection, documents [][]byte, insert bool) (*internal.Timestamp, [][]byte, error) {
+func (runner *BaseQueryRunner) insertOrReplace(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection, documents [][]byte, insert bool, ifVersion int64) (*internal.Timestamp, [][]byte, error) {
 	var err error
 	var ts = internal.NewTimestamp()
 	var allKeys [][]byte
 	for _, doc := range documents {
-		var deserializedDoc map[string]interface{}
-		dec := jsoniter.NewDecoder(bytes.NewReader(doc))
-		dec.UseNumber()
-		if err = dec.Decode(&deserializedDoc); ulog.E(err) {
+		keyGen, err := runner.insertOrReplaceDocument(ctx, tx, tenant, db, coll, ts, doc, insert, ifVersion)
+		if err != nil {
 			return nil, nil, err
 		}
-		for k, v := range deserializedDoc {
-			// for schema validation, if the field is set to null, remove it.
-			if v == nil {
-				delete(deserializedDoc, k)
-			}
+		allKeys = append(allKeys, keyGen.getKeysForResp())
+	}
+	return ts, allKeys, err
+}
+
+// insertOrReplaceDocument validates and stores a single document. The returned keyGenerator has the stored document
+// that may be mutated by adding auto-generated keys. An inserted document starts with version 1, a replaced document
+// gets the next version of the existing document which must have ifVersion if it is set.
+func (runner *BaseQueryRunner) insertOrReplaceDocument(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection, ts *internal.Timestamp, doc []byte, insert bool, ifVersion int64) (*keyGenerator, error) {
+	if err := validateDocument(coll, doc); err != nil {
+		return nil, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	keyGen := newKeyGenerator(doc, runner.generator, coll.Indexes.PrimaryKey)
+	key, err := keyGen.generate(ctx, runner.encoder, table)
+	if err != nil {
+		return nil, err
+	}
+
+	// we need to use keyGen updated document as it may be mutated by adding auto-generated keys.
+	tableData := internal.NewTableDataWithTS(ts, nil, keyGen.document)
+	tableData.Version = 1
+	if insert || keyGen.forceInsert {
+		if err = checkVersion(ifVersion, nil); err != nil {
+			return nil, err
 		}
-		if err = coll.Validate(deserializedDoc); err != nil {
-			// schema validation failed
-			return nil, nil, err
+
+		// we use Insert API, in case user is using autogenerated primary key and has primary key field
+		// as Int64 or timestamp to ensure uniqueness if multiple workers end up generating same timestamp.
+		err = tx.Insert(ctx, key, tableData)
+	} else {
+		// the existing document is read for its version
+		var existing *internal.TableData
+		if existing, err = readTableData(ctx, tx, key); err != nil {
+			return nil, err
+		}
+		if err = checkVersion(ifVersion, existing); err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			tableData.Version = existing.Version + 1
 		}
 
-		table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, coll)
-		if err != nil {
-			return nil, nil, err
+		err = tx.Replace(ctx, key, tableData)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return keyGen, nil
+}
+
+// readTableData returns the stored data of the key, nil if the key doesn't exist.
+func readTableData(ctx context.Context, tx transaction.Tx, key keys.Key) (*internal.TableData, error) {
+	it, err := tx.Read(ctx, key)
+	if ulog.E(err) {
+		return nil, err
+	}
+
+	var data *internal.TableData
+	var keyValue kv.KeyValue
+	for it.Next(&keyValue) {
+		data = keyValue.Data
+	}
+
+	return data, it.Err()
+}
+
+// checkVersion returns an error if the version of the existing document is not the expected version. A zero
+// ifVersion means that there is no precondition, a missing document doesn't have any version. The documents stored
+// before the versions were introduced have version 0, so these can't be written conditionally.
+func checkVersion(ifVersion int64, existing *internal.TableData) error {
+	if ifVersion == 0 {
+		return nil
+	}
+
+	if existing == nil {
+		return api.Errorf(api.Code_FAILED_PRECONDITION, "document doesn't exist, expected version '%d'", ifVersion)
+	}
+	if existing.Version != ifVersion {
+		return api.Errorf(api.Code_FAILED_PRECONDITION, "document version is '%d', expected version '%d'", existing.Version, ifVersion)
+	}
+
+	return nil
+}
+
+// validateDocument decodes the document and validates it against the schema of the collection.
+func validateDocument(coll *schema.DefaultCollection, doc []byte) error {
+	var deserializedDoc map[string]interface{}
+	dec := jsoniter.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&deserializedDoc); ulog.E(err) {
+		return err
+	}
+	for k, v := range deserializedDoc {
+		// for schema validation, if the field is set to null, remove it.
+		if v == nil {
+			delete(deserializedDoc, k)
+		}
+	}
+
+	return coll.Validate(deserializedDoc)
+}
+
+// readKeysUsingPlan returns the primary keys of the rows that are read using the plan.
+func (runner *BaseQueryRunner) readKeysUsingPlan(ctx context.Context, tx transaction.Tx, table []byte, coll *schema.DefaultCollection, plan *planner.Plan) ([]keys.Key, error) {
+	rowReader, err := runner.buildRowReader(ctx, tx, coll, plan, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var iKeys []keys.Key
+	var seen = make(map[string]struct{})
+	var row Row
+	for rowReader.NextRow(ctx, &row) {
+		if _, ok := seen[string(row.Key)]; ok {
+			// the same row can be returned more than once i.e. an "$in" with duplicate values
+			continue
 		}
+		seen[string(row.Key)] = struct{}{}
 
-		keyGen := newKeyGenerator(doc, runner.generator, coll.Indexes.PrimaryKey)
-		key, err := keyGen.generate(ctx, runner.encoder, table)
+		key, err := runner.buildKeyFromDocument(table, coll.Indexes.PrimaryKey, row.Data.RawData)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
+		iKeys = append(iKeys, key)
+	}
 
-		// we need to use keyGen updated document as it may be mutated by adding auto-generated keys.
-		tableData := internal.NewTableDataWithTS(ts, nil, keyGen.document)
-		if insert || keyGen.forceInsert {
-			// we use Insert API, in case user is using autogenerated primary key and has primary key field
-			// as Int64 or timestamp to ensure uniqueness if multiple workers end up generating same timestamp.
-			err = tx.Insert(ctx, key, tableData)
-		} else {
-			err = tx.Replace(ctx, key, tableData)
+	return iKeys, rowReader.Err()
+}
+
+// buildKeyFromDocument returns the primary key of a stored document. The rows returned by the search only have the
+// search id, so the key is always built using the primary key fields of the document.
+func (runner *BaseQueryRunner) buildKeyFromDocument(table []byte, index *schema.Index, doc []byte) (keys.Key, error) {
+	var indexParts []interface{}
+	for _, field := range index.Fields {
+		jsonVal, _, _, err := jsonparser.Get(doc, field.FieldName)
+		if err != nil {
+			return nil, api.Errorf(api.Code_INTERNAL, errors.Wrapf(err, "missing index key column(s) '%s'", field.FieldName).Error())
 		}
+
+		v, err := value.NewValue(field.Type(), jsonVal)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		allKeys = append(allKeys, keyGen.getKeysForResp())
+		indexParts = append(indexParts, v.AsInterface())
 	}
-	return ts, allKeys, err
+
+	return runner.encoder.EncodeKey(table, index, indexParts)
 }
 
-func (runner *BaseQueryRunner) buildKeysUsingFilter(tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection, reqFilter []byte) ([]keys.Key, error) {
-	filterFactory := filter.NewFactory(coll.Fields)
-	filters, err := filterFactory.Factorize(reqFilter)
+// buildPlan returns the plan to read the rows of the collection that are matching the filter, the plan also decides
+// how the rows are returned in the order of the sort fields if the ordering is set. A search plan is only considered
+// if searchEnabled is set.
+func (runner *BaseQueryRunner) buildPlan(tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection, table []byte, reqFilter []byte, ordering qsort.Ordering, searchEnabled bool) (*planner.Plan, error) {
+	p := planner.NewPlanner(coll, table, runner.primaryKeyEncodingFunc(tenant, db, coll), searchEnabled)
+	plan, err := p.Plan(reqFilter)
 	if err != nil {
 		return nil, err
 	}
 
+	p.SetSort(plan, ordering)
+	return plan, nil
+}
+
+func (runner *BaseQueryRunner) primaryKeyEncodingFunc(tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection) func(indexParts ...interface{}) (keys.Key, error) {
 	primaryKeyIndex := coll.Indexes.PrimaryKey
-	kb := filter.NewKeyBuilder(filter.NewStrictEqKeyComposer(func(indexParts ...interface{}) (keys.Key, error) {
+	return func(indexParts ...interface{}) (keys.Key, error) {
 		encodedTable, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, coll)
 		if err != nil {
 			return nil, err
 		}
 		return runner.encoder.EncodeKey(encodedTable, primaryKeyIndex, indexParts)
-	}))
-	iKeys, err := kb.Build(filters, coll.Indexes.PrimaryKey.Fields)
-	if err != nil {
-		return nil, err
 	}
-
-	return iKeys, nil
 }
 
 type InsertQueryRunner struct {
@@ -244,7 +436,7 @@ func (runner *InsertQueryRunner) Run(ctx context.Context, tx transaction.Tx, ten
 		return nil, ctx, err
 	}
 
-	ts, allKeys, err := runner.insertOrReplace(ctx, tx, tenant, db, coll, runner.req.GetDocuments(), true)
+	ts, allKeys, err := runner.insertOrReplace(ctx, tx, tenant, db, coll, runner.req.GetDocuments(), true, 0)
 	if err != nil {
 		if err == kv.ErrDuplicateKey {
 			return nil, ctx, api.Errorf(api.Code_ALREADY_EXISTS, err.Error())
@@ -278,7 +470,7 @@ func (runner *ReplaceQueryRunner) Run(ctx context.Context, tx transaction.Tx, te
 		return nil, ctx, err
 	}
 
-	ts, allKeys, err := runner.insertOrReplace(ctx, tx, tenant, db, coll, runner.req.GetDocuments(), false)
+	ts, allKeys, err := runner.insertOrReplace(ctx, tx, tenant, db, coll, runner.req.GetDocuments(), false, runner.req.GetOptions().GetIfVersion())
 	if err != nil {
 		return nil, ctx, err
 	}
@@ -291,6 +483,7 @@ func (runner *ReplaceQueryRunner) Run(ctx context.Context, tx transaction.Tx, te
 
 type UpdateQueryRunner struct {
 	*BaseQueryRunner
+	*mutationBatches
 
 	req *api.UpdateRequest
 }
@@ -309,19 +502,14 @@ func (runner *UpdateQueryRunner) Run(ctx context.Context, tx transaction.Tx, ten
 		return nil, ctx, err
 	}
 
-	iKeys, err := runner.buildKeysUsingFilter(tenant, db, collection, runner.req.Filter)
-	if err != nil {
-		return nil, ctx, err
-	}
-
 	var factory *update.FieldOperatorFactory
-	factory, err = update.BuildFieldOperators(runner.req.Fields)
+	factory, err = update.BuildFieldOperators(runner.req.Fields, collection.Fields)
 	if err != nil {
 		return nil, ctx, err
 	}
 
-	for _, fieldOperators := range factory.FieldOperators {
-		v, err := fieldOperators.DeserializeDoc()
+	if setFieldOp := factory.FieldOperators[string(update.Set)]; setFieldOp != nil {
+		v, err := setFieldOp.DeserializeDoc()
 		if err != nil {
 			return nil, ctx, err
 		}
@@ -332,33 +520,114 @@ func (runner *UpdateQueryRunner) Run(ctx context.Context, tx transaction.Tx, ten
 		}
 	}
 
+	filters, err := filter.NewFactory(collection.Fields).Factorize(runner.req.Filter)
+	if err != nil {
+		return nil, ctx, err
+	}
+	wrappedF := filter.NewWrappedFilter(filters)
+
+	returned, err := newReturnedDocuments(runner.req.GetOptions().GetReturnDocuments(), runner.req.GetReturnFields())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+	plan, err := runner.mutationPlan(ctx, tx, tenant, db, collection, table, runner.req.Filter, runner.mutationBatches)
+	if err != nil {
+		return nil, ctx, err
+	}
+	scan, err := runner.readBatch(ctx, tx, table, collection, plan, wrappedF, runner.mutationBatches, false)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	apply := func(existing *internal.TableData) (*internal.TableData, error) {
+		if !wrappedF.Matches(existing.RawData) {
+			return nil, nil
+		}
+		if er := checkVersion(runner.req.GetOptions().GetIfVersion(), existing); er != nil {
+			return nil, er
+		}
+
+		merged, er := factory.MergeAndGet(existing.RawData)
+		if er != nil {
+			return nil, er
+		}
+
+		// the merged document is validated as the operators may make the document invalid
+		if er = validateDocument(collection, merged); er != nil {
+			return nil, er
+		}
+		if er = returned.add(existing.RawData, merged); er != nil {
+			return nil, er
+		}
+
+		// ToDo: may need to change the schema version
+		newData := internal.NewTableDataWithTS(existing.CreatedAt, ts, merged)
+		newData.Version = existing.Version + 1
+		return newData, nil
+	}
+
 	modifiedCount := int32(0)
-	for _, key := range iKeys {
-		// decode the fields now
+	for _, key := range scan.keys {
 		modified := int32(0)
-		if modified, err = tx.Update(ctx, key, func(existing *internal.TableData) (*internal.TableData, error) {
-			merged, er := factory.MergeAndGet(existing.RawData)
-			if er != nil {
-				return nil, er
-			}
-
-			// ToDo: may need to change the schema version
-			return internal.NewTableDataWithTS(existing.CreatedAt, ts, merged), nil
-		}); ulog.E(err) {
+		if modified, err = tx.Update(ctx, key, apply); ulog.E(err) {
 			return nil, ctx, err
 		}
 		modifiedCount += modified
 	}
 
+	if runner.req.GetOptions().GetUpsert() && runner.isLastBatch() && runner.modifiedCount+modifiedCount == 0 {
+		// no row is matching the filter
+		return runner.upsert(ctx, tx, tenant, db, collection, factory, filters, returned)
+	}
+
 	return &Response{
 		status:        UpdatedStatus,
 		updatedAt:     ts,
 		modifiedCount: modifiedCount,
+		documents:     returned.documents,
 	}, ctx, err
 }
 
+// upsert inserts a new document when no document is matching the filter. The document is built using the equality
+// conditions of the filter and the update operators, the keys are then generated the same way as for the inserts.
+func (runner *UpdateQueryRunner) upsert(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant, db *metadata.Database, collection *schema.DefaultCollection, factory *update.FieldOperatorFactory, filters []filter.Filter, returned *returnedDocuments) (*Response, context.Context, error) {
+	doc, err := factory.NewDocument(filters, collection.Fields)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	var ts = internal.NewTimestamp()
+	keyGen, err := runner.insertOrReplaceDocument(ctx, tx, tenant, db, collection, ts, doc, true, 0)
+	if err != nil {
+		if err == kv.ErrDuplicateKey {
+			return nil, ctx, api.Errorf(api.Code_ALREADY_EXISTS, err.Error())
+		}
+
+		return nil, ctx, err
+	}
+
+	// there is no document before the upsert
+	if err = returned.add(nil, keyGen.document); err != nil {
+		return nil, ctx, err
+	}
+
+	return &Response{
+		status:    InsertedStatus,
+		createdAt: ts,
+		updatedAt: ts,
+		allKeys:   [][]byte{keyGen.getKeysForResp()},
+		documents: returned.documents,
+	}, ctx, nil
+}
+
 type DeleteQueryRunner struct {
 	*BaseQueryRunner
+	*mutationBatches
 
 	req *api.DeleteRequest
 }
@@ -377,98 +646,519 @@ func (runner *DeleteQueryRunner) Run(ctx context.Context, tx transaction.Tx, ten
 		return nil, ctx, err
 	}
 
-	iKeys, err := runner.buildKeysUsingFilter(tenant, db, collection, runner.req.Filter)
+	filters, err := filter.NewFactory(collection.Fields).Factorize(runner.req.Filter)
+	if err != nil {
+		return nil, ctx, err
+	}
+	wrappedF := filter.NewWrappedFilter(filters)
+
+	returned, err := newReturnedDocuments(runner.req.GetOptions().GetReturnDocuments(), runner.req.GetReturnFields())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+	plan, err := runner.mutationPlan(ctx, tx, tenant, db, collection, table, runner.req.Filter, runner.mutationBatches)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	// the rows are only needed to check the version or to return them
+	keepRows := len(returned.returning) > 0 || runner.req.GetOptions().GetIfVersion() > 0
+	scan, err := runner.readBatch(ctx, tx, table, collection, plan, wrappedF, runner.mutationBatches, keepRows)
 	if err != nil {
 		return nil, ctx, err
 	}
+	if scan.matchedAll && !scan.more && canDeleteRanges(collection, plan) {
+		// the rest of the rows of the ranges are read by this batch
+		return runner.deleteRanges(ctx, tx, plan.Ranges, scan, returned, ts)
+	}
+
+	deletedCount := int32(0)
+	for i, key := range scan.keys {
+		if keepRows {
+			if err = checkVersion(runner.req.GetOptions().GetIfVersion(), scan.rows[i]); err != nil {
+				return nil, ctx, err
+			}
+			if err = returned.add(scan.rows[i].RawData, nil); err != nil {
+				return nil, ctx, err
+			}
+		}
 
-	for _, key := range iKeys {
 		if err = tx.Delete(ctx, key); ulog.E(err) {
 			return nil, ctx, err
 		}
+		deletedCount++
 	}
 
 	return &Response{
-		status:    DeletedStatus,
-		deletedAt: ts,
+		status:       DeletedStatus,
+		deletedAt:    ts,
+		deletedCount: deletedCount,
+		documents:    returned.documents,
 	}, ctx, nil
 }
 
-// StreamingQueryRunner is a runner used for Queries that are reads and needs to return result in streaming fashion
-type StreamingQueryRunner struct {
-	*BaseQueryRunner
+// canDeleteRanges returns true if the plan is a range scan whose ranges can be deleted as a whole. If the search writes
+// are enabled, the ranges must also be expressible as search filters so that the search indexer can delete the
+// documents of the ranges.
+func canDeleteRanges(collection *schema.DefaultCollection, plan *planner.Plan) bool {
+	if plan.Type != planner.RangeScanPlan {
+		return false
+	}
+	if config.DefaultConfig.Search.WriteEnabled {
+		for _, r := range plan.Ranges {
+			if _, err := keyRangeSearchFilter(collection, r.Start.IndexParts()[1:], r.End.IndexParts()[1:]); err != nil {
+				return false
+			}
+		}
+	}
 
-	req       *api.ReadRequest
-	streaming Streaming
+	return true
 }
 
-// Run is responsible for running/executing the query
-func (runner *StreamingQueryRunner) Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error) {
-	db, err := runner.GetDatabase(ctx, tx, tenant, runner.req.GetDb())
-	if err != nil {
-		return nil, ctx, err
+// batchScan is the result of reading the rows of a batch of an update or a delete.
+type batchScan struct {
+	// keys of the rows that are matching the filter, a row is only once in the keys even if the ranges overlap.
+	keys []keys.Key
+	// rows are the data of the keys, only kept if they are needed.
+	rows []*internal.TableData
+	// matchedAll is set if all the rows read are matching the filter.
+	matchedAll bool
+	// read are the keys of the rows read by the batch, lastKey is the last of them and more is set if the plan has
+	// more rows after it.
+	read    map[string]struct{}
+	lastKey []byte
+	more    bool
+}
+
+// mutationPlan returns the plan to read the rows of the next batch of an update or a delete. The search index is not
+// read in a transaction, so the keys of a search plan are resolved once and their rows are then read from the database
+// in batches like the keys of a point lookup.
+func (runner *BaseQueryRunner) mutationPlan(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant, db *metadata.Database, coll *schema.DefaultCollection, table []byte, reqFilter []byte, m *mutationBatches) (*planner.Plan, error) {
+	if m.searchKeys != nil {
+		return &planner.Plan{Type: planner.PointLookupPlan, Keys: m.searchKeys}, nil
 	}
 
-	ctx = runner.cdcMgr.WrapContext(ctx, db.Name())
+	plan, err := runner.buildPlan(tenant, db, coll, table, reqFilter, nil, m.searchEnabled())
+	if err != nil || plan.Type != planner.SearchPlan {
+		return plan, err
+	}
 
-	collection, err := runner.GetCollections(db, runner.req.GetCollection())
+	searchKeys, err := runner.readKeysUsingPlan(ctx, tx, table, coll, plan)
 	if err != nil {
-		return nil, ctx, err
+		return nil, err
+	}
+	m.searchKeys = append([]keys.Key{}, searchKeys...)
+	return &planner.Plan{Type: planner.PointLookupPlan, Keys: m.searchKeys}, nil
+}
+
+// readBatch reads the rows of the plan for the current batch. If batches are enabled, the read continues after the
+// last row read by the committed batches and stops after mutationBatchSize rows, so that every batch is only reading
+// a part of the rows in its own transaction. The keys of the rows matching the filter are collected, and the rows are
+// also kept if keepRows is set.
+func (runner *BaseQueryRunner) readBatch(ctx context.Context, tx transaction.Tx, table []byte, collection *schema.DefaultCollection, plan *planner.Plan, wrappedF *filter.WrappedFilter, m *mutationBatches, keepRows bool) (*batchScan, error) {
+	if m.lastKey != nil {
+		if err := resumeAfterKey(plan, m.lastKey); err != nil {
+			return nil, err
+		}
 	}
 
-	fieldFactory, err := read.BuildFields(runner.req.GetFields())
-	if ulog.E(err) {
-		return nil, ctx, err
+	// the rows are matched here so that the rows that are not matching are also counted in the batch
+	residual := plan.Residual
+	plan.Residual = nil
+	rowReader, err := runner.buildRowReader(ctx, tx, collection, plan, nil)
+	plan.Residual = residual
+	if err != nil {
+		return nil, err
 	}
 
-	var rowReader RowReader
-	if filter.IsFullCollectionScan(runner.req.GetFilter()) {
-		table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	scan := &batchScan{matchedAll: true, read: make(map[string]struct{})}
+	var row Row
+	for rowReader.NextRow(ctx, &row) {
+		// only the rows not read by an earlier batch are counted, so that the batch always ends on a row that is
+		// read only once and the read is resumed after it in the right key or range
+		if m.enabled && len(scan.read) == mutationBatchSize {
+			scan.more = true
+			break
+		}
+
+		scan.lastKey = row.Key
+		if _, ok := m.seen[string(row.Key)]; ok {
+			// the same row can be returned more than once i.e. overlapping ranges or an "$in" with duplicate values
+			continue
+		}
+		if _, ok := scan.read[string(row.Key)]; ok {
+			continue
+		}
+		scan.read[string(row.Key)] = struct{}{}
+
+		if !wrappedF.Matches(row.Data.RawData) {
+			scan.matchedAll = false
+			continue
+		}
+
+		key, err := runner.buildKeyFromDocument(table, collection.Indexes.PrimaryKey, row.Data.RawData)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
+		scan.keys = append(scan.keys, key)
+		if keepRows {
+			scan.rows = append(scan.rows, row.Data)
+		}
+	}
+	if err = rowReader.Err(); err != nil {
+		return nil, err
+	}
 
-		if rowReader, err = MakeDatabaseRowReader(ctx, tx, []keys.Key{keys.NewKey(table)}); ulog.E(err) {
+	if len(plan.Keys)+len(plan.Ranges) <= 1 {
+		// a single key or range never returns the same row again
+		scan.read = nil
+	}
+	m.batch = scan
+	return scan, nil
+}
+
+// deleteRanges deletes each of the ranges using a single range delete, the scan has the rows of the ranges read in
+// this transaction so the deleted count is exact.
+func (runner *DeleteQueryRunner) deleteRanges(ctx context.Context, tx transaction.Tx, ranges []filter.KeyRange, scan *batchScan, returned *returnedDocuments, ts *internal.Timestamp) (*Response, context.Context, error) {
+	for _, data := range scan.rows {
+		if err := checkVersion(runner.req.GetOptions().GetIfVersion(), data); err != nil {
 			return nil, ctx, err
 		}
-	} else {
-		filterFactory := filter.NewFactory(collection.Fields)
-		filters, err := filterFactory.Factorize(runner.req.Filter)
-		if err != nil {
+		if err := returned.add(data.RawData, nil); err != nil {
 			return nil, ctx, err
 		}
+	}
 
-		// or this is a read request that needs to be streamed after filtering the keys.
-		var iKeys []keys.Key
-		if iKeys, err = runner.buildKeysUsingFilter(tenant, db, collection, runner.req.Filter); err == nil {
-			rowReader, err = MakeDatabaseRowReader(ctx, tx, iKeys)
-		} else {
-			rowReader, err = MakeSearchRowReader(ctx, collection, nil, filters, runner.searchStore)
-		}
-		if err != nil {
+	for _, r := range ranges {
+		if err := tx.DeleteRange(ctx, r.Start, r.End); ulog.E(err) {
 			return nil, ctx, err
 		}
 	}
 
-	if err = runner.iterate(ctx, rowReader, fieldFactory); err != nil {
-		return nil, ctx, err
+	return &Response{
+		status:       DeletedStatus,
+		deletedAt:    ts,
+		deletedCount: int32(len(scan.keys)),
+		documents:    returned.documents,
+	}, ctx, nil
+}
+
+// returnedDocuments collects the documents affected by an update or a delete if the request asks to return them. The
+// documents are projected using the fields of the request.
+type returnedDocuments struct {
+	returning    string
+	fieldFactory *read.FieldFactory
+	documents    [][]byte
+}
+
+func newReturnedDocuments(returning string, reqFields []byte) (*returnedDocuments, error) {
+	fieldFactory, err := read.BuildFields(reqFields)
+	if ulog.E(err) {
+		return nil, err
 	}
 
-	return &Response{}, ctx, nil
+	return &returnedDocuments{
+		returning:    returning,
+		fieldFactory: fieldFactory,
+	}, nil
 }
 
-func (runner *StreamingQueryRunner) iterate(ctx context.Context, reader RowReader, fieldFactory *read.FieldFactory) error {
-	limit, totalResults := int64(0), int64(0)
-	if runner.req.GetOptions() != nil {
-		limit = runner.req.GetOptions().Limit
+// add collects either the document before the mutation or the document after it, depending on the option. A nil
+// document i.e. there is no document before an insert, is skipped.
+func (r *returnedDocuments) add(before []byte, after []byte) error {
+	var doc []byte
+	switch r.returning {
+	case api.ReturnDocumentsBefore:
+		doc = before
+	case api.ReturnDocumentsAfter:
+		doc = after
+	}
+	if doc == nil {
+		return nil
 	}
 
-	var row Row
+	projected, err := r.fieldFactory.Apply(doc)
+	if err != nil {
+		return err
+	}
+	r.documents = append(r.documents, projected)
+	return nil
+}
+
+// mutationBatches is used by the update and delete runners to apply the mutations on the rows matching the filter.
+// If batches are enabled, i.e. the query is not part of an explicit transaction, every transaction reads at most
+// mutationBatchSize rows and mutates the ones matching the filter, the next transaction then continues the read after
+// the last row read by the committed one. Otherwise, all the rows are read and mutated in the same transaction.
+type mutationBatches struct {
+	enabled bool
+	// searchKeys are the keys resolved using the search index, nil until they are resolved.
+	searchKeys []keys.Key
+	// lastKey is the key of the last row read by the committed batches, and seen are the keys of all the rows read by
+	// them if the plan can return the same row more than once.
+	lastKey []byte
+	seen    map[string]struct{}
+	// batch is the scan of the current batch.
+	batch *batchScan
+	// counts of all the committed batches
+	modifiedCount int32
+	deletedCount  int32
+	documents     [][]byte
+}
+
+func newMutationBatches() *mutationBatches {
+	return &mutationBatches{}
+}
+
+// EnableBatches is called before the first run if the query is not part of an explicit transaction.
+func (m *mutationBatches) EnableBatches() {
+	m.enabled = true
+}
+
+// searchEnabled returns true if the keys can be resolved using the search index. The search index doesn't have the
+// rows written earlier in an explicit transaction, so in that case the keys are always resolved from the database.
+func (m *mutationBatches) searchEnabled() bool {
+	return m.enabled && config.DefaultConfig.Search.ReadEnabled
+}
+
+// OnBatchCommit accumulates the counts of the committed batch in the response and returns true if there are more
+// rows to read.
+func (m *mutationBatches) OnBatchCommit(resp *Response) (*Response, bool) {
+	m.modifiedCount += resp.modifiedCount
+	m.deletedCount += resp.deletedCount
+	m.documents = append(m.documents, resp.documents...)
+
+	more := m.batch != nil && m.batch.more
+	if more {
+		m.lastKey = m.batch.lastKey
+		for k := range m.batch.read {
+			if m.seen == nil {
+				m.seen = make(map[string]struct{})
+			}
+			m.seen[k] = struct{}{}
+		}
+	}
+	m.batch = nil
+
+	resp.modifiedCount = m.modifiedCount
+	resp.deletedCount = m.deletedCount
+	resp.documents = m.documents
+	return resp, more
+}
+
+// OnBatchError adds the counts of the committed batches to the error of the failed batch, the query is not atomic once
+// a batch is committed.
+func (m *mutationBatches) OnBatchError(err error) error {
+	m.batch = nil
+	if m.modifiedCount == 0 && m.deletedCount == 0 {
+		return err
+	}
+
+	code := api.Code_UNKNOWN
+	var tErr *api.TigrisError
+	if errors.As(err, &tErr) {
+		code = tErr.Code
+	}
+	if m.deletedCount > 0 {
+		return api.Errorf(code, "%s, %d documents are already deleted by the committed batches", err.Error(), m.deletedCount)
+	}
+	return api.Errorf(code, "%s, %d documents are already modified by the committed batches", err.Error(), m.modifiedCount)
+}
+
+// isLastBatch returns true if the plan has no rows after the current batch.
+func (m *mutationBatches) isLastBatch() bool {
+	return m.batch == nil || !m.batch.more
+}
+
+// StreamingQueryRunner is a runner used for Queries that are reads and needs to return result in streaming fashion
+type StreamingQueryRunner struct {
+	*BaseQueryRunner
+
+	txMgr     *transaction.Manager
+	req       *api.ReadRequest
+	streaming Streaming
+	restarts  bool
+}
+
+// EnableRestarts is called if the read is not part of an explicit transaction, the rows are then read in as many
+// transactions as needed to complete the read.
+func (runner *StreamingQueryRunner) EnableRestarts() {
+	runner.restarts = true
+}
+
+// Run is responsible for running/executing the query
+func (runner *StreamingQueryRunner) Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error) {
+	db, err := runner.GetDatabase(ctx, tx, tenant, runner.req.GetDb())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	ctx = runner.cdcMgr.WrapContext(ctx, db.Name())
+
+	collection, err := runner.GetCollections(db, runner.req.GetCollection())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	fieldFactory, err := read.BuildFields(runner.req.GetFields())
+	if ulog.E(err) {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	ordering, err := qsort.UnmarshalSort(runner.req.GetSort())
+	if err != nil {
+		return nil, ctx, err
+	}
+	var sorter *qsort.Sorter
+	if len(ordering) > 0 {
+		if sorter, err = qsort.NewSorter(ordering, collection.Fields); err != nil {
+			return nil, ctx, err
+		}
+	}
+
+	// the search index doesn't have the rows written earlier in an explicit transaction
+	plan, err := runner.buildPlan(tenant, db, collection, table, runner.req.GetFilter(), ordering, runner.restarts && config.DefaultConfig.Search.ReadEnabled)
+	if err != nil {
+		return nil, ctx, err
+	}
+	if runner.req.GetOptions().GetExplain() {
+		if err = runner.streaming.Send(&api.ReadResponse{
+			Explain: toExplainResponse(plan),
+		}); ulog.E(err) {
+			return nil, ctx, err
+		}
+		return &Response{}, ctx, nil
+	}
+
+	if runner.req.GetOptions().GetSkip() < 0 {
+		return nil, ctx, api.Errorf(api.Code_INVALID_ARGUMENT, "skip can't be negative")
+	}
+	// the offset of the first row of the reader, only the reads using the offset tokens resume from an offset
+	var offset int64
+	keyToken := usesKeyResumeToken(plan)
+	if len(runner.req.GetOptions().GetOffset()) > 0 {
+		token, err := decodeResumeToken(runner.req.GetOptions().GetOffset())
+		if err != nil {
+			return nil, ctx, err
+		}
+		if keyToken != (token.key != nil) {
+			return nil, ctx, api.Errorf(api.Code_INVALID_ARGUMENT, "resume token doesn't belong to the read")
+		}
+
+		if keyToken {
+			if err = resumeAfterKey(plan, token.key); err != nil {
+				return nil, ctx, err
+			}
+		} else {
+			offset = token.offset
+		}
+	}
+
+	var restarter *readRestarter
+	if runner.restarts {
+		restarter = &readRestarter{newTx: runner.txMgr.StartTx}
+	}
+
+	rowReader, err := runner.buildRowReader(ctx, tx, collection, plan, restarter)
+	if err != nil {
+		return nil, ctx, err
+	}
+	if plan.Sort == planner.InMemorySort {
+		// the rows before the offset and the skipped rows are also sorted to find the rows that are returned
+		limit := runner.req.GetOptions().GetLimit()
+		if limit > 0 {
+			limit += offset + runner.req.GetOptions().GetSkip()
+		}
+		rowReader = MakeSortedRowReader(rowReader, sorter, limit, config.DefaultConfig.Query.MaxSortRows)
+	}
+
+	// the search index is read from the page of the offset, so the rows before it are not read
+	var skipped int64
+	if searchReader, ok := rowReader.(*SearchRowReader); ok && offset > 0 {
+		searchReader.SkipRows(offset)
+		skipped = offset
+	}
+
+	if err = runner.iterate(ctx, rowReader, fieldFactory, keyToken, offset, skipped); err != nil {
+		return nil, ctx, err
+	}
+
+	return &Response{}, ctx, nil
+}
+
+// buildRowReader returns the reader for the rows as per the plan, the rows are matched with the residual filter of the
+// plan if it has any. The database reads continue in new transactions using the restarter if it is set.
+func (runner *BaseQueryRunner) buildRowReader(ctx context.Context, tx transaction.Tx, collection *schema.DefaultCollection, plan *planner.Plan, restarter *readRestarter) (RowReader, error) {
+	var rowReader RowReader
+	var err error
+	reverse := plan.Sort == planner.ReverseKeyOrderSort
+	switch {
+	case plan.Type == planner.RangeScanPlan || len(plan.Ranges) > 0:
+		// a full scan that is resumed is also reading a range
+		rowReader, err = MakeDatabaseRowRangeReader(ctx, tx, plan.Ranges, reverse)
+	case plan.Type == planner.SearchPlan:
+		rowReader, err = MakeSearchRowReaderUsingSearchFilter(ctx, collection, plan.SearchFilter, plan.SearchSort, runner.searchStore)
+	case plan.Type == planner.FullScanPlan && reverse:
+		// the keys of the table are scanned as a single range, because only a range can be read in reverse
+		table := plan.Keys[0].Table()
+		rowReader, err = MakeDatabaseRowRangeReader(ctx, tx, []filter.KeyRange{{Start: keys.NewKey(table), End: keys.NewKey(table, keys.MaxIndexPart)}}, true)
+	default:
+		rowReader, err = MakeDatabaseRowReader(ctx, tx, plan.Keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dbReader, ok := rowReader.(*DatabaseRowReader); ok && restarter != nil {
+		dbReader.EnableRestarts(restarter)
+	}
+
+	if plan.Residual != nil {
+		rowReader = MakeFilteredRowReader(rowReader, plan.Residual)
+	}
+
+	return rowReader, nil
+}
+
+// iterate sends the rows of the reader, skipping the rows before the offset and then the number of rows in the skip
+// option. The resume token of a row is its key if keyToken is set, otherwise it is the offset after the row. The
+// skipped rows are the rows before the offset that the reader has already skipped.
+func (runner *StreamingQueryRunner) iterate(ctx context.Context, reader RowReader, fieldFactory *read.FieldFactory, keyToken bool, offset int64, skipped int64) error {
+	limit, totalResults := int64(0), int64(0)
+	var skip int64
+	if runner.req.GetOptions() != nil {
+		limit = runner.req.GetOptions().Limit
+		skip = runner.req.GetOptions().Skip
+	}
+
+	var position = skipped
+	var row Row
 	for reader.NextRow(ctx, &row) {
 		if limit > 0 && limit <= totalResults {
 			return nil
 		}
 
+		position++
+		if position <= offset {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		resumeToken := encodeOffsetResumeToken(position)
+		if keyToken {
+			resumeToken = encodeKeyResumeToken(row.Key)
+		}
+
 		newValue, err := fieldFactory.Apply(row.Data.RawData)
 		if ulog.E(err) {
 			return err
@@ -486,8 +1176,9 @@ func (runner *StreamingQueryRunner) iterate(ctx context.Context, reader RowReade
 			Metadata: &api.ResponseMetadata{
 				CreatedAt: createdAt,
 				UpdatedAt: updatedAt,
+				Version:   row.Data.Version,
 			},
-			ResumeToken: row.Key,
+			ResumeToken: resumeToken,
 		}); ulog.E(err) {
 			return err
 		}
@@ -498,6 +1189,410 @@ func (runner *StreamingQueryRunner) iterate(ctx context.Context, reader RowReade
 	return reader.Err()
 }
 
+// ExplainQueryRunner is a runner used to return the plan of a read query without executing it.
+type ExplainQueryRunner struct {
+	*BaseQueryRunner
+
+	req      *api.ExplainRequest
+	restarts bool
+}
+
+// EnableRestarts is called if the explain is not part of an explicit transaction. The plan is then the plan of a read
+// that is not part of an explicit transaction, only such a read can use the search index.
+func (runner *ExplainQueryRunner) EnableRestarts() {
+	runner.restarts = true
+}
+
+func (runner *ExplainQueryRunner) Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error) {
+	db, err := runner.GetDatabase(ctx, tx, tenant, runner.req.GetDb())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	collection, err := runner.GetCollections(db, runner.req.GetCollection())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	plan, err := runner.buildPlan(tenant, db, collection, table, runner.req.GetFilter(), nil, runner.restarts && config.DefaultConfig.Search.ReadEnabled)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	return &Response{
+		Response: toExplainResponse(plan),
+	}, ctx, nil
+}
+
+// toExplainResponse returns the plan in the form that is returned to the user.
+func toExplainResponse(plan *planner.Plan) *api.ExplainResponse {
+	resp := &api.ExplainResponse{
+		Plan:           string(plan.Type),
+		Cost:           plan.Cost,
+		Keys:           int64(len(plan.Keys)),
+		Ranges:         int64(len(plan.Ranges)),
+		SearchFilter:   plan.SearchFilter,
+		ResidualFilter: plan.Residual != nil,
+		Sort:           string(plan.Sort),
+	}
+	for _, c := range plan.Candidates {
+		resp.Candidates = append(resp.Candidates, &api.PlanCandidate{
+			Plan:   string(c.Type),
+			Cost:   c.Cost,
+			Reason: c.Reason,
+		})
+	}
+
+	return resp
+}
+
+// AggregateQueryRunner is a runner used to run the aggregation pipeline on the documents of a collection and stream
+// the documents returned by the pipeline. The $match stage is used to plan the read of the documents, and a $group that
+// only counts the documents of every value of a field is computed using the facets of the search index if the filter
+// can be pushed down to search and the aggregation is not part of an explicit transaction.
+type AggregateQueryRunner struct {
+	*BaseQueryRunner
+
+	txMgr     *transaction.Manager
+	req       *api.AggregateRequest
+	streaming AggregateStreaming
+	restarts  bool
+}
+
+// EnableRestarts is called if the aggregation is not part of an explicit transaction, the rows are then read in as
+// many transactions as needed.
+func (runner *AggregateQueryRunner) EnableRestarts() {
+	runner.restarts = true
+}
+
+func (runner *AggregateQueryRunner) Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error) {
+	db, err := runner.GetDatabase(ctx, tx, tenant, runner.req.GetDb())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	ctx = runner.cdcMgr.WrapContext(ctx, db.Name())
+
+	collection, err := runner.GetCollections(db, runner.req.GetCollection())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	pipeline, err := aggregation.UnmarshalPipeline(runner.req.GetPipeline())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	// the search index doesn't have the rows written earlier in an explicit transaction
+	searchEnabled := runner.restarts && config.DefaultConfig.Search.ReadEnabled
+	plan, err := runner.buildPlan(tenant, db, collection, table, pipeline.Match, nil, searchEnabled)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	limits := aggregation.Limits{
+		MaxGroups:   config.DefaultConfig.Query.MaxGroups,
+		MaxSortRows: config.DefaultConfig.Query.MaxSortRows,
+	}
+	emit := func(document []byte) error {
+		return runner.streaming.Send(&api.AggregateResponse{Data: document})
+	}
+
+	var groups [][]byte
+	if searchEnabled {
+		if groups, err = runner.facetGroups(ctx, collection, plan, pipeline); err != nil {
+			return nil, ctx, err
+		}
+	}
+	if groups != nil {
+		// the first stage is already computed
+		if err = runExecutor(ctx, aggregation.NewExecutor(pipeline.Stages[1:], limits, emit), &documentRowReader{documents: groups}); err != nil {
+			return nil, ctx, err
+		}
+		return &Response{}, ctx, nil
+	}
+
+	var restarter *readRestarter
+	if runner.restarts {
+		restarter = &readRestarter{newTx: runner.txMgr.StartTx}
+	}
+	rowReader, err := runner.buildRowReader(ctx, tx, collection, plan, restarter)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	if err = runExecutor(ctx, aggregation.NewExecutor(pipeline.Stages, limits, emit), rowReader); err != nil {
+		return nil, ctx, err
+	}
+
+	return &Response{}, ctx, nil
+}
+
+// facetGroups returns the documents of the $group that is the first stage of the pipeline using the facet counts of the
+// search index. It is only possible if the group counts the documents of every value of a facetable field, and all the
+// documents matching the filter can be found by the search index. Otherwise, nil is returned.
+func (runner *AggregateQueryRunner) facetGroups(ctx context.Context, collection *schema.DefaultCollection, plan *planner.Plan, pipeline *aggregation.Pipeline) ([][]byte, error) {
+	if len(pipeline.Stages) == 0 {
+		return nil, nil
+	}
+	group, ok := pipeline.Stages[0].(*aggregation.GroupStage)
+	if !ok {
+		return nil, nil
+	}
+	path, ok := group.CountField()
+	if !ok {
+		return nil, nil
+	}
+	field := facetableField(collection, path)
+	if field == nil {
+		return nil, nil
+	}
+
+	var searchFilter string
+	switch {
+	case plan.Type == planner.SearchPlan:
+		searchFilter = plan.SearchFilter
+	case plan.Type == planner.FullScanPlan && plan.Residual == nil:
+		// all the documents are counted
+	default:
+		return nil, nil
+	}
+
+	maxGroups := config.DefaultConfig.Query.MaxGroups
+	counts, err := facetCounts(ctx, runner.searchStore, collection, searchFilter, path, field.Type(), maxGroups)
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) > maxGroups {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "$group has more than %d groups", maxGroups)
+	}
+
+	return group.CountedDocuments(counts)
+}
+
+// runExecutor passes the rows of the reader to the executor until it doesn't need more documents.
+func runExecutor(ctx context.Context, exec *aggregation.Executor, reader RowReader) error {
+	var row Row
+	for reader.NextRow(ctx, &row) {
+		more, err := exec.Apply(row.Data.RawData)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return err
+	}
+
+	return exec.Done()
+}
+
+// CountQueryRunner is a runner used to count the documents matching the filter without returning them. The count of a
+// filter that is pushed down to search is the number of the documents found by the search index, otherwise the rows of
+// the keys or the key ranges of the plan are counted. Inside an explicit transaction the rows are always counted.
+type CountQueryRunner struct {
+	*BaseQueryRunner
+
+	txMgr    *transaction.Manager
+	req      *api.CountRequest
+	restarts bool
+}
+
+// EnableRestarts is called if the count is not part of an explicit transaction, the rows are then counted in as many
+// transactions as needed.
+func (runner *CountQueryRunner) EnableRestarts() {
+	runner.restarts = true
+}
+
+func (runner *CountQueryRunner) Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error) {
+	db, err := runner.GetDatabase(ctx, tx, tenant, runner.req.GetDb())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	ctx = runner.cdcMgr.WrapContext(ctx, db.Name())
+
+	collection, err := runner.GetCollections(db, runner.req.GetCollection())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	// the search index doesn't have the rows written earlier in an explicit transaction
+	plan, err := runner.buildPlan(tenant, db, collection, table, runner.req.GetFilter(), nil, runner.restarts && config.DefaultConfig.Search.ReadEnabled)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	if plan.Type == planner.SearchPlan {
+		count, err := searchCount(ctx, runner.searchStore, collection, plan.SearchFilter)
+		if err != nil {
+			return nil, ctx, err
+		}
+		return &Response{
+			Response: &api.CountResponse{Count: count},
+		}, ctx, nil
+	}
+
+	var restarter *readRestarter
+	if runner.restarts {
+		restarter = &readRestarter{newTx: runner.txMgr.StartTx}
+	}
+	rowReader, err := runner.buildRowReader(ctx, tx, collection, plan, restarter)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	var count int64
+	var row Row
+	for rowReader.NextRow(ctx, &row) {
+		count++
+	}
+	if err = rowReader.Err(); err != nil {
+		return nil, ctx, err
+	}
+
+	return &Response{
+		Response: &api.CountResponse{Count: count},
+	}, ctx, nil
+}
+
+// DistinctQueryRunner is a runner used to return the distinct values of a field of the documents matching the filter.
+// The values of a facetable field are the facet values of the search index if the filter can be pushed down to search
+// and the distinct is not part of an explicit transaction, otherwise the values are collected from the rows read by
+// the plan.
+type DistinctQueryRunner struct {
+	*BaseQueryRunner
+
+	txMgr    *transaction.Manager
+	req      *api.DistinctRequest
+	restarts bool
+}
+
+// EnableRestarts is called if the distinct is not part of an explicit transaction, the rows are then read in as many
+// transactions as needed.
+func (runner *DistinctQueryRunner) EnableRestarts() {
+	runner.restarts = true
+}
+
+func (runner *DistinctQueryRunner) Run(ctx context.Context, tx transaction.Tx, tenant *metadata.Tenant) (*Response, context.Context, error) {
+	db, err := runner.GetDatabase(ctx, tx, tenant, runner.req.GetDb())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	ctx = runner.cdcMgr.WrapContext(ctx, db.Name())
+
+	collection, err := runner.GetCollections(db, runner.req.GetCollection())
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	table, err := runner.encoder.EncodeTableName(tenant.GetNamespace(), db, collection)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	// the search index doesn't have the rows written earlier in an explicit transaction
+	searchEnabled := runner.restarts && config.DefaultConfig.Search.ReadEnabled
+	plan, err := runner.buildPlan(tenant, db, collection, table, runner.req.GetFilter(), nil, searchEnabled)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	path := runner.req.GetField()
+	distinct := aggregation.NewDistinct(path, config.DefaultConfig.Query.MaxGroups)
+	var faceted bool
+	if searchEnabled {
+		if faceted, err = runner.facetValues(ctx, collection, plan, distinct); err != nil {
+			return nil, ctx, err
+		}
+	}
+	if !faceted {
+		if err = runner.readValues(ctx, tx, collection, plan, distinct); err != nil {
+			return nil, ctx, err
+		}
+	}
+
+	values, err := distinct.Values()
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	return &Response{
+		Response: &api.DistinctResponse{Values: values},
+	}, ctx, nil
+}
+
+// facetValues adds the values of the field using the facet counts of the search index. It is only possible if the
+// field is facetable, and all the documents matching the filter can be found by the search index. Otherwise, false is
+// returned.
+func (runner *DistinctQueryRunner) facetValues(ctx context.Context, collection *schema.DefaultCollection, plan *planner.Plan, distinct *aggregation.Distinct) (bool, error) {
+	field := facetableField(collection, runner.req.GetField())
+	if field == nil {
+		return false, nil
+	}
+
+	var searchFilter string
+	switch {
+	case plan.Type == planner.SearchPlan:
+		searchFilter = plan.SearchFilter
+	case plan.Type == planner.FullScanPlan && plan.Residual == nil:
+		// the values of all the documents are returned
+	default:
+		return false, nil
+	}
+
+	counts, err := facetCounts(ctx, runner.searchStore, collection, searchFilter, runner.req.GetField(), field.Type(), config.DefaultConfig.Query.MaxGroups)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range counts {
+		if err = distinct.Add(c.Value); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// readValues adds the values of the field of the rows read by the plan.
+func (runner *DistinctQueryRunner) readValues(ctx context.Context, tx transaction.Tx, collection *schema.DefaultCollection, plan *planner.Plan, distinct *aggregation.Distinct) error {
+	var restarter *readRestarter
+	if runner.restarts {
+		restarter = &readRestarter{newTx: runner.txMgr.StartTx}
+	}
+	rowReader, err := runner.buildRowReader(ctx, tx, collection, plan, restarter)
+	if err != nil {
+		return err
+	}
+
+	var row Row
+	for rowReader.NextRow(ctx, &row) {
+		if err = distinct.Apply(row.Data.RawData); err != nil {
+			return err
+		}
+	}
+
+	return rowReader.Err()
+}
+
 type CollectionQueryRunner struct {
 	*BaseQueryRunner
 
@@ -0,0 +1,239 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/internal"
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/query/planner"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/server/config"
+	"github.com/tigrisdata/tigris/server/metadata"
+	"github.com/tigrisdata/tigris/store/kv"
+)
+
+// testMutationRows returns the rows of n documents of the collection having the primary key "pkey", "a" is 0 for the
+// even keys and 1 for the odd keys.
+func testMutationRows(t *testing.T, runner *BaseQueryRunner, table []byte, collection *schema.DefaultCollection, n int) ([]kv.KeyValue, []keys.Key) {
+	var rows []kv.KeyValue
+	var rowKeys []keys.Key
+	for i := 0; i < n; i++ {
+		doc := []byte(fmt.Sprintf(`{"pkey": %d, "a": %d}`, i, i%2))
+		key, err := runner.buildKeyFromDocument(table, collection.Indexes.PrimaryKey, doc)
+		require.NoError(t, err)
+		rows = append(rows, kv.KeyValue{FDBKey: encodeKey(key), Data: internal.NewTableData(doc)})
+		rowKeys = append(rowKeys, key)
+	}
+	return rows, rowKeys
+}
+
+func testMutationCollection(t *testing.T) *schema.DefaultCollection {
+	sch, err := schema.Build("t1", []byte(`{
+	"title": "t1",
+	"properties": {
+		"pkey": {"type": "integer"},
+		"a": {"type": "integer"}
+	},
+	"primary_key": ["pkey"]
+}`))
+	require.NoError(t, err)
+	return schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+}
+
+func TestMutationBatches(t *testing.T) {
+	collection := testMutationCollection(t)
+	table := []byte("t")
+	runner := &BaseQueryRunner{encoder: metadata.NewEncoder(nil)}
+	rows, rowKeys := testMutationRows(t, runner, table, collection, 2*mutationBatchSize+1)
+	matchAll := filter.NewWrappedFilter(nil)
+
+	// runBatches runs the batches until there are no more rows, every batch is read in a new transaction
+	// every batch runs in a transaction that is too old after reading more than a batch of rows
+	runBatches := func(m *mutationBatches, maxRows int, plan func() *planner.Plan) ([][]keys.Key, *Response) {
+		var batches [][]keys.Key
+		for {
+			scan, err := runner.readBatch(context.TODO(), &tooOldTx{rows: rows, maxRows: maxRows}, table, collection, plan(), matchAll, m, false)
+			require.NoError(t, err)
+			batches = append(batches, scan.keys)
+
+			resp, more := m.OnBatchCommit(&Response{deletedCount: int32(len(scan.keys))})
+			if !more {
+				return batches, resp
+			}
+		}
+	}
+	fullScan := func() *planner.Plan {
+		return &planner.Plan{Type: planner.FullScanPlan, Keys: []keys.Key{keys.NewKey(table)}}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		m := newMutationBatches()
+		scan, err := runner.readBatch(context.TODO(), &tooOldTx{rows: rows, maxRows: len(rows)}, table, collection, fullScan(), matchAll, m, false)
+		require.NoError(t, err)
+		require.Equal(t, rowKeys, scan.keys)
+		require.True(t, m.isLastBatch())
+	})
+	t.Run("empty", func(t *testing.T) {
+		m := newMutationBatches()
+		m.EnableBatches()
+		batches, resp := runBatches(m, mutationBatchSize+1, func() *planner.Plan {
+			return &planner.Plan{Type: planner.PointLookupPlan, Keys: []keys.Key{keys.NewKey(table, "missing")}}
+		})
+		require.Len(t, batches, 1)
+		require.Empty(t, batches[0])
+		require.Equal(t, int32(0), resp.deletedCount)
+	})
+	t.Run("enabled", func(t *testing.T) {
+		m := newMutationBatches()
+		m.EnableBatches()
+		batches, resp := runBatches(m, mutationBatchSize+1, fullScan)
+		require.Len(t, batches, 3)
+		require.Equal(t, rowKeys[:mutationBatchSize], batches[0])
+		require.Equal(t, rowKeys[mutationBatchSize:2*mutationBatchSize], batches[1])
+		require.Equal(t, rowKeys[2*mutationBatchSize:], batches[2])
+		require.Equal(t, int32(2*mutationBatchSize+1), resp.deletedCount)
+		// a single key is never read again, so the keys are not kept
+		require.Empty(t, m.seen)
+	})
+	t.Run("overlapping ranges", func(t *testing.T) {
+		m := newMutationBatches()
+		m.EnableBatches()
+		// the second range reads again the rows of the first one, they are skipped but they are read
+		batches, resp := runBatches(m, 3*mutationBatchSize, func() *planner.Plan {
+			return &planner.Plan{Type: planner.RangeScanPlan, Ranges: []filter.KeyRange{
+				{Start: rowKeys[0], End: rowKeys[mutationBatchSize+10]},
+				{Start: rowKeys[5], End: rowKeys[2*mutationBatchSize]},
+			}}
+		})
+		require.Len(t, batches, 2)
+		require.Equal(t, rowKeys[:mutationBatchSize], batches[0])
+		require.Equal(t, rowKeys[mutationBatchSize:2*mutationBatchSize], batches[1])
+		require.Equal(t, int32(2*mutationBatchSize), resp.deletedCount)
+	})
+	t.Run("retry", func(t *testing.T) {
+		m := newMutationBatches()
+		m.EnableBatches()
+		_, err := runner.readBatch(context.TODO(), &tooOldTx{rows: rows, maxRows: len(rows)}, table, collection, fullScan(), matchAll, m, false)
+		require.NoError(t, err)
+
+		// the first batch is retried before commit, so the read starts again from the first row
+		scan, err := runner.readBatch(context.TODO(), &tooOldTx{rows: rows, maxRows: len(rows)}, table, collection, fullScan(), matchAll, m, false)
+		require.NoError(t, err)
+		require.Equal(t, rowKeys[:mutationBatchSize], scan.keys)
+		resp, more := m.OnBatchCommit(&Response{modifiedCount: 3})
+		require.True(t, more)
+		require.Equal(t, int32(3), resp.modifiedCount)
+	})
+	t.Run("batch error", func(t *testing.T) {
+		m := newMutationBatches()
+		m.EnableBatches()
+		failed := api.Errorf(api.Code_ABORTED, "conflict")
+		require.Equal(t, failed, m.OnBatchError(failed))
+
+		_, err := runner.readBatch(context.TODO(), &tooOldTx{rows: rows, maxRows: len(rows)}, table, collection, fullScan(), matchAll, m, false)
+		require.NoError(t, err)
+		_, more := m.OnBatchCommit(&Response{deletedCount: mutationBatchSize})
+		require.True(t, more)
+
+		require.Equal(t, api.Errorf(api.Code_ABORTED, "conflict, 1000 documents are already deleted by the committed batches"), m.OnBatchError(failed))
+		require.Equal(t, api.Errorf(api.Code_UNKNOWN, "failed, 1000 documents are already deleted by the committed batches"), m.OnBatchError(fmt.Errorf("failed")))
+		require.True(t, m.isLastBatch())
+	})
+	t.Run("search", func(t *testing.T) {
+		readEnabled := config.DefaultConfig.Search.ReadEnabled
+		defer func() { config.DefaultConfig.Search.ReadEnabled = readEnabled }()
+		config.DefaultConfig.Search.ReadEnabled = true
+
+		// inside an explicit transaction the keys are resolved from the database
+		m := newMutationBatches()
+		require.False(t, m.searchEnabled())
+		m.EnableBatches()
+		require.True(t, m.searchEnabled())
+	})
+}
+
+func TestCheckVersion(t *testing.T) {
+	existing := &internal.TableData{Version: 2}
+
+	require.NoError(t, checkVersion(0, nil))
+	require.NoError(t, checkVersion(0, existing))
+	require.NoError(t, checkVersion(2, existing))
+	require.Equal(t, api.Errorf(api.Code_FAILED_PRECONDITION, "document version is '2', expected version '1'"), checkVersion(1, existing))
+	require.Equal(t, api.Errorf(api.Code_FAILED_PRECONDITION, "document doesn't exist, expected version '1'"), checkVersion(1, nil))
+}
+
+func TestReadBatch(t *testing.T) {
+	collection := testMutationCollection(t)
+	table := []byte("t")
+	runner := &BaseQueryRunner{encoder: metadata.NewEncoder(nil)}
+	rows, rowKeys := testMutationRows(t, runner, table, collection, mutationBatchSize+1)
+	rangeOf := func(start int, end int) filter.KeyRange {
+		return filter.KeyRange{Start: rowKeys[start], End: rowKeys[end]}
+	}
+	wrapped := func(reqFilter string) *filter.WrappedFilter {
+		filters, err := filter.NewFactory(collection.Fields).Factorize([]byte(reqFilter))
+		require.NoError(t, err)
+		return filter.NewWrappedFilter(filters)
+	}
+
+	cases := []struct {
+		name       string
+		plan       *planner.Plan
+		filter     *filter.WrappedFilter
+		keepRows   bool
+		matchedAll bool
+		more       bool
+		keys       []keys.Key
+		rows       int
+	}{
+		{
+			"overlapping ranges",
+			&planner.Plan{Ranges: []filter.KeyRange{rangeOf(0, 3), rangeOf(2, 5)}},
+			wrapped(`{}`), false, true, false, rowKeys[0:5], 0,
+		},
+		{
+			"rows kept",
+			&planner.Plan{Ranges: []filter.KeyRange{rangeOf(0, 3)}},
+			wrapped(`{}`), true, true, false, rowKeys[0:3], 3,
+		},
+		{
+			"filter",
+			&planner.Plan{Ranges: []filter.KeyRange{rangeOf(0, 4)}},
+			wrapped(`{"a": 0}`), true, false, false, []keys.Key{rowKeys[0], rowKeys[2]}, 2,
+		},
+		{
+			"more than a batch",
+			&planner.Plan{Ranges: []filter.KeyRange{{Start: rowKeys[0], End: keys.NewKey(table, keys.MaxIndexPart)}}},
+			wrapped(`{}`), false, true, true, rowKeys[:mutationBatchSize], 0,
+		},
+	}
+	for _, c := range cases {
+		m := newMutationBatches()
+		m.EnableBatches()
+		scan, err := runner.readBatch(context.TODO(), &tooOldTx{rows: rows, maxRows: len(rows)}, table, collection, c.plan, c.filter, m, c.keepRows)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.matchedAll, scan.matchedAll, c.name)
+		require.Equal(t, c.more, scan.more, c.name)
+		require.Equal(t, c.keys, scan.keys, c.name)
+		require.Len(t, scan.rows, c.rows, c.name)
+	}
+}
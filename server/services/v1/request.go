@@ -33,6 +33,11 @@ type Streaming interface {
 	api.Tigris_ReadServer
 }
 
+// AggregateStreaming is a wrapper interface for passing around for streaming the aggregation results
+type AggregateStreaming interface {
+	api.Tigris_AggregateServer
+}
+
 // ReqOptions are options used by queryLifecycle to execute a query
 type ReqOptions struct {
 	txCtx          *api.TransactionCtx
@@ -48,5 +53,7 @@ type Response struct {
 	updatedAt     *internal.Timestamp
 	deletedAt     *internal.Timestamp
 	modifiedCount int32
+	deletedCount  int32
+	documents     [][]byte
 	allKeys       [][]byte
 }
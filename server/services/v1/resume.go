@@ -0,0 +1,153 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/query/planner"
+	"github.com/tigrisdata/tigris/store/kv"
+)
+
+// The resume token is returned with every document of a read, passing it back as the offset of the read returns the
+// documents after that document. The first byte is the type of the token,
+//  - keyResumeToken is followed by the key of the row, used when the rows are returned in the order they are read
+//    from the database, so that the read restarts just after the key.
+//  - offsetResumeToken is followed by the number of the documents already returned, used for the search and the
+//    sorted reads where the documents don't have a position in the database.
+const (
+	keyResumeToken    byte = 'k'
+	offsetResumeToken byte = 'o'
+)
+
+type resumeToken struct {
+	key    []byte
+	offset int64
+}
+
+func encodeKeyResumeToken(key []byte) []byte {
+	return append([]byte{keyResumeToken}, key...)
+}
+
+func encodeOffsetResumeToken(offset int64) []byte {
+	token := make([]byte, 1+binary.MaxVarintLen64)
+	token[0] = offsetResumeToken
+	n := binary.PutUvarint(token[1:], uint64(offset))
+	return token[:1+n]
+}
+
+func decodeResumeToken(token []byte) (*resumeToken, error) {
+	if len(token) > 1 {
+		switch token[0] {
+		case keyResumeToken:
+			return &resumeToken{key: token[1:]}, nil
+		case offsetResumeToken:
+			if offset, n := binary.Uvarint(token[1:]); n == len(token)-1 {
+				return &resumeToken{offset: int64(offset)}, nil
+			}
+		}
+	}
+
+	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "invalid resume token")
+}
+
+// usesKeyResumeToken returns true if the rows of the plan are returned in the order they are read from the database.
+func usesKeyResumeToken(plan *planner.Plan) bool {
+	return plan.Type != planner.SearchPlan && plan.Sort != planner.InMemorySort
+}
+
+// resumeAfterKey changes the plan to only read the rows that are after the key in the order the plan reads them. The
+// keys and the ranges are read one after the other, so the ones before the key are dropped and the one having the key
+// is restarted after it.
+func resumeAfterKey(plan *planner.Plan, fdbKey []byte) error {
+	invalid := api.Errorf(api.Code_INVALID_ARGUMENT, "resume token doesn't belong to the read")
+	reverse := plan.Sort == planner.ReverseKeyOrderSort
+
+	var table []byte
+	if len(plan.Ranges) > 0 {
+		table = plan.Ranges[0].Start.Table()
+	} else if len(plan.Keys) > 0 {
+		table = plan.Keys[0].Table()
+	}
+	parts, err := fdbKeyParts(table, fdbKey)
+	if err != nil {
+		return invalid
+	}
+	key := keys.NewKey(table, parts...)
+	after := keys.NewKey(table, append(parts, keys.MaxIndexPart)...)
+
+	switch plan.Type {
+	case planner.PointLookupPlan:
+		for i, k := range plan.Keys {
+			if bytes.Equal(encodeKey(k), fdbKey) {
+				plan.Keys = plan.Keys[i+1:]
+				return nil
+			}
+		}
+		return invalid
+	case planner.FullScanPlan:
+		// the rest of the table is read as a range
+		plan.Ranges = []filter.KeyRange{{Start: after, End: keys.NewKey(table, keys.MaxIndexPart)}}
+		if reverse {
+			plan.Ranges = []filter.KeyRange{{Start: keys.NewKey(table), End: key}}
+		}
+		plan.Keys = nil
+		return nil
+	}
+
+	for i, r := range plan.Ranges {
+		if bytes.Compare(encodeKey(r.Start), fdbKey) > 0 || bytes.Compare(fdbKey, encodeKey(r.End)) >= 0 {
+			continue
+		}
+
+		plan.Ranges = plan.Ranges[i:]
+		if reverse {
+			plan.Ranges[0] = filter.KeyRange{Start: r.Start, End: key}
+		} else {
+			plan.Ranges[0] = filter.KeyRange{Start: after, End: r.End}
+		}
+		return nil
+	}
+
+	return invalid
+}
+
+// fdbKeyParts returns the index parts of the key of a row of the table.
+func fdbKeyParts(table []byte, fdbKey []byte) ([]interface{}, error) {
+	tp, err := subspace.FromBytes(table).Unpack(fdb.Key(fdbKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(tp) == 0 {
+		return nil, fmt.Errorf("key without index name")
+	}
+
+	var parts []interface{}
+	for _, p := range tp {
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+func encodeKey(key keys.Key) []byte {
+	return kv.FDBKey(key.Table(), kv.BuildKey(key.IndexParts()...))
+}
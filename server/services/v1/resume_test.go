@@ -0,0 +1,138 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/filter"
+	"github.com/tigrisdata/tigris/query/planner"
+)
+
+func TestResumeToken(t *testing.T) {
+	token, err := decodeResumeToken(encodeOffsetResumeToken(300))
+	require.NoError(t, err)
+	require.Equal(t, &resumeToken{offset: 300}, token)
+
+	token, err = decodeResumeToken(encodeKeyResumeToken([]byte("key")))
+	require.NoError(t, err)
+	require.Equal(t, &resumeToken{key: []byte("key")}, token)
+
+	for _, invalid := range [][]byte{[]byte("k"), []byte("x1"), {offsetResumeToken, 0x80}} {
+		_, err = decodeResumeToken(invalid)
+		require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "invalid resume token"), err)
+	}
+}
+
+func TestResumeAfterKey(t *testing.T) {
+	table := []byte("t")
+	key := func(parts ...interface{}) keys.Key { return keys.NewKey(table, parts...) }
+	invalid := api.Errorf(api.Code_INVALID_ARGUMENT, "resume token doesn't belong to the read")
+
+	cases := []struct {
+		name      string
+		plan      *planner.Plan
+		key       keys.Key
+		expKeys   []keys.Key
+		expRanges []filter.KeyRange
+		expError  error
+	}{
+		{
+			"point lookup",
+			&planner.Plan{Type: planner.PointLookupPlan, Keys: []keys.Key{key("pk", 3), key("pk", 1), key("pk", 2)}},
+			key("pk", 1),
+			[]keys.Key{key("pk", 2)},
+			nil,
+			nil,
+		},
+		{
+			"full scan",
+			&planner.Plan{Type: planner.FullScanPlan, Keys: []keys.Key{key()}},
+			key("pk", 1),
+			nil,
+			[]filter.KeyRange{{Start: key("pk", int64(1), keys.MaxIndexPart), End: key(keys.MaxIndexPart)}},
+			nil,
+		},
+		{
+			"reverse full scan",
+			&planner.Plan{Type: planner.FullScanPlan, Keys: []keys.Key{key()}, Sort: planner.ReverseKeyOrderSort},
+			key("pk", 1),
+			nil,
+			[]filter.KeyRange{{Start: key(), End: key("pk", int64(1))}},
+			nil,
+		},
+		{
+			"ranges are read in order",
+			&planner.Plan{Type: planner.RangeScanPlan, Ranges: []filter.KeyRange{
+				{Start: key("pk", 10), End: key("pk", 20)},
+				{Start: key("pk", 1), End: key("pk", 5)},
+				{Start: key("pk", 30), End: key("pk", 40)},
+			}},
+			key("pk", 3),
+			nil,
+			[]filter.KeyRange{
+				{Start: key("pk", int64(3), keys.MaxIndexPart), End: key("pk", 5)},
+				{Start: key("pk", 30), End: key("pk", 40)},
+			},
+			nil,
+		},
+		{
+			"reverse range",
+			&planner.Plan{Type: planner.RangeScanPlan, Sort: planner.ReverseKeyOrderSort, Ranges: []filter.KeyRange{
+				{Start: key("pk", 1), End: key("pk", 5)},
+			}},
+			key("pk", 3),
+			nil,
+			[]filter.KeyRange{{Start: key("pk", 1), End: key("pk", int64(3))}},
+			nil,
+		},
+		{
+			"key outside of the ranges",
+			&planner.Plan{Type: planner.RangeScanPlan, Ranges: []filter.KeyRange{{Start: key("pk", 1), End: key("pk", 5)}}},
+			key("pk", 5),
+			nil,
+			nil,
+			invalid,
+		},
+		{
+			"key of another table",
+			&planner.Plan{Type: planner.FullScanPlan, Keys: []keys.Key{key()}},
+			keys.NewKey([]byte("x"), "pk", 1),
+			nil,
+			nil,
+			invalid,
+		},
+	}
+	for _, c := range cases {
+		err := resumeAfterKey(c.plan, encodeKey(c.key))
+		require.Equal(t, c.expError, err, c.name)
+		if c.expError != nil {
+			continue
+		}
+
+		require.Equal(t, len(c.expKeys), len(c.plan.Keys), c.name)
+		for i := range c.expKeys {
+			require.Equal(t, encodeKey(c.expKeys[i]), encodeKey(c.plan.Keys[i]), c.name)
+		}
+		require.Equal(t, len(c.expRanges), len(c.plan.Ranges), c.name)
+		for i := range c.expRanges {
+			require.Equal(t, encodeKey(c.expRanges[i].Start), encodeKey(c.plan.Ranges[i].Start), c.name)
+			require.Equal(t, encodeKey(c.expRanges[i].End), encodeKey(c.plan.Ranges[i].End), c.name)
+		}
+	}
+}
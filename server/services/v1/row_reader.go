@@ -17,17 +17,22 @@ package v1
 import (
 	"context"
 	"encoding/json"
+	"sort"
 
+	"github.com/rs/zerolog/log"
+	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/internal"
 	"github.com/tigrisdata/tigris/keys"
 	"github.com/tigrisdata/tigris/query/filter"
 	"github.com/tigrisdata/tigris/query/read"
 	qsearch "github.com/tigrisdata/tigris/query/search"
+	qsort "github.com/tigrisdata/tigris/query/sort"
 	"github.com/tigrisdata/tigris/schema"
 	"github.com/tigrisdata/tigris/server/transaction"
 	"github.com/tigrisdata/tigris/store/kv"
 	"github.com/tigrisdata/tigris/store/search"
 	ulog "github.com/tigrisdata/tigris/util/log"
+	"github.com/tigrisdata/tigris/value"
 )
 
 const (
@@ -81,24 +86,37 @@ func (p *page) readRow(row *Row) bool {
 }
 
 type SearchRowReader struct {
-	pageNo     int
+	pageNo int
+	// skip is the number of the documents skipped at the start of the first page read
+	skip       int
 	page       *page
 	err        error
 	lastPage   bool
 	filter     string
+	sortBy     string
 	store      search.Store
 	result     *SearchResponse
 	collection *schema.DefaultCollection
 }
 
 func MakeSearchRowReader(ctx context.Context, collection *schema.DefaultCollection, _ []read.Field, filters []filter.Filter, store search.Store) (*SearchRowReader, error) {
-	builder := qsearch.NewBuilder()
-	searchFilter := builder.FromFilter(filters)
+	builder := qsearch.NewBuilder(collection.Fields)
+	searchFilter, err := builder.FromFilter(filters)
+	if err != nil {
+		return nil, err
+	}
 
+	return MakeSearchRowReaderUsingSearchFilter(ctx, collection, searchFilter, "", store)
+}
+
+// MakeSearchRowReaderUsingSearchFilter returns SearchRowReader for the filter that is already compiled to the search
+// filter syntax. The documents are returned in the order of sortBy if it is set.
+func MakeSearchRowReaderUsingSearchFilter(_ context.Context, collection *schema.DefaultCollection, searchFilter string, sortBy string, store search.Store) (*SearchRowReader, error) {
 	s := &SearchRowReader{
 		pageNo:     1,
 		store:      store,
 		filter:     searchFilter,
+		sortBy:     sortBy,
 		collection: collection,
 	}
 
@@ -109,8 +127,15 @@ func MakeSearchRowReaderUsingFilter(ctx context.Context, collection *schema.Defa
 	return MakeSearchRowReader(ctx, collection, nil, filters, store)
 }
 
+// SkipRows makes the reader start at the document after the offset. The pages before the page of that document are
+// not read at all.
+func (s *SearchRowReader) SkipRows(offset int64) {
+	s.pageNo = int(offset/perPage) + 1
+	s.skip = int(offset % perPage)
+}
+
 func (s *SearchRowReader) readPage(ctx context.Context) (bool, error) {
-	result, err := s.store.Search(ctx, s.collection.SearchSchema.Name, s.filter, s.pageNo, perPage)
+	result, err := s.store.Search(ctx, s.collection.SearchSchema.Name, s.filter, s.sortBy, s.pageNo, perPage)
 	if err != nil {
 		return false, err
 	}
@@ -121,13 +146,14 @@ func (s *SearchRowReader) readPage(ctx context.Context) (bool, error) {
 	}
 
 	s.page = &page{
-		idx:        0,
+		idx:        s.skip,
 		collection: s.collection,
 		resp: &pageResponse{
 			hits:   hitsResp,
 			facets: CreateFacetResponse(result[0].FacetCounts),
 		},
 	}
+	s.skip = 0
 
 	return hitsResp.Count() < perPage, nil
 }
@@ -167,7 +193,26 @@ type DatabaseRowReader struct {
 	ctx        context.Context
 	err        error
 	keys       []keys.Key
+	ranges     []filter.KeyRange
+	reverse    bool
 	kvIterator kv.Iterator
+
+	// restarter is set if the read can continue in a new transaction when the current one is too old
+	restarter *readRestarter
+	// ownTx is set once tx is a transaction started by the reader
+	ownTx bool
+	// lastKey is the key of the last row returned for the current key or range
+	lastKey []byte
+	// restarted is set if no row is returned since the last restart
+	restarted bool
+}
+
+// readRestarter starts the new transactions for the reads that are running longer than a transaction is allowed to.
+// Every new transaction reads the latest version of the database, so the rows read by the different transactions may
+// not be of the same version.
+type readRestarter struct {
+	// newTx starts a new transaction i.e. transaction.Manager.StartTx
+	newTx func(ctx context.Context) (transaction.Tx, error)
 }
 
 func MakeDatabaseRowReader(ctx context.Context, tx transaction.Tx, keys []keys.Key) (*DatabaseRowReader, error) {
@@ -177,15 +222,46 @@ func MakeDatabaseRowReader(ctx context.Context, tx transaction.Tx, keys []keys.K
 		ctx:  ctx,
 		keys: keys,
 	}
-	if d.kvIterator, d.err = d.readNextKey(d.ctx, d.keys[d.idx]); d.err != nil {
+	if len(d.keys) == 0 {
+		// nothing to read
+		return d, nil
+	}
+	if d.kvIterator, d.err = d.readNextKey(d.ctx, d.idx); d.err != nil {
+		return nil, d.err
+	}
+
+	return d, nil
+}
+
+// MakeDatabaseRowRangeReader returns a DatabaseRowReader that is scanning the key ranges instead of reading the keys.
+// The rows of a range are returned in the descending order of the keys if reverse is set.
+func MakeDatabaseRowRangeReader(ctx context.Context, tx transaction.Tx, ranges []filter.KeyRange, reverse bool) (*DatabaseRowReader, error) {
+	d := &DatabaseRowReader{
+		idx:     0,
+		tx:      tx,
+		ctx:     ctx,
+		ranges:  ranges,
+		reverse: reverse,
+	}
+	if len(d.ranges) == 0 {
+		// nothing to read
+		return d, nil
+	}
+	if d.kvIterator, d.err = d.readNextKey(d.ctx, d.idx); d.err != nil {
 		return nil, d.err
 	}
 
 	return d, nil
 }
 
+// EnableRestarts lets the reader continue the read in a new transaction, from the row after the last one returned,
+// when the current transaction is too old to read.
+func (d *DatabaseRowReader) EnableRestarts(restarter *readRestarter) {
+	d.restarter = restarter
+}
+
 func (d *DatabaseRowReader) NextRow(_ context.Context, row *Row) bool {
-	if d.err != nil {
+	if d.err != nil || d.kvIterator == nil {
 		return false
 	}
 
@@ -194,29 +270,235 @@ func (d *DatabaseRowReader) NextRow(_ context.Context, row *Row) bool {
 		if d.kvIterator.Next(&keyValue) {
 			row.Key = keyValue.FDBKey
 			row.Data = keyValue.Data
+			d.lastKey = keyValue.FDBKey
+			d.restarted = false
 			return true
 		}
-		if d.kvIterator.Err() != nil {
-			d.err = d.kvIterator.Err()
+		if err := d.kvIterator.Err(); err != nil {
+			if err == kv.ErrTransactionTooOld && d.restarter != nil {
+				if d.kvIterator, d.err = d.restart(d.ctx); d.err == nil {
+					continue
+				}
+			} else {
+				d.err = err
+			}
+			d.close()
 			return false
 		}
 
 		d.idx++
-		if d.idx == len(d.keys) {
+		d.lastKey = nil
+		if d.idx == len(d.keys)+len(d.ranges) {
+			d.close()
 			return false
 		}
 
-		d.kvIterator, d.err = d.readNextKey(d.ctx, d.keys[d.idx])
+		if d.kvIterator, d.err = d.readNextKey(d.ctx, d.idx); d.err != nil {
+			d.close()
+			return false
+		}
 	}
 }
 
-func (d *DatabaseRowReader) readNextKey(ctx context.Context, key keys.Key) (kv.Iterator, error) {
-	it, err := d.tx.Read(ctx, key)
+// restart replaces the transaction of the reader with a new one and continues the current key or range after the
+// last row that is returned.
+func (d *DatabaseRowReader) restart(ctx context.Context) (kv.Iterator, error) {
+	if d.restarted {
+		// the new transaction is also too old without reading anything, restarting again won't help
+		return nil, api.Errorf(api.Code_ABORTED, "read can't be continued, the new transaction is too old")
+	}
+
+	tx, err := d.restarter.newTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.close()
+	d.tx, d.ownTx, d.restarted = tx, true, true
+
+	if d.lastKey == nil {
+		return d.readNextKey(ctx, d.idx)
+	}
+
+	var r filter.KeyRange
+	if d.ranges != nil {
+		r = d.ranges[d.idx]
+	} else {
+		// the key is read as a prefix
+		k := d.keys[d.idx]
+		r = filter.KeyRange{Start: k, End: keys.NewKey(k.Table(), append(k.IndexParts(), keys.MaxIndexPart)...)}
+	}
+
+	parts, err := fdbKeyParts(r.Start.Table(), d.lastKey)
+	if err != nil {
+		return nil, err
+	}
+	if d.reverse {
+		r.End = keys.NewKey(r.Start.Table(), parts...)
+	} else {
+		r.Start = keys.NewKey(r.Start.Table(), append(parts, keys.MaxIndexPart)...)
+	}
+
+	log.Debug().Int("idx", d.idx).Msg("continuing the read in a new transaction")
+	return d.tx.ReadRange(ctx, r.Start, r.End, d.reverse)
+}
+
+// close ends the transaction of the reader if it is started by the reader, the transaction is only used for reads.
+func (d *DatabaseRowReader) close() {
+	if d.ownTx {
+		_ = d.tx.Rollback(d.ctx)
+		d.ownTx = false
+	}
+}
+
+func (d *DatabaseRowReader) readNextKey(ctx context.Context, idx int) (kv.Iterator, error) {
+	var it kv.Iterator
+	var err error
+	if d.ranges != nil {
+		it, err = d.tx.ReadRange(ctx, d.ranges[idx].Start, d.ranges[idx].End, d.reverse)
+	} else {
+		it, err = d.tx.Read(ctx, d.keys[idx])
+	}
 	if ulog.E(err) {
 		return nil, err
 	}
 	return it, nil
-
 }
 
 func (d *DatabaseRowReader) Err() error { return d.err }
+
+// FilteredRowReader is a RowReader that evaluates the filter on the rows returned by the underlying reader and only
+// returns the rows that are matching the filter.
+type FilteredRowReader struct {
+	reader RowReader
+	filter *filter.WrappedFilter
+}
+
+func MakeFilteredRowReader(reader RowReader, filter *filter.WrappedFilter) *FilteredRowReader {
+	return &FilteredRowReader{
+		reader: reader,
+		filter: filter,
+	}
+}
+
+func (f *FilteredRowReader) NextRow(ctx context.Context, row *Row) bool {
+	for f.reader.NextRow(ctx, row) {
+		if f.filter.Matches(row.Data.RawData) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *FilteredRowReader) Err() error { return f.reader.Err() }
+
+// documentRowReader is a RowReader returning the rows of the documents that are computed instead of read.
+type documentRowReader struct {
+	documents [][]byte
+}
+
+func (d *documentRowReader) NextRow(_ context.Context, row *Row) bool {
+	if len(d.documents) == 0 {
+		return false
+	}
+
+	row.Key = nil
+	row.Data = internal.NewTableData(d.documents[0])
+	d.documents = d.documents[1:]
+	return true
+}
+
+func (d *documentRowReader) Err() error { return nil }
+
+// SortedRowReader is a RowReader that reads all the rows of the underlying reader and returns them in the order of the
+// sorter. Only the first limit rows are kept if the limit is set, otherwise reading more than maxRows rows fails the
+// query as they would all need to be held in memory.
+type SortedRowReader struct {
+	reader  RowReader
+	sorter  *qsort.Sorter
+	keep    int
+	limited bool
+	idx     int
+	sorted  bool
+	rows    []*sortedRow
+	err     error
+}
+
+type sortedRow struct {
+	row    Row
+	values []value.Value
+}
+
+// MakeSortedRowReader returns SortedRowReader keeping at most limit rows, a limit of zero means all the rows are
+// needed.
+func MakeSortedRowReader(reader RowReader, sorter *qsort.Sorter, limit int64, maxRows int) *SortedRowReader {
+	s := &SortedRowReader{
+		reader: reader,
+		sorter: sorter,
+		keep:   maxRows,
+	}
+	if limit > 0 && limit <= int64(maxRows) {
+		s.keep = int(limit)
+		s.limited = true
+	}
+
+	return s
+}
+
+func (s *SortedRowReader) NextRow(ctx context.Context, row *Row) bool {
+	if !s.sorted {
+		s.sorted = true
+		if s.err = s.sort(ctx); s.err != nil {
+			return false
+		}
+	}
+
+	if s.idx == len(s.rows) {
+		return false
+	}
+
+	*row = s.rows[s.idx].row
+	s.idx++
+	return true
+}
+
+func (s *SortedRowReader) sort(ctx context.Context) error {
+	var row Row
+	for s.reader.NextRow(ctx, &row) {
+		values, err := s.sorter.Values(row.Data.RawData)
+		if err != nil {
+			return err
+		}
+
+		s.rows = append(s.rows, &sortedRow{row: row, values: values})
+		if len(s.rows) > s.keep {
+			if !s.limited {
+				return api.Errorf(api.Code_INVALID_ARGUMENT, "sort needs more than %d documents to be sorted in memory, use a limit or sort on the primary key", s.keep)
+			}
+			if len(s.rows) >= 2*s.keep {
+				// only the first rows are returned, so drop the rest to bound the memory
+				s.sortRows()
+				s.rows = s.rows[:s.keep]
+			}
+		}
+		row = Row{}
+	}
+	if err := s.reader.Err(); err != nil {
+		return err
+	}
+
+	s.sortRows()
+	if len(s.rows) > s.keep {
+		s.rows = s.rows[:s.keep]
+	}
+
+	return nil
+}
+
+func (s *SortedRowReader) sortRows() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return s.sorter.Compare(s.rows[i].values, s.rows[j].values) < 0
+	})
+}
+
+func (s *SortedRowReader) Err() error { return s.err }
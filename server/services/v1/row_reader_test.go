@@ -0,0 +1,284 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	api "github.com/tigrisdata/tigris/api/server/v1"
+	"github.com/tigrisdata/tigris/internal"
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/query/filter"
+	qsort "github.com/tigrisdata/tigris/query/sort"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/server/transaction"
+	"github.com/tigrisdata/tigris/store/kv"
+	"github.com/tigrisdata/tigris/store/search"
+	tsApi "github.com/typesense/typesense-go/typesense/api"
+)
+
+type sliceRowReader struct {
+	rows []Row
+}
+
+func (s *sliceRowReader) NextRow(_ context.Context, row *Row) bool {
+	if len(s.rows) == 0 {
+		return false
+	}
+	*row = s.rows[0]
+	s.rows = s.rows[1:]
+	return true
+}
+
+func (s *sliceRowReader) Err() error { return nil }
+
+func TestSortedRowReader(t *testing.T) {
+	sorter, err := qsort.NewSorter(qsort.Ordering{{Name: "a", Ascending: false}}, []*schema.Field{{FieldName: "a", DataType: schema.Int64Type}})
+	require.NoError(t, err)
+
+	testRows := func(n int) []Row {
+		var rows []Row
+		for i := 0; i < n; i++ {
+			// every value is repeated to check that the order of the equal rows is kept
+			rows = append(rows, Row{
+				Key:  []byte(fmt.Sprint(i)),
+				Data: internal.NewTableData([]byte(fmt.Sprintf(`{"a": %d}`, i/2))),
+			})
+		}
+		return rows
+	}
+	readKeys := func(reader RowReader) []string {
+		var row Row
+		var res []string
+		for reader.NextRow(context.TODO(), &row) {
+			res = append(res, string(row.Key))
+		}
+		require.NoError(t, reader.Err())
+		return res
+	}
+
+	reader := MakeSortedRowReader(&sliceRowReader{rows: testRows(6)}, sorter, 0, 10)
+	require.Equal(t, []string{"4", "5", "2", "3", "0", "1"}, readKeys(reader))
+
+	// only the limit rows are kept
+	reader = MakeSortedRowReader(&sliceRowReader{rows: testRows(100)}, sorter, 3, 10)
+	require.Equal(t, []string{"98", "99", "96"}, readKeys(reader))
+
+	reader = MakeSortedRowReader(&sliceRowReader{rows: testRows(11)}, sorter, 0, 10)
+	var row Row
+	require.False(t, reader.NextRow(context.TODO(), &row))
+	require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "sort needs more than 10 documents to be sorted in memory, use a limit or sort on the primary key"), reader.Err())
+}
+
+// tooOldTx is a read only transaction that is too old after reading maxRows rows.
+type tooOldTx struct {
+	transaction.Tx
+
+	rows       []kv.KeyValue
+	maxRows    int
+	read       int
+	rolledBack bool
+}
+
+type tooOldIterator struct {
+	tx   *tooOldTx
+	rows []kv.KeyValue
+	err  error
+}
+
+func (it *tooOldIterator) Next(value *kv.KeyValue) bool {
+	if len(it.rows) == 0 {
+		return false
+	}
+	if it.tx.read == it.tx.maxRows {
+		it.err = kv.ErrTransactionTooOld
+		return false
+	}
+
+	it.tx.read++
+	*value = it.rows[0]
+	it.rows = it.rows[1:]
+	return true
+}
+
+func (it *tooOldIterator) Err() error { return it.err }
+
+func (tx *tooOldTx) Read(_ context.Context, key keys.Key) (kv.Iterator, error) {
+	it := &tooOldIterator{tx: tx}
+	for _, r := range tx.rows {
+		if bytes.HasPrefix(r.FDBKey, encodeKey(key)) {
+			it.rows = append(it.rows, r)
+		}
+	}
+	return it, nil
+}
+
+func (tx *tooOldTx) ReadRange(_ context.Context, lKey keys.Key, rKey keys.Key, reverse bool) (kv.Iterator, error) {
+	it := &tooOldIterator{tx: tx}
+	for _, r := range tx.rows {
+		if bytes.Compare(r.FDBKey, encodeKey(lKey)) >= 0 && bytes.Compare(r.FDBKey, encodeKey(rKey)) < 0 {
+			if reverse {
+				it.rows = append([]kv.KeyValue{r}, it.rows...)
+			} else {
+				it.rows = append(it.rows, r)
+			}
+		}
+	}
+	return it, nil
+}
+
+func (tx *tooOldTx) Rollback(_ context.Context) error {
+	tx.rolledBack = true
+	return nil
+}
+
+func TestDatabaseRowReaderRestarts(t *testing.T) {
+	table := []byte("t")
+	var rows []kv.KeyValue
+	for i := 0; i < 10; i++ {
+		key := keys.NewKey(table, "pk", i)
+		rows = append(rows, kv.KeyValue{FDBKey: encodeKey(key), Data: internal.NewTableData([]byte(fmt.Sprint(i)))})
+	}
+
+	var started []*tooOldTx
+	restarter := &readRestarter{
+		newTx: func(ctx context.Context) (transaction.Tx, error) {
+			tx := &tooOldTx{rows: rows, maxRows: 3}
+			started = append(started, tx)
+			return tx, nil
+		},
+	}
+	readAll := func(reader *DatabaseRowReader) []string {
+		reader.EnableRestarts(restarter)
+
+		var row Row
+		var res []string
+		for reader.NextRow(context.TODO(), &row) {
+			res = append(res, string(row.Data.RawData))
+		}
+		require.NoError(t, reader.Err())
+		return res
+	}
+
+	cases := []struct {
+		name     string
+		reader   func(tx transaction.Tx) (*DatabaseRowReader, error)
+		expected []string
+	}{
+		{
+			"full scan",
+			func(tx transaction.Tx) (*DatabaseRowReader, error) {
+				return MakeDatabaseRowReader(context.TODO(), tx, []keys.Key{keys.NewKey(table)})
+			},
+			[]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+		},
+		{
+			"ranges",
+			func(tx transaction.Tx) (*DatabaseRowReader, error) {
+				return MakeDatabaseRowRangeReader(context.TODO(), tx, []filter.KeyRange{
+					{Start: keys.NewKey(table, "pk", 6), End: keys.NewKey(table, "pk", 10)},
+					{Start: keys.NewKey(table, "pk", 0), End: keys.NewKey(table, "pk", 3)},
+				}, false)
+			},
+			[]string{"6", "7", "8", "9", "0", "1", "2"},
+		},
+		{
+			"reverse range",
+			func(tx transaction.Tx) (*DatabaseRowReader, error) {
+				return MakeDatabaseRowRangeReader(context.TODO(), tx, []filter.KeyRange{
+					{Start: keys.NewKey(table, "pk", 2), End: keys.NewKey(table, "pk", 9)},
+				}, true)
+			},
+			[]string{"8", "7", "6", "5", "4", "3", "2"},
+		},
+	}
+	for _, c := range cases {
+		started = nil
+		tx := &tooOldTx{rows: rows, maxRows: 3}
+		reader, err := c.reader(tx)
+		require.NoError(t, err)
+
+		require.Equal(t, c.expected, readAll(reader), c.name)
+		require.NotEmpty(t, started, c.name)
+		// only the transactions started by the reader are ended by it
+		require.False(t, tx.rolledBack, c.name)
+		for _, s := range started {
+			require.True(t, s.rolledBack, c.name)
+		}
+	}
+
+	// the read is not restarted again if the new transaction is too old before reading any row
+	reader, err := MakeDatabaseRowReader(context.TODO(), &tooOldTx{rows: rows, maxRows: 3}, []keys.Key{keys.NewKey(table)})
+	require.NoError(t, err)
+	reader.EnableRestarts(&readRestarter{
+		newTx: func(ctx context.Context) (transaction.Tx, error) {
+			return &tooOldTx{rows: rows, maxRows: 0}, nil
+		},
+	})
+
+	var row Row
+	for reader.NextRow(context.TODO(), &row) {
+	}
+	require.Equal(t, api.Errorf(api.Code_ABORTED, "read can't be continued, the new transaction is too old"), reader.Err())
+}
+
+// pageStore returns the pages of the documents, and records the pages that are read.
+type pageStore struct {
+	search.NoopStore
+
+	documents []map[string]interface{}
+	pages     []int
+}
+
+func (p *pageStore) Search(_ context.Context, _ string, _ string, _ string, page int, perPage int) ([]tsApi.SearchResult, error) {
+	p.pages = append(p.pages, page)
+
+	hits := []tsApi.SearchResultHit{}
+	for i := (page - 1) * perPage; i < page*perPage && i < len(p.documents); i++ {
+		doc := p.documents[i]
+		hits = append(hits, tsApi.SearchResultHit{Document: &doc})
+	}
+	return []tsApi.SearchResult{{Hits: &hits}}, nil
+}
+
+func TestSearchRowReaderSkipRows(t *testing.T) {
+	store := &pageStore{}
+	for i := 0; i < 2*perPage+2; i++ {
+		store.documents = append(store.documents, map[string]interface{}{searchID: fmt.Sprint(i)})
+	}
+
+	reader, err := MakeSearchRowReaderUsingSearchFilter(context.TODO(), testFacetCollection(t), "", "", store)
+	require.NoError(t, err)
+	reader.SkipRows(perPage + 2)
+
+	var row Row
+	var res []string
+	for reader.NextRow(context.TODO(), &row) {
+		res = append(res, string(row.Key))
+	}
+	require.NoError(t, reader.Err())
+
+	var expected []string
+	for i := perPage + 2; i < 2*perPage+2; i++ {
+		expected = append(expected, fmt.Sprint(i))
+	}
+	require.Equal(t, expected, res)
+	// the first page is not read
+	require.Equal(t, []int{2, 3}, store.pages)
+}
@@ -19,12 +19,15 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/buger/jsonparser"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/tigrisdata/tigris/internal"
+	"github.com/tigrisdata/tigris/query/filter"
+	qsearch "github.com/tigrisdata/tigris/query/search"
 	"github.com/tigrisdata/tigris/schema"
 	"github.com/tigrisdata/tigris/server/metadata"
 	"github.com/tigrisdata/tigris/server/transaction"
@@ -70,24 +73,28 @@ func (i *SearchIndexer) OnPostCommit(ctx context.Context, tenant *metadata.Tenan
 			continue
 		}
 
+		if event.Op == kv.DeleteRangeEvent {
+			if err = i.deleteRange(ctx, collection, event); err != nil {
+				return err
+			}
+			continue
+		}
+
 		searchKey, err := CreateSearchKey(event.Table, event.Key)
 		if err != nil {
 			return err
 		}
 
 		if event.Op == kv.DeleteEvent {
-			if err = i.searchStore.DeleteDocuments(ctx, collection.SearchSchema.Name, searchKey); err != nil {
-				if err != search.ErrNotFound {
-					return err
-				}
-				return nil
+			if err = i.searchStore.DeleteDocuments(ctx, collection.SearchSchema.Name, searchKey); err != nil && err != search.ErrNotFound {
+				return err
 			}
 		} else {
 			var action string
 			switch event.Op {
 			case kv.InsertEvent, kv.ReplaceEvent:
 				action = searchUpsert
-			case kv.UpdateEvent:
+			case kv.UpdateEvent, kv.UpdateRangeEvent:
 				action = searchUpdate
 			}
 
@@ -114,6 +121,29 @@ func (i *SearchIndexer) OnPostCommit(ctx context.Context, tenant *metadata.Tenan
 	return nil
 }
 
+// deleteRange deletes the documents of the range of the primary key from the search store. The range is converted
+// back to the filter on the primary key fields, which is then used to delete the documents.
+func (i *SearchIndexer) deleteRange(ctx context.Context, collection *schema.DefaultCollection, event *kv.Event) error {
+	start, err := rangeKeyParts(event.LParts)
+	if err != nil {
+		return err
+	}
+	end, err := rangeKeyParts(event.RParts)
+	if err != nil {
+		return err
+	}
+
+	filterBy, err := keyRangeSearchFilter(collection, start, end)
+	if err != nil {
+		return err
+	}
+
+	if _, err = i.searchStore.DeleteDocumentsByFilter(ctx, collection.SearchSchema.Name, filterBy); err != nil && err != search.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
 func (i *SearchIndexer) OnPreCommit(context.Context, *metadata.Tenant, transaction.Tx, kv.EventListener) error {
 	return nil
 }
@@ -158,6 +188,46 @@ func CreateSearchKey(table []byte, fdbKey []byte) (string, error) {
 	}
 }
 
+// rangeKeyParts returns the index parts of the boundary of a range without the encoded index name.
+func rangeKeyParts(key kv.Key) ([]interface{}, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("range boundary without index name")
+	}
+
+	// the zeroth entry represents index key name
+	var parts []interface{}
+	for _, p := range key[1:] {
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// keyRangeSearchFilter returns the search filter matching the documents of the range of the primary key. The start
+// and end are the index parts of the boundaries without the encoded index name. Search only supports the range
+// filters on the numeric fields, so a range on the other fields can't be pushed down.
+func keyRangeSearchFilter(collection *schema.DefaultCollection, start []interface{}, end []interface{}) (string, error) {
+	filters, err := filter.KeyRangeFilters(collection.Indexes.PrimaryKey.Fields, start, end)
+	if err != nil {
+		return "", err
+	}
+	if len(filters) == 0 {
+		return "", &qsearch.NotPushdownError{Reason: "range is not bounded"}
+	}
+
+	for _, f := range filters {
+		sel := f.(*filter.Selector)
+		switch sel.FieldType {
+		case schema.Int32Type, schema.Int64Type, schema.DoubleType:
+		default:
+			if sel.Matcher.Type() != filter.EQ {
+				return "", &qsearch.NotPushdownError{Field: sel.Field, Reason: "range is only supported on numeric fields"}
+			}
+		}
+	}
+
+	return qsearch.NewBuilder(collection.Fields).FromFilter(filters)
+}
+
 func PackSearchFields(doc []byte, collection *schema.DefaultCollection, id string) ([]byte, error) {
 	var complexFields []string
 	for _, f := range collection.Fields {
@@ -174,6 +244,22 @@ func PackSearchFields(doc []byte, collection *schema.DefaultCollection, id strin
 			return nil, err
 		}
 
+		// the nested fields of the objects are flattened first, as the objects are stored as string
+		for _, f := range collection.Fields {
+			for _, nested := range schema.FlattenObjectField(f) {
+				value, ok := getNestedValue(data, strings.Split(nested.FieldName, schema.FieldPathSeparator))
+				if !ok {
+					continue
+				}
+				if schema.PackSearchField(nested) {
+					if value, err = jsoniter.MarshalToString(value); err != nil {
+						return nil, err
+					}
+				}
+				data[nested.FieldName] = value
+			}
+		}
+
 		for _, complex := range complexFields {
 			if value, ok := data[complex]; ok {
 				if data[complex], err = jsoniter.MarshalToString(value); err != nil {
@@ -191,8 +277,27 @@ func PackSearchFields(doc []byte, collection *schema.DefaultCollection, id strin
 	return doc, nil
 }
 
+// getNestedValue returns the value present at the path in the decoded document.
+func getNestedValue(data map[string]interface{}, path []string) (interface{}, bool) {
+	value, ok := data[path[0]]
+	if !ok || len(path) == 1 {
+		return value, ok
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return getNestedValue(nested, path[1:])
+}
+
 func UnpackSearchFields(doc *map[string]interface{}, collection *schema.DefaultCollection) error {
 	for _, f := range collection.Fields {
+		// flattened fields are only needed by search, the object itself has the value of these fields
+		for _, nested := range schema.FlattenObjectField(f) {
+			delete(*doc, nested.FieldName)
+		}
+
 		if schema.PackSearchField(f) {
 			if v, ok := (*doc)[f.FieldName]; ok {
 				var value interface{}
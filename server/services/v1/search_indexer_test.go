@@ -0,0 +1,120 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+	"github.com/tigrisdata/tigris/keys"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/store/kv"
+)
+
+func TestPackSearchFields(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"pkey": {"type": "integer"},
+		"address": {
+			"type": "object",
+			"properties": {
+				"city": {"type": "string"},
+				"geo": {
+					"type": "object",
+					"properties": {
+						"lat": {"type": "number"}
+					}
+				}
+			}
+		}
+	},
+	"primary_key": ["pkey"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	collection := schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+
+	doc := []byte(`{"pkey": 1, "address": {"city": "sf", "geo": {"lat": 37.7}}}`)
+	packed, err := PackSearchFields(doc, collection, "1")
+	require.NoError(t, err)
+
+	var searchDoc map[string]interface{}
+	require.NoError(t, jsoniter.Unmarshal(packed, &searchDoc))
+	require.Equal(t, "sf", searchDoc["address.city"])
+	require.Equal(t, 37.7, searchDoc["address.geo.lat"])
+	require.Equal(t, "1", searchDoc[searchID])
+	require.IsType(t, "", searchDoc["address"])
+
+	require.NoError(t, UnpackSearchFields(&searchDoc, collection))
+	delete(searchDoc, searchID)
+	unpacked, err := jsoniter.Marshal(searchDoc)
+	require.NoError(t, err)
+	require.JSONEq(t, string(doc), string(unpacked))
+}
+
+func TestKeyRangeSearchFilter(t *testing.T) {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"id": {"type": "integer"},
+		"name": {"type": "string"}
+	},
+	"primary_key": ["name", "id"]
+}`)
+	sch, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	collection := schema.NewDefaultCollection("t1", 1, sch.Fields, sch.Indexes, sch.Schema, "t1")
+
+	// the events of the range deletes have the parts of the keys, the first part is the index name
+	rangeParts := func(lKey kv.Key, rKey kv.Key) ([]interface{}, []interface{}) {
+		listener := &kv.DefaultListener{}
+		listener.OnClearKeyRange(kv.DeleteRangeEvent, []byte("table"), lKey, rKey)
+		event := listener.GetEvents()[0]
+		start, err := rangeKeyParts(event.LParts)
+		require.NoError(t, err)
+		end, err := rangeKeyParts(event.RParts)
+		require.NoError(t, err)
+		return start, end
+	}
+
+	cases := []struct {
+		start    kv.Key
+		end      kv.Key
+		expected string
+	}{
+		// name = "a" and id > 255
+		{kv.BuildKey("pkey", "a", int64(255), keys.MaxIndexPart), kv.BuildKey("pkey", "a", keys.MaxIndexPart), "name:=`a`&&id:>255"},
+		// name = "a" and 1 <= id < 10
+		{kv.BuildKey("pkey", "a", int64(1)), kv.BuildKey("pkey", "a", int64(10)), "name:=`a`&&id:>=1&&id:<10"},
+		// name = "a" and id = 5
+		{kv.BuildKey("pkey", "a", int64(5)), kv.BuildKey("pkey", "a", int64(5), keys.MaxIndexPart), "name:=`a`&&id:=5"},
+	}
+	for _, c := range cases {
+		start, end := rangeParts(c.start, c.end)
+		filterBy, err := keyRangeSearchFilter(collection, start, end)
+		require.NoError(t, err)
+		require.Equal(t, c.expected, filterBy)
+	}
+
+	// range on the string field is not supported by search
+	start, end := rangeParts(kv.BuildKey("pkey", "a"), kv.BuildKey("pkey", "b"))
+	_, err = keyRangeSearchFilter(collection, start, end)
+	require.Error(t, err)
+
+	_, err = rangeKeyParts(nil)
+	require.Error(t, err)
+}
@@ -14,7 +14,16 @@
 
 package v1
 
-import tsApi "github.com/typesense/typesense-go/typesense/api"
+import (
+	"context"
+	"strings"
+
+	"github.com/tigrisdata/tigris/query/aggregation"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/store/search"
+	"github.com/tigrisdata/tigris/value"
+	tsApi "github.com/typesense/typesense-go/typesense/api"
+)
 
 type pageResponse struct {
 	hits   *HitsResponse
@@ -72,3 +81,75 @@ func CreateFacetResponse(facets *[]tsApi.FacetCounts) *FacetResponse {
 
 	return nil
 }
+
+// facetableField returns the field of the path if the search index has the facets of its values. Only the fields of
+// the nested objects are indexed separately, not the fields of the objects in the arrays.
+func facetableField(collection *schema.DefaultCollection, path string) *schema.Field {
+	parts := strings.Split(path, schema.FieldPathSeparator)
+	for i := 1; i < len(parts); i++ {
+		parent := schema.GetField(collection.Fields, strings.Join(parts[:i], schema.FieldPathSeparator))
+		if parent == nil || parent.Type() != schema.ObjectType {
+			return nil
+		}
+	}
+
+	field := schema.GetField(collection.Fields, path)
+	if field == nil || !schema.FacetableField(field) {
+		return nil
+	}
+	return field
+}
+
+// facetCounts returns the number of the documents matching the search filter for every value of the field at the
+// path, the documents without a value are counted under the nil value. At most maxValues+1 values are returned, so
+// getting more than maxValues values means that the field has more values than maxValues.
+func facetCounts(ctx context.Context, store search.Store, collection *schema.DefaultCollection, searchFilter string, path string, fieldType schema.FieldType, maxValues int) ([]aggregation.GroupCount, error) {
+	result, err := store.Facets(ctx, collection.SearchSchema.Name, searchFilter, path, maxValues+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	var counts []aggregation.GroupCount
+	var counted int64
+	if result[0].FacetCounts != nil {
+		for _, fc := range *result[0].FacetCounts {
+			if fc.Counts == nil {
+				continue
+			}
+			for _, c := range *fc.Counts {
+				if c.Value == nil || c.Count == nil {
+					continue
+				}
+
+				v, err := value.NewValue(fieldType, []byte(*c.Value))
+				if err != nil {
+					return nil, err
+				}
+				counts = append(counts, aggregation.GroupCount{Value: v, Count: int64(*c.Count)})
+				counted += int64(*c.Count)
+			}
+		}
+	}
+	if found := result[0].Found; found != nil && int64(*found) > counted {
+		counts = append(counts, aggregation.GroupCount{Count: int64(*found) - counted})
+	}
+
+	return counts, nil
+}
+
+// searchCount returns the number of the documents matching the search filter, only the count of the search is
+// requested, not the documents.
+func searchCount(ctx context.Context, store search.Store, collection *schema.DefaultCollection, searchFilter string) (int64, error) {
+	result, err := store.Search(ctx, collection.SearchSchema.Name, searchFilter, "", 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(result) == 0 || result[0].Found == nil {
+		return 0, nil
+	}
+
+	return int64(*result[0].Found), nil
+}
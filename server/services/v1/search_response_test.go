@@ -0,0 +1,107 @@
+// Copyright 2022 Tigris Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tigrisdata/tigris/query/aggregation"
+	"github.com/tigrisdata/tigris/schema"
+	"github.com/tigrisdata/tigris/store/search"
+	"github.com/tigrisdata/tigris/value"
+	tsApi "github.com/typesense/typesense-go/typesense/api"
+)
+
+// facetStore returns the same count and facet counts for any search.
+type facetStore struct {
+	search.NoopStore
+
+	found   int
+	values  []string
+	counts  []int
+	facetBy string
+}
+
+func (f *facetStore) Search(_ context.Context, _ string, _ string, _ string, _ int, _ int) ([]tsApi.SearchResult, error) {
+	return []tsApi.SearchResult{{Found: &f.found}}, nil
+}
+
+func (f *facetStore) Facets(_ context.Context, _ string, _ string, facetBy string, _ int) ([]tsApi.SearchResult, error) {
+	f.facetBy = facetBy
+
+	fc := tsApi.FacetCounts{FieldName: &facetBy}
+	counts := make([]struct {
+		Count       *int    `json:"count,omitempty"`
+		Highlighted *string `json:"highlighted,omitempty"`
+		Value       *string `json:"value,omitempty"`
+	}, len(f.values))
+	for i := range f.values {
+		counts[i].Value = &f.values[i]
+		counts[i].Count = &f.counts[i]
+	}
+	fc.Counts = &counts
+
+	return []tsApi.SearchResult{{Found: &f.found, FacetCounts: &[]tsApi.FacetCounts{fc}}}, nil
+}
+
+func testFacetCollection(t *testing.T) *schema.DefaultCollection {
+	reqSchema := []byte(`{
+	"title": "t1",
+	"properties": {
+		"id": {"type": "integer"},
+		"brand": {"type": "string"},
+		"address": {"type": "object", "properties": {"zip": {"type": "integer"}}},
+		"items": {"type": "array", "items": {"type": "object", "properties": {"qty": {"type": "integer"}}}},
+		"active": {"type": "boolean"}
+	},
+	"primary_key": ["id"]
+}`)
+	factory, err := schema.Build("t1", reqSchema)
+	require.NoError(t, err)
+	return schema.NewDefaultCollection("t1", 1, factory.Fields, factory.Indexes, factory.Schema, "t1")
+}
+
+func TestFacetCounts(t *testing.T) {
+	collection := testFacetCollection(t)
+
+	require.NotNil(t, facetableField(collection, "brand"))
+	require.NotNil(t, facetableField(collection, "address.zip"))
+	require.Nil(t, facetableField(collection, "items.qty"))
+	require.Nil(t, facetableField(collection, "active"))
+	require.Nil(t, facetableField(collection, "missing"))
+
+	store := &facetStore{found: 6, values: []string{"10", "20"}, counts: []int{3, 2}}
+	counts, err := facetCounts(context.TODO(), store, collection, "", "address.zip", schema.Int64Type, 10)
+	require.NoError(t, err)
+	require.Equal(t, "address.zip", store.facetBy)
+	// the document that doesn't have the field is counted under the nil value
+	require.Equal(t, []aggregation.GroupCount{
+		{Value: value.NewIntValue(10), Count: 3},
+		{Value: value.NewIntValue(20), Count: 2},
+		{Count: 1},
+	}, counts)
+}
+
+func TestSearchCount(t *testing.T) {
+	count, err := searchCount(context.TODO(), &facetStore{found: 6}, testFacetCollection(t), "brand:=a")
+	require.NoError(t, err)
+	require.Equal(t, int64(6), count)
+
+	count, err = searchCount(context.TODO(), &search.NoopStore{}, testFacetCollection(t), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
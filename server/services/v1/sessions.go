@@ -133,12 +133,33 @@ func (sessMgr *SessionManager) Execute(ctx context.Context, req *ReqOptions) (*R
 		session.ctx = ctx
 		return resp, err
 	} else {
-		resp, err := sessMgr.executeWithRetry(ctx, req)
-		if err == kv.ErrConflictingTransaction {
-			return nil, api.Errorf(api.Code_ABORTED, err.Error())
+		batchRunner, batched := req.queryRunner.(BatchQueryRunner)
+		if batched {
+			batchRunner.EnableBatches()
+		}
+		if restartable, ok := req.queryRunner.(RestartableQueryRunner); ok {
+			restartable.EnableRestarts()
 		}
 
-		return resp, err
+		for {
+			resp, err := sessMgr.executeWithRetry(ctx, req)
+			if err == kv.ErrConflictingTransaction {
+				resp, err = nil, api.Errorf(api.Code_ABORTED, err.Error())
+			}
+			if !batched {
+				return resp, err
+			}
+			if err != nil {
+				// the batches committed before the error are not rolled back
+				return nil, batchRunner.OnBatchError(err)
+			}
+
+			// every batch is committed in its own transaction
+			var more bool
+			if resp, more = batchRunner.OnBatchCommit(resp); !more {
+				return resp, nil
+			}
+		}
 	}
 }
 
@@ -44,7 +44,9 @@ type Tx interface {
 	Replace(ctx context.Context, key keys.Key, data *internal.TableData) error
 	Update(ctx context.Context, key keys.Key, apply func(*internal.TableData) (*internal.TableData, error)) (int32, error)
 	Delete(ctx context.Context, key keys.Key) error
+	DeleteRange(ctx context.Context, lKey keys.Key, rKey keys.Key) error
 	Read(ctx context.Context, key keys.Key) (kv.Iterator, error)
+	ReadRange(ctx context.Context, lKey keys.Key, rKey keys.Key, reverse bool) (kv.Iterator, error)
 	Get(ctx context.Context, key []byte) ([]byte, error)
 	Commit(ctx context.Context) error
 	Rollback(ctx context.Context) error
@@ -224,6 +226,17 @@ func (s *TxSession) Delete(ctx context.Context, key keys.Key) error {
 	return s.kTx.Delete(ctx, key.Table(), kv.BuildKey(key.IndexParts()...))
 }
 
+func (s *TxSession) DeleteRange(ctx context.Context, lKey keys.Key, rKey keys.Key) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.validateSession(); err != nil {
+		return err
+	}
+
+	return s.kTx.DeleteRange(ctx, lKey.Table(), kv.BuildKey(lKey.IndexParts()...), kv.BuildKey(rKey.IndexParts()...))
+}
+
 func (s *TxSession) Read(ctx context.Context, key keys.Key) (kv.Iterator, error) {
 	s.Lock()
 	defer s.Unlock()
@@ -235,6 +248,17 @@ func (s *TxSession) Read(ctx context.Context, key keys.Key) (kv.Iterator, error)
 	return s.kTx.Read(ctx, key.Table(), kv.BuildKey(key.IndexParts()...))
 }
 
+func (s *TxSession) ReadRange(ctx context.Context, lKey keys.Key, rKey keys.Key, reverse bool) (kv.Iterator, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.validateSession(); err != nil {
+		return nil, err
+	}
+
+	return s.kTx.ReadRange(ctx, lKey.Table(), kv.BuildKey(lKey.IndexParts()...), kv.BuildKey(rKey.IndexParts()...), reverse)
+}
+
 func (s *TxSession) SetVersionstampedValue(ctx context.Context, key []byte, value []byte) error {
 	s.Lock()
 	defer s.Unlock()
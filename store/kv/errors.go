@@ -8,6 +8,7 @@ const (
 	ErrCodeInvalid                StoreErrCode = 0x00
 	ErrCodeDuplicateKey           StoreErrCode = 0x01
 	ErrCodeConflictingTransaction StoreErrCode = 0x02
+	ErrCodeTransactionTooOld      StoreErrCode = 0x03
 )
 
 var (
@@ -15,6 +16,8 @@ var (
 	ErrDuplicateKey = NewStoreError(ErrCodeDuplicateKey, "duplicate key value, violates key constraint")
 	// ErrConflictingTransaction is returned when there are conflicting transactions.
 	ErrConflictingTransaction = NewStoreError(ErrCodeConflictingTransaction, "transaction not committed due to conflict with another transaction")
+	// ErrTransactionTooOld is returned when a read is done after the transaction has run longer than it is allowed.
+	ErrTransactionTooOld = NewStoreError(ErrCodeTransactionTooOld, "transaction is too old to perform reads")
 )
 
 type StoreError struct {
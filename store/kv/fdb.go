@@ -25,6 +25,7 @@ import (
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 	"github.com/rs/zerolog/log"
+	"github.com/tigrisdata/tigris/keys"
 	"github.com/tigrisdata/tigris/server/config"
 	ulog "github.com/tigrisdata/tigris/util/log"
 )
@@ -91,12 +92,12 @@ func (d *fdbkv) Read(ctx context.Context, table []byte, key Key) (baseIterator,
 	return &fdbIteratorTxCloser{it, tx}, nil
 }
 
-func (d *fdbkv) ReadRange(ctx context.Context, table []byte, lKey Key, rKey Key) (baseIterator, error) {
+func (d *fdbkv) ReadRange(ctx context.Context, table []byte, lKey Key, rKey Key, reverse bool) (baseIterator, error) {
 	tx, err := d.BeginTx(ctx)
 	if err != nil {
 		return nil, err
 	}
-	it, err := tx.ReadRange(ctx, table, lKey, rKey)
+	it, err := tx.ReadRange(ctx, table, lKey, rKey, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -302,11 +303,11 @@ func (b *fbatch) Read(ctx context.Context, table []byte, key Key) (baseIterator,
 	return b.tx.Read(ctx, table, key)
 }
 
-func (b *fbatch) ReadRange(ctx context.Context, table []byte, lKey Key, rKey Key) (baseIterator, error) {
+func (b *fbatch) ReadRange(ctx context.Context, table []byte, lKey Key, rKey Key, reverse bool) (baseIterator, error) {
 	if err := b.flushBatch(ctx, lKey, rKey, nil); err != nil {
 		return nil, err
 	}
-	return b.tx.ReadRange(ctx, table, lKey, rKey)
+	return b.tx.ReadRange(ctx, table, lKey, rKey, reverse)
 }
 
 func (b *fbatch) SetVersionstampedValue(_ context.Context, _ []byte, _ []byte) error {
@@ -402,7 +403,7 @@ func (t *ftx) DeleteRange(ctx context.Context, table []byte, lKey Key, rKey Key)
 	rk := getFDBKey(table, rKey)
 
 	t.tx.ClearRange(fdb.KeyRange{Begin: lk, End: rk})
-	listener.OnClearRange(DeleteRangeEvent, table, lk, rk)
+	listener.OnClearKeyRange(DeleteRangeEvent, table, lKey, rKey)
 
 	log.Debug().Str("table", string(table)).Interface("lKey", lKey).Interface("rKey", rKey).Msg("tx delete range")
 
@@ -429,6 +430,10 @@ func (t *ftx) Update(ctx context.Context, table []byte, key Key, apply func([]by
 		if ulog.E(err) {
 			return -1, err
 		}
+		if v == nil {
+			// caller decided to skip this row
+			continue
+		}
 
 		t.tx.Set(kv.Key, v)
 		listener.OnSet(UpdateEvent, table, kv.Key, v)
@@ -459,6 +464,10 @@ func (t *ftx) UpdateRange(ctx context.Context, table []byte, lKey Key, rKey Key,
 		if ulog.E(err) {
 			return -1, err
 		}
+		if v == nil {
+			// caller decided to skip this row
+			continue
+		}
 
 		t.tx.Set(kv.Key, v)
 		listener.OnSet(UpdateRangeEvent, table, kv.Key, v)
@@ -482,13 +491,13 @@ func (t *ftx) Read(_ context.Context, table []byte, key Key) (baseIterator, erro
 	return &fdbIterator{it: r.Iterator(), subspace: subspace.FromBytes(table)}, nil
 }
 
-func (t *ftx) ReadRange(_ context.Context, table []byte, lKey Key, rKey Key) (baseIterator, error) {
+func (t *ftx) ReadRange(_ context.Context, table []byte, lKey Key, rKey Key, reverse bool) (baseIterator, error) {
 	lk := getFDBKey(table, lKey)
 	rk := getFDBKey(table, rKey)
 
-	r := t.tx.GetRange(fdb.KeyRange{Begin: lk, End: rk}, fdb.RangeOptions{})
+	r := t.tx.GetRange(fdb.KeyRange{Begin: lk, End: rk}, fdb.RangeOptions{Reverse: reverse})
 
-	log.Debug().Str("table", string(table)).Interface("lKey", lKey).Interface("rKey", rKey).Msg("tx read range")
+	log.Debug().Str("table", string(table)).Interface("lKey", lKey).Interface("rKey", rKey).Bool("reverse", reverse).Msg("tx read range")
 
 	return &fdbIterator{it: r.Iterator(), subspace: subspace.FromBytes(table)}, nil
 }
@@ -576,6 +585,11 @@ func (i *fdbIterator) Next(kv *baseKeyValue) bool {
 	tkv, err := i.it.Get()
 	if ulog.E(err) {
 		i.err = err
+		var ep fdb.Error
+		if errors.As(err, &ep) && ep.Code == 1007 {
+			// transaction_too_old, the caller can continue the read in a new transaction
+			i.err = ErrTransactionTooOld
+		}
 		return false
 	}
 
@@ -618,7 +632,11 @@ func (i *fdbIteratorTxCloser) Next(kv *baseKeyValue) bool {
 func getFDBKey(table []byte, key Key) fdb.Key {
 	s := subspace.FromBytes(table)
 	var k fdb.Key
-	if len(key) == 0 {
+	if n := len(key); n > 0 && key[n-1] == keys.MaxIndexPart {
+		// the key is a boundary of a range that needs to sort after all the keys having the remaining parts as prefix,
+		// no tuple element is encoded using 0xFF as type code so appending it is enough.
+		k = append(getFDBKey(table, key[:n-1]), 0xFF)
+	} else if n == 0 {
 		k = s.FDBKey()
 	} else {
 		p := unsafe.Pointer(&key)
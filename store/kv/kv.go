@@ -34,8 +34,13 @@ type KV interface {
 	Delete(ctx context.Context, table []byte, key Key) error
 	DeleteRange(ctx context.Context, table []byte, lKey Key, rKey Key) error
 	Read(ctx context.Context, table []byte, key Key) (Iterator, error)
-	ReadRange(ctx context.Context, table []byte, lkey Key, rkey Key) (Iterator, error)
+	// ReadRange reads the rows in the range [lkey, rkey), in the descending order of the keys if reverse is set.
+	ReadRange(ctx context.Context, table []byte, lkey Key, rkey Key, reverse bool) (Iterator, error)
+	// Update calls apply for the row of the key, the row is left untouched if apply returns nil data. Returns the
+	// number of rows modified.
 	Update(ctx context.Context, table []byte, key Key, apply func(*internal.TableData) (*internal.TableData, error)) (int32, error)
+	// UpdateRange calls apply for all the rows in the range [lKey, rKey), the row is left untouched if apply returns nil
+	// data. Returns the number of rows modified.
 	UpdateRange(ctx context.Context, table []byte, lKey Key, rKey Key, apply func(*internal.TableData) (*internal.TableData, error)) (int32, error)
 	SetVersionstampedValue(ctx context.Context, key []byte, value []byte) error
 	SetVersionstampedKey(ctx context.Context, key []byte, value []byte) error
@@ -104,8 +109,8 @@ func (k *KeyValueStoreImpl) Read(ctx context.Context, table []byte, key Key) (It
 	}, nil
 }
 
-func (k *KeyValueStoreImpl) ReadRange(ctx context.Context, table []byte, lkey Key, rkey Key) (Iterator, error) {
-	iter, err := k.fdbkv.ReadRange(ctx, table, lkey, rkey)
+func (k *KeyValueStoreImpl) ReadRange(ctx context.Context, table []byte, lkey Key, rkey Key, reverse bool) (Iterator, error) {
+	iter, err := k.fdbkv.ReadRange(ctx, table, lkey, rkey, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +127,7 @@ func (k *KeyValueStoreImpl) Update(ctx context.Context, table []byte, key Key, a
 		}
 
 		newData, err := apply(decoded)
-		if err != nil {
+		if err != nil || newData == nil {
 			return nil, err
 		}
 
@@ -143,7 +148,7 @@ func (k *KeyValueStoreImpl) UpdateRange(ctx context.Context, table []byte, lKey
 		}
 
 		newData, err := apply(decoded)
-		if err != nil {
+		if err != nil || newData == nil {
 			return nil, err
 		}
 
@@ -203,8 +208,8 @@ func (tx *TxImpl) Read(ctx context.Context, table []byte, key Key) (Iterator, er
 	}, nil
 }
 
-func (tx *TxImpl) ReadRange(ctx context.Context, table []byte, lkey Key, rkey Key) (Iterator, error) {
-	iter, err := tx.ftx.ReadRange(ctx, table, lkey, rkey)
+func (tx *TxImpl) ReadRange(ctx context.Context, table []byte, lkey Key, rkey Key, reverse bool) (Iterator, error) {
+	iter, err := tx.ftx.ReadRange(ctx, table, lkey, rkey, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -221,7 +226,7 @@ func (tx *TxImpl) Update(ctx context.Context, table []byte, key Key, apply func(
 		}
 
 		newData, err := apply(decoded)
-		if err != nil {
+		if err != nil || newData == nil {
 			return nil, err
 		}
 
@@ -242,7 +247,7 @@ func (tx *TxImpl) UpdateRange(ctx context.Context, table []byte, lKey Key, rKey
 		}
 
 		newData, err := apply(decoded)
-		if err != nil {
+		if err != nil || newData == nil {
 			return nil, err
 		}
 
@@ -291,6 +296,11 @@ func BuildKey(parts ...interface{}) Key {
 	return *(*Key)(ptr)
 }
 
+// FDBKey returns the key of the table as it is stored in FoundationDB, which is the FDBKey of the rows read using it.
+func FDBKey(table []byte, key Key) []byte {
+	return getFDBKey(table, key)
+}
+
 func (k *Key) AddPart(part interface{}) {
 	*k = append(*k, KeyPart(part))
 }
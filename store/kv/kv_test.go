@@ -104,7 +104,7 @@ func testKeyValueStoreBasic(t *testing.T, kv KeyValueStore) {
 	require.Equal(t, []KeyValue{{Key: BuildKey("p1", int64(2)), FDBKey: getFDBKey(table, BuildKey("p1", int64(2))), Data: replacedValue2}}, v)
 
 	// read range
-	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 2), BuildKey("p1", 4))
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 2), BuildKey("p1", 4), false)
 	require.NoError(t, err)
 
 	v = readAllUsingIterator(t, it)
@@ -127,7 +127,7 @@ func testKeyValueStoreBasic(t *testing.T, kv KeyValueStore) {
 	require.NoError(t, err)
 	require.Equal(t, int32(3), modifiedCount)
 
-	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 3), BuildKey("p1", 6))
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 3), BuildKey("p1", 6), false)
 	require.NoError(t, err)
 
 	v = readAllUsingIterator(t, it)
@@ -137,6 +137,17 @@ func testKeyValueStoreBasic(t *testing.T, kv KeyValueStore) {
 		{Key: BuildKey("p1", int64(5)), FDBKey: getFDBKey(table, BuildKey("p1", int64(5))), Data: updatedData[2]},
 	}, v)
 
+	// reverse read range
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 3), BuildKey("p1", 6), true)
+	require.NoError(t, err)
+
+	v = readAllUsingIterator(t, it)
+	require.Equal(t, []KeyValue{
+		{Key: BuildKey("p1", int64(5)), FDBKey: getFDBKey(table, BuildKey("p1", int64(5))), Data: updatedData[2]},
+		{Key: BuildKey("p1", int64(4)), FDBKey: getFDBKey(table, BuildKey("p1", int64(4))), Data: updatedData[1]},
+		{Key: BuildKey("p1", int64(3)), FDBKey: getFDBKey(table, BuildKey("p1", int64(3))), Data: updatedData[0]},
+	}, v)
+
 	// prefix read
 	it, err = kv.Read(ctx, table, BuildKey("p1"))
 	require.NoError(t, err)
@@ -157,7 +168,7 @@ func testKeyValueStoreBasic(t *testing.T, kv KeyValueStore) {
 	err = kv.DeleteRange(ctx, table, BuildKey("p1", 3), BuildKey("p2", 6))
 	require.NoError(t, err)
 
-	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 1), BuildKey("p1", 6))
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 1), BuildKey("p1", 6), false)
 	require.NoError(t, err)
 
 	v = readAllUsingIterator(t, it)
@@ -258,7 +269,7 @@ func testKVBasic(t *testing.T, kv baseKVStore) {
 	require.Equal(t, []baseKeyValue{{Key: BuildKey("p1", int64(2)), FDBKey: getFDBKey(table, BuildKey("p1", int64(2))), Value: []byte("value2+2")}}, v)
 
 	// read range
-	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 2), BuildKey("p1", 4))
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 2), BuildKey("p1", 4), false)
 	require.NoError(t, err)
 
 	v = readAll(t, it)
@@ -279,7 +290,7 @@ func testKVBasic(t *testing.T, kv baseKVStore) {
 	require.NoError(t, err)
 	require.Equal(t, int32(3), modifiedCount)
 
-	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 3), BuildKey("p1", 6))
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 3), BuildKey("p1", 6), false)
 	require.NoError(t, err)
 
 	v = readAll(t, it)
@@ -309,7 +320,7 @@ func testKVBasic(t *testing.T, kv baseKVStore) {
 	err = kv.DeleteRange(ctx, table, BuildKey("p1", 3), BuildKey("p2", 6))
 	require.NoError(t, err)
 
-	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 1), BuildKey("p1", 6))
+	it, err = kv.ReadRange(ctx, table, BuildKey("p1", 1), BuildKey("p1", 6), false)
 	require.NoError(t, err)
 
 	v = readAll(t, it)
@@ -38,6 +38,8 @@ type EventListener interface {
 	OnSet(op string, table []byte, key []byte, data []byte)
 	// OnClearRange buffers delete events
 	OnClearRange(op string, table []byte, lKey []byte, rKey []byte)
+	// OnClearKeyRange buffers delete range events, the event also has the parts of the keys of the range
+	OnClearKeyRange(op string, table []byte, lKey Key, rKey Key)
 	// GetEvents is used to access buffered events. These events may be shared by different participants callers are
 	// strongly discourage to modify the event and if needed copy it to some other buffer. Once transaction completes
 	// session may discard all the buffered events.
@@ -52,6 +54,9 @@ type Event struct {
 	RKey  []byte `json:",omitempty"`
 	Data  []byte `json:",omitempty"`
 	Last  bool
+	// LParts and RParts are the parts of the keys of a key range, these are only set by OnClearKeyRange.
+	LParts Key `json:"-"`
+	RParts Key `json:"-"`
 }
 
 type DefaultListener struct {
@@ -75,6 +80,18 @@ func (l *DefaultListener) OnClearRange(op string, table []byte, lKey []byte, rKe
 		RKey:  rKey,
 	})
 }
+func (l *DefaultListener) OnClearKeyRange(op string, table []byte, lKey Key, rKey Key) {
+	lk, rk := getFDBKey(table, lKey), getFDBKey(table, rKey)
+	l.Events = append(l.Events, &Event{
+		Op:     op,
+		Table:  table,
+		Key:    lk,
+		LKey:   lk,
+		RKey:   rk,
+		LParts: lKey,
+		RParts: rKey,
+	})
+}
 func (l *DefaultListener) GetEvents() []*Event {
 	return l.Events
 }
@@ -83,6 +100,7 @@ type NoopEventListener struct{}
 
 func (l *NoopEventListener) OnSet(op string, table []byte, key []byte, data []byte)         {}
 func (l *NoopEventListener) OnClearRange(op string, table []byte, lKey []byte, rKey []byte) {}
+func (l *NoopEventListener) OnClearKeyRange(op string, table []byte, lKey Key, rKey Key)    {}
 func (l *NoopEventListener) GetEvents() []*Event                                            { return nil }
 
 func WrapEventListenerCtx(ctx context.Context) context.Context {
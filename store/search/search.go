@@ -29,7 +29,12 @@ type Store interface {
 	DropCollection(ctx context.Context, table string) error
 	IndexDocuments(ctx context.Context, table string, documents io.Reader, options IndexDocumentsOptions) error
 	DeleteDocuments(ctx context.Context, table string, key string) error
-	Search(ctx context.Context, table string, filterBy string, page int, perPage int) ([]tsApi.SearchResult, error)
+	DeleteDocumentsByFilter(ctx context.Context, table string, filterBy string) (int, error)
+	// Search returns the page of the documents matching filterBy, sorted on sortBy if it is not empty.
+	Search(ctx context.Context, table string, filterBy string, sortBy string, page int, perPage int) ([]tsApi.SearchResult, error)
+	// Facets returns the number of the documents matching filterBy and the counts of the values of the facetBy field
+	// in these documents, at most maxValues values are counted.
+	Facets(ctx context.Context, table string, filterBy string, facetBy string, maxValues int) ([]tsApi.SearchResult, error)
 }
 
 func NewStore(config *config.SearchConfig) (Store, error) {
@@ -51,6 +56,12 @@ func (n *NoopStore) IndexDocuments(_ context.Context, _ string, _ io.Reader, _ I
 	return nil
 }
 func (n *NoopStore) DeleteDocuments(_ context.Context, _ string, _ string) error { return nil }
-func (n *NoopStore) Search(_ context.Context, _ string, _ string, _ int, _ int) ([]tsApi.SearchResult, error) {
+func (n *NoopStore) DeleteDocumentsByFilter(_ context.Context, _ string, _ string) (int, error) {
+	return 0, nil
+}
+func (n *NoopStore) Search(_ context.Context, _ string, _ string, _ string, _ int, _ int) ([]tsApi.SearchResult, error) {
+	return nil, nil
+}
+func (n *NoopStore) Facets(_ context.Context, _ string, _ string, _ string, _ int) ([]tsApi.SearchResult, error) {
 	return nil, nil
 }
@@ -54,6 +54,15 @@ func (s *storeImpl) DeleteDocuments(_ context.Context, table string, key string)
 	return s.convertToInternalError(err)
 }
 
+// DeleteDocumentsByFilter deletes all the documents of the table matching the filter and returns the number of
+// documents deleted.
+func (s *storeImpl) DeleteDocumentsByFilter(_ context.Context, table string, filterBy string) (int, error) {
+	count, err := s.client.Collection(table).Documents().Delete(&tsApi.DeleteDocumentsParams{
+		FilterBy: &filterBy,
+	})
+	return count, s.convertToInternalError(err)
+}
+
 func (s *storeImpl) IndexDocuments(_ context.Context, table string, reader io.Reader, options IndexDocumentsOptions) (err error) {
 	var closer io.ReadCloser
 	closer, err = s.client.Collection(table).Documents().ImportJsonl(reader, &tsApi.ImportDocumentsParams{
@@ -91,18 +100,50 @@ func (s *storeImpl) IndexDocuments(_ context.Context, table string, reader io.Re
 	return nil
 }
 
-func (s *storeImpl) Search(_ context.Context, table string, filterBy string, page int, perPage int) ([]tsApi.SearchResult, error) {
+func (s *storeImpl) Search(_ context.Context, table string, filterBy string, sortBy string, page int, perPage int) ([]tsApi.SearchResult, error) {
+	q := "*"
+	params := tsApi.MultiSearchParameters{
+		FilterBy: &filterBy,
+		Q:        &q,
+		Page:     &page,
+		PerPage:  &perPage,
+	}
+	if len(sortBy) > 0 {
+		params.SortBy = &sortBy
+	}
+
+	res, err := s.client.MultiSearch.Perform(&tsApi.MultiSearchParams{}, tsApi.MultiSearchSearchesParameter{
+		Searches: []tsApi.MultiSearchCollectionParameters{
+			{
+				Collection:            table,
+				MultiSearchParameters: params,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Results, nil
+}
+
+func (s *storeImpl) Facets(_ context.Context, table string, filterBy string, facetBy string, maxValues int) ([]tsApi.SearchResult, error) {
 	q := "*"
+	// only the counts are needed, not the documents
+	perPage := 0
+	params := tsApi.MultiSearchParameters{
+		FilterBy:       &filterBy,
+		Q:              &q,
+		PerPage:        &perPage,
+		FacetBy:        &facetBy,
+		MaxFacetValues: &maxValues,
+	}
+
 	res, err := s.client.MultiSearch.Perform(&tsApi.MultiSearchParams{}, tsApi.MultiSearchSearchesParameter{
 		Searches: []tsApi.MultiSearchCollectionParameters{
 			{
-				Collection: table,
-				MultiSearchParameters: tsApi.MultiSearchParameters{
-					FilterBy: &filterBy,
-					Q:        &q,
-					Page:     &page,
-					PerPage:  &perPage,
-				},
+				Collection:            table,
+				MultiSearchParameters: params,
 			},
 		},
 	})
@@ -853,6 +853,22 @@ func (s *DocumentSuite) TestUpdate_SchemaValidationError() {
 			},
 			"json schema validation failed for field 'int_value' reason 'expected integer, but got string'",
 			api.Code_INVALID_ARGUMENT,
+		}, {
+			Map{
+				"$set": Map{
+					"object_value.name": 1,
+				},
+			},
+			"json schema validation failed for field 'object_value/name' reason 'expected string, but got number'",
+			api.Code_INVALID_ARGUMENT,
+		}, {
+			Map{
+				"$set": Map{
+					"pkey_int": 2,
+				},
+			},
+			"primary key field 'pkey_int' can't be updated using '$set'",
+			api.Code_INVALID_ARGUMENT,
 		},
 	}
 	for _, c := range cases {
@@ -867,6 +883,204 @@ func (s *DocumentSuite) TestUpdate_SchemaValidationError() {
 	}
 }
 
+func (s *DocumentSuite) TestUpdate_UnsetFields() {
+	inputDocument := []Doc{
+		{
+			"pkey_int":     110,
+			"int_value":    100,
+			"string_value": "simple_insert1_unset",
+			"bool_value":   true,
+			"object_value": Map{
+				"name": "unset",
+			},
+		},
+	}
+
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{
+				"pkey_int": 110,
+			},
+		},
+		Map{
+			"fields": Map{
+				"$unset": []string{"string_value", "object_value.name"},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 1)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"pkey_int": 110,
+		},
+		nil,
+		[]Doc{
+			{
+				"pkey_int":     110,
+				"int_value":    100,
+				"bool_value":   true,
+				"object_value": Map{},
+			},
+		})
+
+	resp := expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "update")).
+		WithJSON(Map{
+			"fields": Map{
+				"$unset": []string{"pkey_int"},
+			},
+			"filter": Map{
+				"pkey_int": 110,
+			},
+		}).Expect()
+	testError(resp, http.StatusBadRequest, api.Code_INVALID_ARGUMENT, "primary key field 'pkey_int' can't be unset")
+}
+
+func (s *DocumentSuite) TestUpdate_NumericOperators() {
+	inputDocument := []Doc{
+		{
+			"pkey_int":     120,
+			"int_value":    100,
+			"double_value": 10.5,
+		},
+	}
+
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{
+				"pkey_int": 120,
+			},
+		},
+		Map{
+			"fields": Map{
+				"$increment": Map{
+					"int_value": 5,
+				},
+				"$multiply": Map{
+					"double_value": 2,
+				},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 1)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"pkey_int": 120,
+		},
+		nil,
+		[]Doc{
+			{
+				"pkey_int":     120,
+				"int_value":    105,
+				"double_value": 21,
+			},
+		})
+
+	resp := expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "update")).
+		WithJSON(Map{
+			"fields": Map{
+				"$increment": Map{
+					"int_value": 1.5,
+				},
+			},
+			"filter": Map{
+				"pkey_int": 120,
+			},
+		}).Expect()
+	testError(resp, http.StatusBadRequest, api.Code_INVALID_ARGUMENT, "'$increment' needs an integer value for field 'int_value'")
+}
+
+func (s *DocumentSuite) TestUpdate_ArrayOperators() {
+	inputDocument := []Doc{
+		{
+			"pkey_int": 130,
+			"array_value": []Doc{
+				{"id": 1, "product": "foo"},
+				{"id": 2, "product": "bar"},
+			},
+		},
+	}
+
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{
+				"pkey_int": 130,
+			},
+		},
+		Map{
+			"fields": Map{
+				"$push": Map{
+					"array_value": Map{
+						"id":      3,
+						"product": "baz",
+					},
+				},
+				"$pull": Map{
+					"array_value": Map{
+						"id": Map{
+							"$lt": 2,
+						},
+					},
+				},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 1)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"pkey_int": 130,
+		},
+		nil,
+		[]Doc{
+			{
+				"pkey_int": 130,
+				"array_value": []Doc{
+					{"id": 2, "product": "bar"},
+					{"id": 3, "product": "baz"},
+				},
+			},
+		})
+
+	resp := expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "update")).
+		WithJSON(Map{
+			"fields": Map{
+				"$push": Map{
+					"int_value": 1,
+				},
+			},
+			"filter": Map{
+				"pkey_int": 130,
+			},
+		}).Expect()
+	testError(resp, http.StatusBadRequest, api.Code_INVALID_ARGUMENT, "'$push' is only supported on array fields, found 'int_value'")
+}
+
 func (s *DocumentSuite) TestUpdate_MultipleRows() {
 	inputDocument := []Doc{
 		{
@@ -1161,7 +1375,8 @@ func (s *DocumentSuite) TestDelete_MultipleRows() {
 	}).Status(http.StatusOK).
 		JSON().
 		Object().
-		ValueEqual("status", "deleted")
+		ValueEqual("status", "deleted").
+		ValueEqual("deleted_count", 2)
 
 	readAndValidate(s.T(),
 		s.database,
@@ -1177,50 +1392,507 @@ func (s *DocumentSuite) TestDelete_MultipleRows() {
 	)
 }
 
-func (s *DocumentSuite) TestRead_MultipleRows() {
+func (s *DocumentSuite) TestDelete_KeyRange() {
+	inputDocument := []Doc{
+		{"pkey_int": 90, "int_value": 1},
+		{"pkey_int": 91, "int_value": 2},
+		{"pkey_int": 92, "int_value": 3},
+		{"pkey_int": 93, "int_value": 4},
+	}
+
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	// all the rows of the range are matching, so the range is deleted as a whole
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{
+			"pkey_int": Map{
+				"$gte": 90,
+				"$lt":  92,
+			},
+		},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("status", "deleted").
+		ValueEqual("deleted_count", 2)
+
+	// the condition on the non key field is only matching some of the rows of the range
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{
+			"pkey_int": Map{
+				"$gt": 91,
+			},
+			"int_value": 4,
+		},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("status", "deleted").
+		ValueEqual("deleted_count", 1)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"pkey_int": Map{
+				"$gte": 90,
+				"$lte": 93,
+			},
+		},
+		nil,
+		[]Doc{
+			{"pkey_int": 92, "int_value": 3},
+		})
+}
+
+func (s *DocumentSuite) TestUpdateAndDelete_NonPrimaryKeyFilter() {
 	inputDocument := []Doc{
 		{
-			"pkey_int":     210,
-			"int_value":    1000,
-			"string_value": "simple_insert110",
-			"bool_value":   true,
-			"double_value": 1000.000001,
-			"bytes_value":  []byte(`"simple_insert110"`),
+			"pkey_int":     80,
+			"int_value":    1,
+			"string_value": "non_pkey_filter",
 		},
 		{
-			"pkey_int":     220,
-			"int_value":    2000,
-			"string_value": "simple_insert120",
-			"bool_value":   false,
-			"double_value": 2000.22221,
-			"bytes_value":  []byte(`"simple_insert120"`),
+			"pkey_int":     81,
+			"int_value":    2,
+			"string_value": "non_pkey_filter",
 		},
 		{
-			"pkey_int":     230,
-			"string_value": "simple_insert130",
-			"bytes_value":  []byte(`"simple_insert130"`),
+			"pkey_int":     82,
+			"int_value":    3,
+			"string_value": "non_pkey_filter_other",
 		},
 	}
 
-	// should always succeed with mustNotExists as false
 	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
 		Status(http.StatusOK)
 
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{
+				"string_value": "non_pkey_filter",
+			},
+		},
+		Map{
+			"fields": Map{
+				"$increment": Map{
+					"int_value": 10,
+				},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 2)
+
 	readFilter := Map{
 		"$or": []Doc{
-			{"pkey_int": 210},
-			{"pkey_int": 220},
-			{"pkey_int": 230},
+			{"pkey_int": 80},
+			{"pkey_int": 81},
+			{"pkey_int": 82},
 		},
 	}
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		readFilter,
+		nil,
+		[]Doc{
+			{"pkey_int": 80, "int_value": 11, "string_value": "non_pkey_filter"},
+			{"pkey_int": 81, "int_value": 12, "string_value": "non_pkey_filter"},
+			{"pkey_int": 82, "int_value": 3, "string_value": "non_pkey_filter_other"},
+		})
 
-	cases := []struct {
-		fields       Map
-		expDocuments []Doc
-	}{
-		{
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{
+			"int_value": 12,
+		},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("status", "deleted").
+		ValueEqual("deleted_count", 1)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		readFilter,
+		nil,
+		[]Doc{
+			{"pkey_int": 80, "int_value": 11, "string_value": "non_pkey_filter"},
+			{"pkey_int": 82, "int_value": 3, "string_value": "non_pkey_filter_other"},
+		})
+}
+
+func (s *DocumentSuite) TestUpdate_Upsert() {
+	upsert := func(stringValue string, expStatus string, expModified int) {
+		resp := updateByFilter(s.T(),
+			s.database,
+			s.collection,
 			Map{
-				"int_value":    1,
+				"filter": Map{
+					"pkey_int":  90,
+					"int_value": Map{"$gt": 0},
+				},
+				"options": Map{
+					"upsert": true,
+				},
+			},
+			Map{
+				"fields": Map{
+					"$set": Map{
+						"string_value": stringValue,
+					},
+					"$increment": Map{
+						"int_value": 1,
+					},
+				},
+			}).Status(http.StatusOK).
+			JSON().
+			Object().
+			ValueEqual("status", expStatus)
+		if expModified > 0 {
+			resp.ValueEqual("modified_count", expModified)
+		} else {
+			resp.NotContainsKey("modified_count").
+				ValueEqual("keys", []Map{{"pkey_int": 90}})
+		}
+	}
+
+	// no document is matching the filter, the document is inserted
+	upsert("upsert_inserted", "inserted", 0)
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{"pkey_int": 90},
+		nil,
+		[]Doc{{"pkey_int": 90, "int_value": 1, "string_value": "upsert_inserted"}})
+
+	// the inserted document is now matching the filter, so it is modified
+	upsert("upsert_modified", "updated", 1)
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{"pkey_int": 90},
+		nil,
+		[]Doc{{"pkey_int": 90, "int_value": 2, "string_value": "upsert_modified"}})
+}
+
+func (s *DocumentSuite) TestUpdateAndDelete_ReturnDocuments() {
+	inputDocument := []Doc{
+		{
+			"pkey_int":     95,
+			"int_value":    1,
+			"string_value": "return_documents",
+		},
+	}
+
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	for _, c := range []struct {
+		returning string
+		expDoc    Map
+	}{
+		{"before", Map{"int_value": 1}},
+		{"after", Map{"int_value": 3}},
+	} {
+		updateByFilter(s.T(),
+			s.database,
+			s.collection,
+			Map{
+				"filter": Map{
+					"pkey_int": 95,
+				},
+				"return_fields": Map{
+					"int_value": true,
+				},
+				"options": Map{
+					"return_documents": c.returning,
+				},
+			},
+			Map{
+				"fields": Map{
+					"$increment": Map{
+						"int_value": 1,
+					},
+				},
+			}).Status(http.StatusOK).
+			JSON().
+			Object().
+			ValueEqual("modified_count", 1).
+			ValueEqual("documents", []Map{c.expDoc})
+	}
+
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{"pkey_int": 95},
+		"options": Map{
+			"return_documents": "before",
+		},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("deleted_count", 1).
+		ValueEqual("documents", []Map{{"pkey_int": 95, "int_value": 3, "string_value": "return_documents"}})
+
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{"pkey_int": 95},
+		"options": Map{
+			"return_documents": "after",
+		},
+	}).Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "unsupported value 'after' of return_documents")
+}
+
+func (s *DocumentSuite) TestUpdate_MergeAndPatch() {
+	insertDocuments(s.T(), s.database, s.collection, []Doc{
+		{
+			"pkey_int":     97,
+			"int_value":    1,
+			"string_value": "merge",
+			"object_value": Map{"name": "foo"},
+			"array_value":  []Doc{{"id": 1, "product": "a"}},
+		},
+	}, false).Status(http.StatusOK)
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{"pkey_int": 97},
+		},
+		Map{
+			"fields": Map{
+				"$merge": Map{
+					"int_value":    2,
+					"string_value": nil,
+					"object_value": Map{"name": "bar"},
+				},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 1)
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{"pkey_int": 97},
+		},
+		Map{
+			"fields": Map{
+				"$patch": []Doc{
+					{"op": "test", "path": "/int_value", "value": 2},
+					{"op": "add", "path": "/array_value/-", "value": Doc{"id": 2, "product": "b"}},
+					{"op": "copy", "from": "/object_value/name", "path": "/string_value"},
+				},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 1)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{"pkey_int": 97},
+		nil,
+		[]Doc{
+			{
+				"pkey_int":     97,
+				"int_value":    2,
+				"string_value": "bar",
+				"object_value": Map{"name": "bar"},
+				"array_value":  []Doc{{"id": 1, "product": "a"}, {"id": 2, "product": "b"}},
+			},
+		})
+
+	// the test operation is failing as the value is already changed
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{"pkey_int": 97},
+		},
+		Map{
+			"fields": Map{
+				"$patch": []Doc{
+					{"op": "test", "path": "/int_value", "value": 1},
+					{"op": "replace", "path": "/int_value", "value": 3},
+				},
+			},
+		}).Status(http.StatusPreconditionFailed)
+
+	// the patched document is validated against the schema
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{"pkey_int": 97},
+		},
+		Map{
+			"fields": Map{
+				"$merge": Map{"int_value": "not an integer"},
+			},
+		}).Status(http.StatusBadRequest)
+}
+
+func (s *DocumentSuite) TestConditionalWrites_Version() {
+	readVersion := func() int64 {
+		readResp := readByFilter(s.T(), s.database, s.collection, Map{"pkey_int": 96}, nil)
+		require.Equal(s.T(), 1, len(readResp))
+
+		var result struct {
+			Metadata struct {
+				Version int64 `json:"version"`
+			} `json:"metadata"`
+		}
+		require.NoError(s.T(), json.Unmarshal(readResp[0]["result"], &result))
+		return result.Metadata.Version
+	}
+	replace := func(version int64) *httpexpect.Response {
+		return expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "replace")).
+			WithJSON(Map{
+				"documents": []Doc{{"pkey_int": 96, "int_value": version}},
+				"options":   Map{"if_version": version},
+			}).Expect()
+	}
+
+	insertDocuments(s.T(), s.database, s.collection, []Doc{{"pkey_int": 96, "int_value": 0}}, true).
+		Status(http.StatusOK)
+	require.Equal(s.T(), int64(1), readVersion())
+
+	replace(1).Status(http.StatusOK)
+	require.Equal(s.T(), int64(2), readVersion())
+
+	// the version is already incremented by the previous replace
+	replace(1).Status(http.StatusPreconditionFailed).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "document version is '2', expected version '1'")
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter":  Map{"pkey_int": 96},
+			"options": Map{"if_version": 2},
+		},
+		Map{
+			"fields": Map{"$increment": Map{"int_value": 1}},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 1)
+	require.Equal(s.T(), int64(3), readVersion())
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter":  Map{"pkey_int": 96},
+			"options": Map{"if_version": 2},
+		},
+		Map{
+			"fields": Map{"$increment": Map{"int_value": 1}},
+		}).Status(http.StatusPreconditionFailed)
+
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter":  Map{"pkey_int": 96},
+		"options": Map{"if_version": 2},
+	}).Status(http.StatusPreconditionFailed)
+
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter":  Map{"pkey_int": 96},
+		"options": Map{"if_version": 3},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("deleted_count", 1)
+
+	replace(3).Status(http.StatusPreconditionFailed).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "document doesn't exist, expected version '3'")
+
+	// the replace without the precondition also increments the version
+	expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "replace")).
+		WithJSON(Map{
+			"documents": []Doc{{"pkey_int": 96, "int_value": 0}},
+		}).Expect().Status(http.StatusOK)
+	require.Equal(s.T(), int64(1), readVersion())
+	expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "replace")).
+		WithJSON(Map{
+			"documents": []Doc{{"pkey_int": 96, "int_value": 1}},
+		}).Expect().Status(http.StatusOK)
+	require.Equal(s.T(), int64(2), readVersion())
+
+	replace(2).Status(http.StatusOK)
+	require.Equal(s.T(), int64(3), readVersion())
+
+	expect(s.T()).PUT(getDocumentURL(s.database, s.collection, "replace")).
+		WithJSON(Map{
+			"documents": []Doc{{"pkey_int": 96, "int_value": 0}, {"pkey_int": 97, "int_value": 0}},
+			"options":   Map{"if_version": 3},
+		}).Expect().Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "if_version is only supported when replacing a single document")
+}
+
+func (s *DocumentSuite) TestRead_MultipleRows() {
+	inputDocument := []Doc{
+		{
+			"pkey_int":     210,
+			"int_value":    1000,
+			"string_value": "simple_insert110",
+			"bool_value":   true,
+			"double_value": 1000.000001,
+			"bytes_value":  []byte(`"simple_insert110"`),
+		},
+		{
+			"pkey_int":     220,
+			"int_value":    2000,
+			"string_value": "simple_insert120",
+			"bool_value":   false,
+			"double_value": 2000.22221,
+			"bytes_value":  []byte(`"simple_insert120"`),
+		},
+		{
+			"pkey_int":     230,
+			"string_value": "simple_insert130",
+			"bytes_value":  []byte(`"simple_insert130"`),
+		},
+	}
+
+	// should always succeed with mustNotExists as false
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	readFilter := Map{
+		"$or": []Doc{
+			{"pkey_int": 210},
+			{"pkey_int": 220},
+			{"pkey_int": 230},
+		},
+	}
+
+	cases := []struct {
+		fields       Map
+		expDocuments []Doc
+	}{
+		{
+			Map{
+				"int_value":    1,
 				"string_value": 1,
 				"bytes_value":  1,
 			},
@@ -1288,6 +1960,152 @@ func (s *DocumentSuite) TestRead_MultipleRows() {
 	}
 }
 
+func (s *DocumentSuite) TestRangeOnPrimaryKey() {
+	inputDocument := []Doc{
+		{
+			"pkey_int":     310,
+			"int_value":    1,
+			"string_value": "simple_insert310",
+		},
+		{
+			"pkey_int":     320,
+			"int_value":    2,
+			"string_value": "simple_insert320",
+		},
+		{
+			"pkey_int":     330,
+			"int_value":    3,
+			"string_value": "simple_insert330",
+		},
+	}
+
+	// should always succeed with mustNotExists as false
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	rangeFilter := Map{
+		"pkey_int": Map{
+			"$gte": 310,
+			"$lt":  340,
+		},
+	}
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		rangeFilter,
+		nil,
+		inputDocument)
+
+	// conditions on non key fields are applied on the rows of the range
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"pkey_int":  Map{"$gt": 310},
+			"int_value": 3,
+		},
+		nil,
+		inputDocument[2:])
+
+	updateByFilter(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"filter": Map{
+				"pkey_int": Map{
+					"$gt":  310,
+					"$lte": 330,
+				},
+			},
+		},
+		Map{
+			"fields": Map{
+				"$set": Map{
+					"int_value": 100,
+				},
+			},
+		}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("modified_count", 2)
+
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{
+			"pkey_int":  Map{"$gt": 300, "$lt": 340},
+			"int_value": 100,
+		},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("status", "deleted")
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		rangeFilter,
+		nil,
+		inputDocument[0:1])
+}
+
+func (s *DocumentSuite) TestInOnPrimaryKey() {
+	inputDocument := []Doc{
+		{
+			"pkey_int":     410,
+			"string_value": "simple_insert410",
+		},
+		{
+			"pkey_int":     420,
+			"string_value": "simple_insert420",
+		},
+		{
+			"pkey_int":     430,
+			"string_value": "simple_insert430",
+		},
+	}
+
+	// should always succeed with mustNotExists as false
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	inFilter := Map{
+		"pkey_int": Map{
+			"$in": []int{410, 420, 430},
+		},
+	}
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		inFilter,
+		nil,
+		inputDocument)
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		Map{
+			"pkey_int":     Map{"$in": []int{410, 420, 430}},
+			"string_value": Map{"$nin": []string{"simple_insert410", "simple_insert430"}},
+		},
+		nil,
+		inputDocument[1:2])
+
+	deleteByFilter(s.T(), s.database, s.collection, Map{
+		"filter": Map{
+			"pkey_int": Map{"$in": []int{410, 430}},
+		},
+	}).Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("status", "deleted")
+
+	readAndValidate(s.T(),
+		s.database,
+		s.collection,
+		inFilter,
+		nil,
+		inputDocument[1:2])
+}
+
 func (s *DocumentSuite) TestRead_EntireCollection() {
 	dropCollection(s.T(), s.database, s.collection)
 	createCollection(s.T(), s.database, s.collection, testCreateSchema).Status(http.StatusOK)
@@ -1328,6 +2146,321 @@ func (s *DocumentSuite) TestRead_EntireCollection() {
 		inputDocument)
 }
 
+func (s *DocumentSuite) TestRead_Sort() {
+	inputDocument := []Doc{
+		{"pkey_int": 510, "int_value": 3, "string_value": "sort_b"},
+		{"pkey_int": 520, "int_value": 1, "string_value": "sort_a"},
+		{"pkey_int": 530, "int_value": 2, "string_value": "sort_b"},
+	}
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	rangeFilter := Map{"pkey_int": Map{"$gte": 510, "$lte": 530}}
+	cases := []struct {
+		sort         []Map
+		limit        int
+		expDocuments []Doc
+	}{
+		{
+			// reverse range scan
+			[]Map{{"pkey_int": "$desc"}},
+			0,
+			[]Doc{inputDocument[2], inputDocument[1], inputDocument[0]},
+		},
+		{
+			// sorted in memory
+			[]Map{{"int_value": "$asc"}},
+			0,
+			[]Doc{inputDocument[1], inputDocument[2], inputDocument[0]},
+		},
+		{
+			[]Map{{"string_value": "$desc"}, {"int_value": "$asc"}},
+			2,
+			[]Doc{inputDocument[2], inputDocument[0]},
+		},
+	}
+	for _, c := range cases {
+		var options Map
+		if c.limit > 0 {
+			options = Map{"limit": c.limit}
+		}
+		documents, _ := readDocuments(s.T(), readWithOptions(s.T(), s.database, s.collection, rangeFilter, c.sort, options))
+		requireDocuments(s.T(), c.expDocuments, documents)
+	}
+
+	readWithOptions(s.T(), s.database, s.collection, rangeFilter, []Map{{"int_value": "asc"}}, nil).
+		Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "sort needs an array of fields with '$asc' or '$desc'")
+
+	readWithOptions(s.T(), s.database, s.collection, rangeFilter, []Map{{"foo": "$asc"}}, nil).
+		Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "sort field 'foo' doesn't exist in the schema")
+}
+
+func (s *DocumentSuite) TestRead_ResumeAndSkip() {
+	inputDocument := []Doc{
+		{"pkey_int": 610, "int_value": 4},
+		{"pkey_int": 620, "int_value": 3},
+		{"pkey_int": 630, "int_value": 2},
+		{"pkey_int": 640, "int_value": 1},
+	}
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	rangeFilter := Map{"pkey_int": Map{"$gte": 610, "$lte": 640}}
+	cases := []struct {
+		name    string
+		sort    []Map
+		ordered []Doc
+	}{
+		{"key order", nil, inputDocument},
+		{"reverse key order", []Map{{"pkey_int": "$desc"}}, []Doc{inputDocument[3], inputDocument[2], inputDocument[1], inputDocument[0]}},
+		{"sorted in memory", []Map{{"int_value": "$asc"}}, []Doc{inputDocument[3], inputDocument[2], inputDocument[1], inputDocument[0]}},
+	}
+	for _, c := range cases {
+		// read page by page using the resume token of the last document
+		var documents []Doc
+		var offset []byte
+		for i := 0; i < 3; i++ {
+			options := Map{"limit": 2}
+			if offset != nil {
+				options["offset"] = offset
+			}
+			page, tokens := readDocuments(s.T(), readWithOptions(s.T(), s.database, s.collection, rangeFilter, c.sort, options))
+			if len(page) == 0 {
+				break
+			}
+			documents = append(documents, page...)
+			offset = tokens[len(tokens)-1]
+		}
+		requireDocuments(s.T(), c.ordered, documents)
+
+		page, _ := readDocuments(s.T(), readWithOptions(s.T(), s.database, s.collection, rangeFilter, c.sort, Map{"skip": 1, "limit": 2}))
+		requireDocuments(s.T(), c.ordered[1:3], page)
+	}
+
+	readWithOptions(s.T(), s.database, s.collection, rangeFilter, nil, Map{"offset": []byte("foo")}).
+		Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "invalid resume token")
+}
+
+func (s *DocumentSuite) TestAggregate() {
+	inputDocument := []Doc{
+		{"pkey_int": 710, "int_value": 1, "string_value": "a", "double_value": 1.5},
+		{"pkey_int": 720, "int_value": 2, "string_value": "b", "double_value": 2.5},
+		{"pkey_int": 730, "int_value": 3, "string_value": "a", "double_value": 3.5},
+		{"pkey_int": 740, "int_value": 4, "double_value": 4.5},
+	}
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	match := Map{"$match": Map{"pkey_int": Map{"$gte": 710, "$lte": 740}}}
+	cases := []struct {
+		name     string
+		pipeline []Map
+		expected []Doc
+	}{
+		{
+			"group",
+			[]Map{
+				match,
+				{"$group": Map{
+					"_id":   "$string_value",
+					"count": Map{"$sum": 1},
+					"total": Map{"$sum": Map{"$multiply": []interface{}{"$int_value", "$double_value"}}},
+					"avg":   Map{"$avg": "$int_value"},
+					"min":   Map{"$min": "$double_value"},
+					"max":   Map{"$max": "$int_value"},
+				}},
+				{"$sort": []Map{{"_id": "$asc"}}},
+			},
+			[]Doc{
+				{"_id": nil, "count": 1, "total": 18, "avg": 4, "min": 4.5, "max": 4},
+				{"_id": "a", "count": 2, "total": 12, "avg": 2, "min": 1.5, "max": 3},
+				{"_id": "b", "count": 1, "total": 5, "avg": 2, "min": 2.5, "max": 2},
+			},
+		},
+		{
+			"count by field",
+			[]Map{
+				match,
+				{"$group": Map{"_id": "$string_value", "count": Map{"$sum": 1}}},
+				{"$sort": []Map{{"count": "$desc"}, {"_id": "$asc"}}},
+				{"$limit": 2},
+			},
+			[]Doc{
+				{"_id": "a", "count": 2},
+				{"_id": nil, "count": 1},
+			},
+		},
+		{
+			"project",
+			[]Map{
+				match,
+				{"$sort": []Map{{"int_value": "$desc"}}},
+				{"$limit": 2},
+				{"$project": Map{"_id": 0, "pkey_int": 1, "value": Map{"$add": []interface{}{"$int_value", 10}}}},
+			},
+			[]Doc{
+				{"pkey_int": 740, "value": 14},
+				{"pkey_int": 730, "value": 13},
+			},
+		},
+	}
+	for _, c := range cases {
+		documents, _ := readDocuments(s.T(), aggregate(s.T(), s.database, s.collection, c.pipeline))
+		requireDocuments(s.T(), c.expected, documents)
+	}
+
+	aggregate(s.T(), s.database, s.collection, []Map{{"$limit": 1}, match}).
+		Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "$match is only supported as the first stage of the pipeline")
+}
+
+func aggregate(t *testing.T, db string, collection string, pipeline []Map) *httpexpect.Response {
+	e := expect(t)
+	return e.POST(getDocumentURL(db, collection, "aggregate")).
+		WithJSON(Map{"pipeline": pipeline}).
+		Expect()
+}
+
+func (s *DocumentSuite) TestCount() {
+	inputDocument := []Doc{
+		{"pkey_int": 750, "int_value": 1, "string_value": "a"},
+		{"pkey_int": 760, "int_value": 2, "string_value": "b"},
+		{"pkey_int": 770, "int_value": 3, "string_value": "a"},
+	}
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	cases := []struct {
+		filter   Map
+		expected int
+	}{
+		{Map{"pkey_int": Map{"$gte": 750, "$lte": 770}}, 3},
+		{Map{"$and": []Map{{"pkey_int": Map{"$gte": 750, "$lte": 770}}, {"string_value": "a"}}}, 2},
+		{Map{"pkey_int": 760}, 1},
+		{Map{"pkey_int": 761}, 0},
+	}
+	for _, c := range cases {
+		count(s.T(), s.database, s.collection, c.filter).
+			Status(http.StatusOK).
+			JSON().
+			Object().
+			ValueEqual("count", c.expected)
+	}
+}
+
+func (s *DocumentSuite) TestDistinct() {
+	inputDocument := []Doc{
+		{"pkey_int": 780, "int_value": 3, "string_value": "b"},
+		{"pkey_int": 790, "int_value": 1, "string_value": "a"},
+		{"pkey_int": 800, "int_value": 3, "string_value": "a"},
+		{"pkey_int": 810, "int_value": 2},
+	}
+	insertDocuments(s.T(), s.database, s.collection, inputDocument, false).
+		Status(http.StatusOK)
+
+	filter := Map{"pkey_int": Map{"$gte": 780, "$lte": 810}}
+	cases := []struct {
+		field    string
+		expected []interface{}
+	}{
+		{"int_value", []interface{}{1, 2, 3}},
+		// the document without the field is skipped
+		{"string_value", []interface{}{"a", "b"}},
+	}
+	for _, c := range cases {
+		distinct(s.T(), s.database, s.collection, c.field, filter).
+			Status(http.StatusOK).
+			JSON().
+			Object().
+			ValueEqual("values", c.expected)
+	}
+
+	distinct(s.T(), s.database, s.collection, "", filter).
+		Status(http.StatusBadRequest).
+		JSON().
+		Path("$.error").
+		Object().
+		ValueEqual("message", "field is a required field")
+}
+
+func count(t *testing.T, db string, collection string, filter Map) *httpexpect.Response {
+	e := expect(t)
+	return e.POST(getDocumentURL(db, collection, "count")).
+		WithJSON(Map{"filter": filter}).
+		Expect()
+}
+
+func distinct(t *testing.T, db string, collection string, field string, filter Map) *httpexpect.Response {
+	e := expect(t)
+	return e.POST(getDocumentURL(db, collection, "distinct")).
+		WithJSON(Map{"field": field, "filter": filter}).
+		Expect()
+}
+
+func readWithOptions(t *testing.T, db string, collection string, filter Map, sort []Map, options Map) *httpexpect.Response {
+	payload := Map{
+		"filter": filter,
+	}
+	if sort != nil {
+		payload["sort"] = sort
+	}
+	if options != nil {
+		payload["options"] = options
+	}
+
+	e := expect(t)
+	return e.POST(getDocumentURL(db, collection, "read")).
+		WithJSON(payload).
+		Expect()
+}
+
+// readDocuments returns the documents and the resume tokens of the streamed read or aggregate response.
+func readDocuments(t *testing.T, resp *httpexpect.Response) ([]Doc, [][]byte) {
+	body := resp.Status(http.StatusOK).
+		Body().
+		Raw()
+
+	var documents []Doc
+	var tokens [][]byte
+	dec := json.NewDecoder(bytes.NewReader([]byte(body)))
+	for dec.More() {
+		var r struct {
+			Result struct {
+				Data        Doc    `json:"data"`
+				ResumeToken []byte `json:"resume_token"`
+			} `json:"result"`
+		}
+		require.NoError(t, dec.Decode(&r))
+		documents = append(documents, r.Result.Data)
+		tokens = append(tokens, r.Result.ResumeToken)
+	}
+
+	return documents, tokens
+}
+
+func requireDocuments(t *testing.T, expected []Doc, actual []Doc) {
+	expDocuments, err := json.Marshal(expected)
+	require.NoError(t, err)
+	actualDocuments, err := json.Marshal(actual)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expDocuments), string(actualDocuments))
+}
+
 func insertDocuments(t *testing.T, db string, collection string, documents []Doc, mustNotExist bool) *httpexpect.Response {
 	e := expect(t)
 
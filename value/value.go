@@ -15,10 +15,15 @@
 package value
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/schema"
@@ -54,36 +59,120 @@ func NewValue(fieldType schema.FieldType, value []byte) (Value, error) {
 		}
 		return NewBoolValue(b), nil
 	case schema.DoubleType:
-		val, err := strconv.ParseFloat(string(value), 64)
+		val, err := parseDouble(value)
 		if err != nil {
 			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, errors.Wrap(err, "unsupported value type ").Error())
 		}
 		return NewDoubleValue(val), nil
 	case schema.Int32Type, schema.Int64Type:
-		val, err := strconv.ParseInt(string(value), 10, 64)
+		return newIntegerValue(fieldType, value)
+	case schema.StringType:
+		return NewStringValue(string(value)), nil
+	case schema.UUIDType:
+		val, err := uuid.ParseBytes(value)
 		if err != nil {
 			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, errors.Wrap(err, "unsupported value type ").Error())
 		}
-
-		return NewIntValue(val), nil
-	case schema.StringType, schema.UUIDType, schema.DateTimeType:
-		return NewStringValue(string(value)), nil
+		return &UUIDValue{uuid: val, text: string(value)}, nil
+	case schema.DateTimeType:
+		val, err := time.Parse(time.RFC3339Nano, string(value))
+		if err != nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, errors.Wrap(err, "unsupported value type ").Error())
+		}
+		return &DateTimeValue{time: val, text: string(value)}, nil
 	case schema.ByteType:
-		if decoded, err := base64.StdEncoding.DecodeString(string(value)); err == nil {
-			// when we match the value or build the key we first decode the base64 data
-			return NewBytesValue(decoded), nil
-		} else {
-			return NewBytesValue(value), nil
+		// when we match the value or build the key we first decode the base64 data
+		decoded, err := base64.StdEncoding.DecodeString(string(value))
+		if err != nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, errors.Wrap(err, "unsupported value type ").Error())
 		}
+		return NewBytesValue(decoded), nil
 	}
 
 	return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported value type")
 }
 
+// newIntegerValue returns IntValue for the value of an integer field. A number that can't be converted to an integer
+// without losing precision i.e. a double literal in a filter, is returned as DoubleValue. Comparing IntValue with
+// DoubleValue is well-defined so such a value can still be matched with the values of the field.
+func newIntegerValue(fieldType schema.FieldType, value []byte) (Value, error) {
+	val, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		d, dErr := parseDouble(value)
+		if dErr != nil {
+			return nil, api.Errorf(api.Code_INVALID_ARGUMENT, errors.Wrap(err, "unsupported value type ").Error())
+		}
+
+		var ok bool
+		if val, ok = toInt64(d); !ok {
+			if fieldType == schema.Int32Type && (d < math.MinInt32 || d > math.MaxInt32) {
+				return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "value '%s' overflows int32", value)
+			}
+			return NewDoubleValue(d), nil
+		}
+	}
+
+	if fieldType == schema.Int32Type && (val < math.MinInt32 || val > math.MaxInt32) {
+		return nil, api.Errorf(api.Code_INVALID_ARGUMENT, "value '%s' overflows int32", value)
+	}
+	return NewIntValue(val), nil
+}
+
+// parseDouble parses the number, NaN and infinity are rejected as these can't be compared.
+func parseDouble(value []byte) (float64, error) {
+	val, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return 0, fmt.Errorf("'%s' is not a finite number", value)
+	}
+
+	return val, nil
+}
+
+// toInt64 returns the double as an integer if it is integral and in the range of int64.
+func toInt64(val float64) (int64, bool) {
+	// -2^63 and 2^63 are exactly representable as double, unlike math.MaxInt64
+	if val < math.MinInt64 || val >= -math.MinInt64 || val != math.Trunc(val) {
+		return 0, false
+	}
+
+	return int64(val), true
+}
+
+// compareIntToDouble compares the integer with the double without converting the integer to double, as that may lose
+// the precision for big integers.
+func compareIntToDouble(i int64, d float64) int {
+	if d >= -math.MinInt64 {
+		return -1
+	}
+	if d < math.MinInt64 {
+		return 1
+	}
+
+	truncated := math.Trunc(d)
+	if t := int64(truncated); i != t {
+		if i < t {
+			return -1
+		}
+		return 1
+	}
+
+	// integral parts are equal, so the fractional part decides
+	if frac := d - truncated; frac > 0 {
+		return -1
+	} else if frac < 0 {
+		return 1
+	}
+	return 0
+}
+
 func isIntegral(val float64) bool {
 	return val == float64(int(val))
 }
 
+// IntValue is the value of an integer field, it can also be compared with DoubleValue.
 type IntValue int64
 
 func NewIntValue(v int64) *IntValue {
@@ -96,6 +185,10 @@ func (i *IntValue) CompareTo(v Value) (int, error) {
 		return 1, nil
 	}
 
+	if d, ok := v.(*DoubleValue); ok {
+		return compareIntToDouble(int64(*i), float64(*d)), nil
+	}
+
 	converted, ok := v.(*IntValue)
 	if !ok {
 		return -2, fmt.Errorf("wrong type compared ")
@@ -122,6 +215,7 @@ func (i *IntValue) String() string {
 	return fmt.Sprintf("%d", *i)
 }
 
+// DoubleValue is the value of a number field, it can also be compared with IntValue.
 type DoubleValue float64
 
 func NewDoubleValue(v float64) *DoubleValue {
@@ -134,6 +228,10 @@ func (d *DoubleValue) CompareTo(v Value) (int, error) {
 		return 1, nil
 	}
 
+	if i, ok := v.(*IntValue); ok {
+		return -compareIntToDouble(int64(*i), float64(*d)), nil
+	}
+
 	converted, ok := v.(*DoubleValue)
 	if !ok {
 		return -2, fmt.Errorf("wrong type compared ")
@@ -236,6 +334,91 @@ func (s *BytesValue) String() string {
 	return string(*s)
 }
 
+// UUIDValue is the parsed value of a UUID along with its text as it is in the document. The values are ordered by their
+// bytes, which is same as ordering their canonical string form, and then by the text. The keys and the search index
+// have the text, so the values are only equal if the text is same i.e. the case of the hex digits is same.
+type UUIDValue struct {
+	uuid uuid.UUID
+	text string
+}
+
+// NewUUIDValue returns the value of the UUID with the canonical text i.e. lower case hex digits.
+func NewUUIDValue(v uuid.UUID) *UUIDValue {
+	return &UUIDValue{uuid: v, text: v.String()}
+}
+
+func (u *UUIDValue) CompareTo(v Value) (int, error) {
+	if v == nil {
+		return 1, nil
+	}
+
+	converted, ok := v.(*UUIDValue)
+	if !ok {
+		return -2, fmt.Errorf("wrong type compared ")
+	}
+
+	if res := bytes.Compare(u.uuid[:], converted.uuid[:]); res != 0 {
+		return res, nil
+	}
+	return strings.Compare(u.text, converted.text), nil
+}
+
+func (u *UUIDValue) AsInterface() interface{} {
+	return u.text
+}
+
+func (u *UUIDValue) String() string {
+	if u == nil {
+		return ""
+	}
+
+	return u.text
+}
+
+// DateTimeValue is the time parsed from the RFC 3339 representation along with the text as it is in the document. The
+// values are ordered as times, so the values with different offsets are ordered correctly, and then by the text. The
+// keys have the text, so the values are only equal if the text is same.
+type DateTimeValue struct {
+	time time.Time
+	text string
+}
+
+// NewDateTimeValue returns the value of the time with the text formatted as RFC 3339 with nanoseconds.
+func NewDateTimeValue(v time.Time) *DateTimeValue {
+	return &DateTimeValue{time: v, text: v.Format(time.RFC3339Nano)}
+}
+
+func (d *DateTimeValue) CompareTo(v Value) (int, error) {
+	if v == nil {
+		return 1, nil
+	}
+
+	converted, ok := v.(*DateTimeValue)
+	if !ok {
+		return -2, fmt.Errorf("wrong type compared ")
+	}
+
+	if d.time.Equal(converted.time) {
+		return strings.Compare(d.text, converted.text), nil
+	} else if d.time.Before(converted.time) {
+		return -1, nil
+	} else {
+		return 1, nil
+	}
+}
+
+func (d *DateTimeValue) AsInterface() interface{} {
+	return d.text
+}
+
+func (d *DateTimeValue) String() string {
+	if d == nil {
+		return ""
+	}
+
+	return d.text
+}
+
 type BoolValue bool
 
 func NewBoolValue(v bool) *BoolValue {
@@ -273,3 +456,55 @@ func (b *BoolValue) String() string {
 
 	return fmt.Sprintf("%v", *b)
 }
+
+// ArrayValue is a list of values. It is used when a condition is on a list of values like "$in" or when the value of
+// a field is an array. Two arrays are compared element by element, and if all the elements are equal then the shorter
+// array is smaller.
+type ArrayValue []Value
+
+func NewArrayValue(v []Value) *ArrayValue {
+	a := ArrayValue(v)
+	return &a
+}
+
+func (a *ArrayValue) CompareTo(v Value) (int, error) {
+	if v == nil {
+		return 1, nil
+	}
+
+	converted, ok := v.(*ArrayValue)
+	if !ok {
+		return -2, fmt.Errorf("wrong type compared ")
+	}
+
+	for i := 0; i < len(*a) && i < len(*converted); i++ {
+		res, err := (*a)[i].CompareTo((*converted)[i])
+		if err != nil || res != 0 {
+			return res, err
+		}
+	}
+
+	if len(*a) == len(*converted) {
+		return 0, nil
+	} else if len(*a) < len(*converted) {
+		return -1, nil
+	} else {
+		return 1, nil
+	}
+}
+
+func (a *ArrayValue) AsInterface() interface{} {
+	var values = make([]interface{}, 0, len(*a))
+	for _, v := range *a {
+		values = append(values, v.AsInterface())
+	}
+	return values
+}
+
+func (a *ArrayValue) String() string {
+	if a == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", []Value(*a))
+}
@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"math"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	api "github.com/tigrisdata/tigris/api/server/v1"
 	"github.com/tigrisdata/tigris/schema"
@@ -57,11 +59,26 @@ func TestNewValue(t *testing.T) {
 			[]byte(`ImZvbyI=`),
 			NewBytesValue([]byte(`"foo"`)),
 			nil,
+		}, {
+			schema.ByteType,
+			[]byte(`foo`),
+			nil,
+			api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported value type : illegal base64 data at input byte 0"),
 		}, {
 			schema.BoolType,
 			[]byte(`true`),
 			NewBoolValue(true),
 			nil,
+		}, {
+			schema.DateTimeType,
+			[]byte(`2022-01-01T05:00:00+05:00`),
+			&DateTimeValue{time: time.Date(2022, 1, 1, 5, 0, 0, 0, time.FixedZone("", 5*60*60)), text: `2022-01-01T05:00:00+05:00`},
+			nil,
+		}, {
+			schema.UUIDType,
+			[]byte(`1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E`),
+			&UUIDValue{uuid: uuid.MustParse("1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e"), text: `1E6E4A5C-0BC1-4F2E-9C3D-2B4C3F1A8D9E`},
+			nil,
 		},
 	}
 	for _, c := range cases {
@@ -154,4 +171,157 @@ func TestValue(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, 1, r)
 	})
+	t.Run("numeric", func(t *testing.T) {
+		i := NewIntValue(10)
+
+		r, err := i.CompareTo(NewDoubleValue(10))
+		require.NoError(t, err)
+		require.Equal(t, 0, r)
+
+		r, err = i.CompareTo(NewDoubleValue(10.5))
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+
+		r, err = NewDoubleValue(9.5).CompareTo(i)
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+
+		r, err = NewDoubleValue(-10.5).CompareTo(NewIntValue(-10))
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+
+		// no precision is lost for the integers that can't be represented as double
+		r, err = NewIntValue(math.MaxInt64).CompareTo(NewDoubleValue(math.MaxInt64))
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+
+		r, err = NewIntValue(math.MinInt64).CompareTo(NewDoubleValue(-1e20))
+		require.NoError(t, err)
+		require.Equal(t, 1, r)
+	})
+	t.Run("numeric coercion", func(t *testing.T) {
+		v, err := NewValue(schema.Int64Type, []byte(`10.0`))
+		require.NoError(t, err)
+		require.Equal(t, NewIntValue(10), v)
+
+		v, err = NewValue(schema.Int64Type, []byte(`10.5`))
+		require.NoError(t, err)
+		require.Equal(t, NewDoubleValue(10.5), v)
+
+		v, err = NewValue(schema.Int64Type, []byte(`1e20`))
+		require.NoError(t, err)
+		require.Equal(t, NewDoubleValue(1e20), v)
+
+		_, err = NewValue(schema.Int32Type, []byte(`2147483648`))
+		require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "value '2147483648' overflows int32"), err)
+
+		_, err = NewValue(schema.Int32Type, []byte(`-3e9`))
+		require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "value '-3e9' overflows int32"), err)
+
+		v, err = NewValue(schema.Int32Type, []byte(`2147483647`))
+		require.NoError(t, err)
+		require.Equal(t, NewIntValue(math.MaxInt32), v)
+
+		_, err = NewValue(schema.DoubleType, []byte(`NaN`))
+		require.Equal(t, api.Errorf(api.Code_INVALID_ARGUMENT, "unsupported value type : 'NaN' is not a finite number"), err)
+
+		_, err = NewValue(schema.DoubleType, []byte(`1e400`))
+		require.Error(t, err)
+
+		_, err = NewValue(schema.Int64Type, []byte(`Inf`))
+		require.Error(t, err)
+	})
+	t.Run("datetime", func(t *testing.T) {
+		i, err := NewValue(schema.DateTimeType, []byte(`2022-01-01T00:00:00Z`))
+		require.NoError(t, err)
+
+		// same time with a different offset is ordered by the text
+		v, err := NewValue(schema.DateTimeType, []byte(`2022-01-01T05:30:00+05:30`))
+		require.NoError(t, err)
+		r, err := i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+
+		v, err = NewValue(schema.DateTimeType, []byte(`2022-01-01T00:00:00Z`))
+		require.NoError(t, err)
+		r, err = i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, 0, r)
+
+		// lexically bigger but an earlier time
+		v, err = NewValue(schema.DateTimeType, []byte(`2022-01-01T04:00:00+05:00`))
+		require.NoError(t, err)
+		r, err = i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, 1, r)
+
+		v, err = NewValue(schema.DateTimeType, []byte(`2022-01-01T00:00:00.5Z`))
+		require.NoError(t, err)
+		r, err = i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+		// the text is kept as it is for the keys
+		require.Equal(t, "2022-01-01T00:00:00Z", i.AsInterface())
+		require.Equal(t, "2022-01-01T00:00:00.5Z", v.AsInterface())
+
+		_, err = NewValue(schema.DateTimeType, []byte(`2022-01-01`))
+		require.Error(t, err)
+	})
+	t.Run("uuid", func(t *testing.T) {
+		i, err := NewValue(schema.UUIDType, []byte(`aaaaaaaa-0bc1-4f2e-9c3d-2b4c3f1a8d9e`))
+		require.NoError(t, err)
+
+		// same UUID with upper case hex digits is ordered by the text
+		v, err := NewValue(schema.UUIDType, []byte(`AAAAAAAA-0BC1-4F2E-9C3D-2B4C3F1A8D9E`))
+		require.NoError(t, err)
+		r, err := i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, 1, r)
+		require.Equal(t, "AAAAAAAA-0BC1-4F2E-9C3D-2B4C3F1A8D9E", v.AsInterface())
+
+		v, err = NewValue(schema.UUIDType, []byte(`1e6e4a5c-0bc1-4f2e-9c3d-2b4c3f1a8d9e`))
+		require.NoError(t, err)
+		r, err = i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, 1, r)
+		require.Equal(t, "aaaaaaaa-0bc1-4f2e-9c3d-2b4c3f1a8d9e", i.AsInterface())
+
+		_, err = NewValue(schema.UUIDType, []byte(`foo`))
+		require.Error(t, err)
+	})
+	t.Run("bytes", func(t *testing.T) {
+		// "/w==" is 0xFF which is bigger than 0x01 ("AQ==") even though it is lexically smaller as base64
+		i, err := NewValue(schema.ByteType, []byte(`/w==`))
+		require.NoError(t, err)
+
+		v, err := NewValue(schema.ByteType, []byte(`AQ==`))
+		require.NoError(t, err)
+		r, err := i.CompareTo(v)
+		require.NoError(t, err)
+		require.Equal(t, 1, r)
+	})
+	t.Run("array", func(t *testing.T) {
+		i := NewArrayValue([]Value{NewIntValue(1), NewIntValue(2)})
+
+		r, err := i.CompareTo(NewArrayValue([]Value{NewIntValue(1), NewIntValue(2)}))
+		require.NoError(t, err)
+		require.Equal(t, 0, r)
+
+		r, err = i.CompareTo(NewArrayValue([]Value{NewIntValue(1), NewIntValue(3)}))
+		require.NoError(t, err)
+		require.Equal(t, -1, r)
+
+		r, err = i.CompareTo(NewArrayValue([]Value{NewIntValue(1)}))
+		require.NoError(t, err)
+		require.Equal(t, 1, r)
+
+		r, err = i.CompareTo(NewArrayValue([]Value{NewStringValue("1")}))
+		require.Equal(t, fmt.Errorf("wrong type compared "), err)
+		require.Equal(t, -2, r)
+
+		r, err = i.CompareTo(NewIntValue(1))
+		require.Equal(t, fmt.Errorf("wrong type compared "), err)
+		require.Equal(t, -2, r)
+		require.Equal(t, []interface{}{int64(1), int64(2)}, i.AsInterface())
+	})
 }